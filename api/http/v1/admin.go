@@ -2,15 +2,12 @@ package v1
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/rixtrayker/go-loadbalancer/internal/admin"
 )
 
-// RegisterAdminAPI registers all admin API endpoints
-func RegisterAdminAPI(mux *http.ServeMux) {
-	// Register admin API routes
-	mux.HandleFunc("/api/v1/admin/status", admin.StatusHandler)
-	mux.HandleFunc("/api/v1/admin/backends", admin.BackendsHandler)
-	mux.HandleFunc("/api/v1/admin/metrics", admin.MetricsHandler)
-	// Add more admin API endpoints as needed
+// RegisterAdminAPI registers all admin API endpoints under basePath/v1
+func RegisterAdminAPI(mux *http.ServeMux, api *admin.API, basePath string) {
+	api.RegisterHandlers(mux, strings.TrimSuffix(basePath, "/")+"/v1")
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a config file into a temporary directory
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runValidate runs the validate subcommand and returns its exit code and
+// what it wrote to stderr
+func runValidate(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	code := validate(args)
+	os.Stderr = stderr
+	w.Close()
+
+	output, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, string(output)
+}
+
+func TestValidateCommand(t *testing.T) {
+	valid := writeConfig(t, `
+backend_pools:
+  - name: web
+    backends:
+      - url: http://10.0.0.1:8080
+routing_rules:
+  - target_pool: web
+`)
+	if code, output := runValidate(t, "-config", valid); code != 0 {
+		t.Fatalf("exit code %d for a valid config: %s", code, output)
+	}
+
+	invalid := writeConfig(t, `
+backend_pools:
+  - name: web
+    algorithm: fastest
+    backends:
+      - url: ftp://10.0.0.1
+routing_rules:
+  - target_pool: web
+    priorty: 10
+`)
+	code, output := runValidate(t, "-config", invalid, "-set", "routing_rules.0.match.method=FETCH")
+	if code != 1 {
+		t.Errorf("exit code %d for an invalid config, want 1", code)
+	}
+	for _, want := range []string{
+		invalid + ":9: routing_rules.0.priorty: ",
+		invalid + ":4: backend_pools.0.algorithm: ",
+		invalid + ":6: backend_pools.0.backends.0.url: ",
+		"flag: routing_rules.0.match.method: ",
+		"4 problem(s) found",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output does not contain %q:\n%s", want, output)
+		}
+	}
+}
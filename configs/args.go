@@ -0,0 +1,157 @@
+package configs
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Args holds free-form, named arguments for pluggable components such as
+// policies. The typed accessors return def when a key is absent and an error
+// when a value cannot be converted to the requested type.
+type Args map[string]interface{}
+
+// Has reports whether key is set
+func (a Args) Has(key string) bool {
+	_, ok := a[key]
+	return ok
+}
+
+// String returns the argument as a string
+func (a Args) String(key, def string) (string, error) {
+	v, ok := a[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case int, int64, float64, bool:
+		return fmt.Sprint(val), nil
+	default:
+		return "", fmt.Errorf("argument %q: expected string, got %T", key, v)
+	}
+}
+
+// Int returns the argument as an int
+func (a Args) Int(key string, def int) (int, error) {
+	v, ok := a[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch val := v.(type) {
+	case int:
+		return val, nil
+	case int64:
+		return int(val), nil
+	case float64:
+		if val != float64(int(val)) {
+			return 0, fmt.Errorf("argument %q: expected integer, got %v", key, val)
+		}
+		return int(val), nil
+	case string:
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return 0, fmt.Errorf("argument %q: %w", key, err)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("argument %q: expected integer, got %T", key, v)
+	}
+}
+
+// Float returns the argument as a float64
+func (a Args) Float(key string, def float64) (float64, error) {
+	v, ok := a[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch val := v.(type) {
+	case float64:
+		return val, nil
+	case int:
+		return float64(val), nil
+	case int64:
+		return float64(val), nil
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return 0, fmt.Errorf("argument %q: %w", key, err)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("argument %q: expected number, got %T", key, v)
+	}
+}
+
+// Bool returns the argument as a bool
+func (a Args) Bool(key string, def bool) (bool, error) {
+	v, ok := a[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch val := v.(type) {
+	case bool:
+		return val, nil
+	case string:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return false, fmt.Errorf("argument %q: %w", key, err)
+		}
+		return b, nil
+	default:
+		return false, fmt.Errorf("argument %q: expected bool, got %T", key, v)
+	}
+}
+
+// Duration returns the argument as a time.Duration. Strings are parsed with
+// time.ParseDuration and bare numbers are taken as seconds.
+func (a Args) Duration(key string, def time.Duration) (time.Duration, error) {
+	v, ok := a[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch val := v.(type) {
+	case string:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return 0, fmt.Errorf("argument %q: %w", key, err)
+		}
+		return d, nil
+	case int:
+		return time.Duration(val) * time.Second, nil
+	case int64:
+		return time.Duration(val) * time.Second, nil
+	case float64:
+		return time.Duration(val * float64(time.Second)), nil
+	default:
+		return 0, fmt.Errorf("argument %q: expected duration, got %T", key, v)
+	}
+}
+
+// StringSlice returns the argument as a list of strings. A single string is
+// returned as a one-element list.
+func (a Args) StringSlice(key string) ([]string, error) {
+	v, ok := a[key]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	switch val := v.(type) {
+	case string:
+		return []string{val}, nil
+	case []string:
+		return val, nil
+	case []interface{}:
+		out := make([]string, 0, len(val))
+		for i, item := range val {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("argument %q[%d]: expected string, got %T", key, i, item)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("argument %q: expected list of strings, got %T", key, v)
+	}
+}
@@ -0,0 +1,29 @@
+package configs
+
+// Clone returns a copy of the configuration whose pools, backends, routing
+// rules and policies can be modified without affecting the original.
+// Policy arguments are shared and must be replaced rather than edited.
+func (c *Config) Clone() *Config {
+	clone := *c
+
+	clone.BackendPools = make([]BackendPoolConfig, len(c.BackendPools))
+	for i, pool := range c.BackendPools {
+		pool.Backends = append([]BackendConfig(nil), pool.Backends...)
+		clone.BackendPools[i] = pool
+	}
+
+	clone.RoutingRules = make([]RoutingRuleConfig, len(c.RoutingRules))
+	for i, rule := range c.RoutingRules {
+		rule.Policies = append([]PolicyConfig(nil), rule.Policies...)
+		if rule.Match.Headers != nil {
+			headers := make(map[string]string, len(rule.Match.Headers))
+			for k, v := range rule.Match.Headers {
+				headers[k] = v
+			}
+			rule.Match.Headers = headers
+		}
+		clone.RoutingRules[i] = rule
+	}
+
+	return &clone
+}
@@ -6,64 +6,219 @@ import (
 
 // Config represents the application configuration
 type Config struct {
-	Server     ServerConfig     `yaml:"server"`
+	Server       ServerConfig        `yaml:"server"`
 	BackendPools []BackendPoolConfig `yaml:"backend_pools"`
 	RoutingRules []RoutingRuleConfig `yaml:"routing_rules"`
-	Monitoring MonitoringConfig `yaml:"monitoring"`
+	Monitoring   MonitoringConfig    `yaml:"monitoring"`
 }
 
-// ServerConfig contains server-specific configuration
+// ServerConfig contains server-specific configuration. HealthPath is the
+// path of the load balancer's own health endpoint, answered when no routing
+// rule matches it. TrustedProxies lists
+// the IP addresses and CIDRs of proxies in front of the load balancer whose
+// X-Forwarded-For and X-Real-IP headers identify the client.
 type ServerConfig struct {
-	Address      string `yaml:"address"`
-	TLSCert      string `yaml:"tls_cert"`
-	TLSKey       string `yaml:"tls_key"`
-	AdminEnable  bool   `yaml:"admin_enable"`
-	AdminPath    string `yaml:"admin_path"`
-	ReadTimeout  int    `yaml:"read_timeout"`
-	WriteTimeout int    `yaml:"write_timeout"`
-	IdleTimeout  int    `yaml:"idle_timeout"`
-	CorsEnabled  bool   `yaml:"cors_enabled"`
-}
-
-// BackendPoolConfig represents a group of backend servers
+	Address        string          `yaml:"address"`
+	TLSCert        string          `yaml:"tls_cert"`
+	TLSKey         string          `yaml:"tls_key"`
+	AdminEnable    bool            `yaml:"admin_enable"`
+	AdminAddress   string          `yaml:"admin_address"`
+	AdminPath      string          `yaml:"admin_path"`
+	AdminAuth      AdminAuthConfig `yaml:"admin_auth"`
+	ReadTimeout    int             `yaml:"read_timeout"`
+	WriteTimeout   int             `yaml:"write_timeout"`
+	IdleTimeout    int             `yaml:"idle_timeout"`
+	CorsEnabled    bool            `yaml:"cors_enabled"`
+	WatchConfig    bool            `yaml:"watch_config"`
+	Zone           string          `yaml:"zone"`
+	HealthPath     string          `yaml:"health_path"`
+	TrustedProxies []string        `yaml:"trusted_proxies"`
+}
+
+// AdminAuthConfig configures authentication for the admin API. Clients
+// present a bearer token, or a TLS client certificate signed by ClientCA
+// whose common name is mapped to a role in ClientRoles.
+type AdminAuthConfig struct {
+	Tokens      []AdminTokenConfig `yaml:"tokens"`
+	TLSCert     string             `yaml:"tls_cert"`
+	TLSKey      string             `yaml:"tls_key"`
+	ClientCA    string             `yaml:"client_ca"`
+	ClientRoles map[string]string  `yaml:"client_roles"`
+}
+
+// AdminTokenConfig grants a role to a bearer token
+type AdminTokenConfig struct {
+	Token string `yaml:"token"`
+	Role  string `yaml:"role"`
+}
+
+// BackendPoolConfig represents a group of backend servers. AlgorithmArgs
+// holds the settings of the algorithm, e.g. the hash key of consistent_hash.
+// OverprovisioningFactor scales the healthy share of a priority tier when
+// deciding how much traffic spills over to lower tiers. When every backend
+// is at its MaxConnections, up to MaxPending requests wait for one for at
+// most QueueTimeout.
 type BackendPoolConfig struct {
-	Name        string           `yaml:"name"`
-	Algorithm   string           `yaml:"algorithm"`
-	Backends    []BackendConfig  `yaml:"backends"`
-	HealthCheck HealthCheckConfig `yaml:"health_check"`
+	Name                   string               `yaml:"name"`
+	Algorithm              string               `yaml:"algorithm"`
+	AlgorithmArgs          Args                 `yaml:"algorithm_args"`
+	Backends               []BackendConfig      `yaml:"backends"`
+	OverprovisioningFactor float64              `yaml:"overprovisioning_factor"`
+	HealthCheck            HealthCheckConfig    `yaml:"health_check"`
+	Transport              TransportConfig      `yaml:"transport"`
+	CircuitBreaker         CircuitBreakerConfig `yaml:"circuit_breaker"`
+	StickySession          StickySessionConfig  `yaml:"sticky_session"`
+	SlowStart              SlowStartConfig      `yaml:"slow_start"`
+	ZoneRouting            ZoneRoutingConfig    `yaml:"zone_routing"`
+	MaxPending             int                  `yaml:"max_pending"`
+	QueueTimeout           time.Duration        `yaml:"queue_timeout"`
 }
 
-// BackendConfig represents a single backend server
+// BackendConfig represents a single backend server. Backends with a lower
+// Priority value are preferred; backups only take traffic when every
+// priority tier is degraded. Zone is the availability zone the backend runs
+// in. MaxConnections caps the requests the backend serves at once, 0 for no
+// cap.
 type BackendConfig struct {
-	URL    string `yaml:"url"`
-	Weight int    `yaml:"weight"`
+	URL            string `yaml:"url"`
+	Weight         int    `yaml:"weight"`
+	Priority       int    `yaml:"priority"`
+	Backup         bool   `yaml:"backup"`
+	Zone           string `yaml:"zone"`
+	MaxConnections int    `yaml:"max_connections"`
 }
 
-// HealthCheckConfig defines health check parameters
+// HealthCheckConfig defines health check parameters. A backend changes state
+// only after HealthyThreshold consecutive successful probes or
+// UnhealthyThreshold consecutive failed probes.
 type HealthCheckConfig struct {
+	Path               string        `yaml:"path"`
+	Interval           time.Duration `yaml:"interval"`
+	Timeout            time.Duration `yaml:"timeout"`
+	Method             string        `yaml:"method"`
+	HealthyThreshold   int           `yaml:"healthy_threshold"`
+	UnhealthyThreshold int           `yaml:"unhealthy_threshold"`
+
+	OutlierDetection OutlierDetectionConfig `yaml:"outlier_detection"`
+}
+
+// OutlierDetectionConfig defines passive health checking: backends whose
+// live responses stand out are ejected for a while. Consecutive5xx and
+// ConsecutiveGatewayErrors eject after that many failures in a row;
+// LatencyFactor ejects backends whose mean latency over an Interval is that
+// many times the pool median. Each trigger is disabled when zero.
+type OutlierDetectionConfig struct {
+	Consecutive5xx           int           `yaml:"consecutive_5xx"`
+	ConsecutiveGatewayErrors int           `yaml:"consecutive_gateway_errors"`
+	LatencyFactor            float64       `yaml:"latency_factor"`
+	LatencyMinRequests       int           `yaml:"latency_min_requests"`
+	Interval                 time.Duration `yaml:"interval"`
+	BaseEjectionTime         time.Duration `yaml:"base_ejection_time"`
+	MaxEjectionTime          time.Duration `yaml:"max_ejection_time"`
+	MaxEjectionPercent       int           `yaml:"max_ejection_percent"`
+}
+
+// CircuitBreakerConfig defines when the circuit breaker of a backend opens.
+// It opens after ConsecutiveFailures failed requests in a row, or when the
+// share of failed requests within Window reaches ErrorRate. Either trigger
+// is disabled when zero, and the breaker is disabled when both are.
+type CircuitBreakerConfig struct {
+	ConsecutiveFailures int           `yaml:"consecutive_failures"`
+	ErrorRate           float64       `yaml:"error_rate"`
+	Window              time.Duration `yaml:"window"`
+	MinRequests         int           `yaml:"min_requests"`
+	OpenDuration        time.Duration `yaml:"open_duration"`
+	HalfOpenRequests    int           `yaml:"half_open_requests"`
+}
+
+// StickySessionConfig pins clients to the backend that served their first
+// request. Mode is cookie, header, or empty to disable sticky sessions. The
+// backend is identified by a value signed with Secret; when Secret is empty
+// a random key is used, which only this process accepts.
+type StickySessionConfig struct {
+	Mode     string        `yaml:"mode"`
+	Name     string        `yaml:"name"`
+	Secret   string        `yaml:"secret"`
+	TTL      time.Duration `yaml:"ttl"`
 	Path     string        `yaml:"path"`
-	Interval time.Duration `yaml:"interval"`
-	Timeout  time.Duration `yaml:"timeout"`
-	Method   string        `yaml:"method"`
+	SameSite string        `yaml:"same_site"`
+	Secure   bool          `yaml:"secure"`
+}
+
+// SlowStartConfig ramps up the traffic of backends that were just added or
+// became healthy again. Over Window, the effective weight of such a backend
+// grows linearly from MinWeightPercent of its weight to the full weight.
+// Slow start is disabled when Window is zero.
+type SlowStartConfig struct {
+	Window           time.Duration `yaml:"window"`
+	MinWeightPercent int           `yaml:"min_weight_percent"`
+}
+
+// ZoneRoutingConfig keeps traffic in the zone of the load balancer, set as
+// server.zone. While at least MinHealthyPercent of the capacity of the local
+// zone is available only local backends get requests; below that, requests
+// spill over to all zones in proportion to their available capacity.
+type ZoneRoutingConfig struct {
+	Enabled           bool `yaml:"enabled"`
+	MinHealthyPercent int  `yaml:"min_healthy_percent"`
+}
+
+// TransportConfig tunes the upstream connections of a pool. Every backend
+// gets its own transport with these settings; zero values use the defaults.
+type TransportConfig struct {
+	MaxIdleConns          int           `yaml:"max_idle_conns"`
+	MaxConns              int           `yaml:"max_conns"`
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`
+	DialTimeout           time.Duration `yaml:"dial_timeout"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
+	KeepAlive             time.Duration `yaml:"keep_alive"`
+	DisableKeepAlives     bool          `yaml:"disable_keep_alives"`
+	DisableHTTP2          bool          `yaml:"disable_http2"`
 }
 
-// RoutingRuleConfig defines how requests are routed
+// RoutingRuleConfig defines how requests are routed. Rules with a higher
+// priority are evaluated first; rules with equal priority are evaluated in
+// config order.
 type RoutingRuleConfig struct {
-	Match      MatchConfig      `yaml:"match"`
-	TargetPool string           `yaml:"target_pool"`
-	Policies   []PolicyConfig   `yaml:"policies"`
+	Name       string         `yaml:"name"`
+	Priority   int            `yaml:"priority"`
+	Match      MatchConfig    `yaml:"match"`
+	TargetPool string         `yaml:"target_pool"`
+	Policies   []PolicyConfig `yaml:"policies"`
+	Retry      RetryConfig    `yaml:"retry"`
+}
+
+// RetryConfig defines when a failed request is retried on another backend
+// of the target pool. RetryOn lists the conditions to retry on:
+// connect_error, timeout, 502, 503 and 504.
+type RetryConfig struct {
+	MaxAttempts        int           `yaml:"max_attempts"`
+	RetryOn            []string      `yaml:"retry_on"`
+	RetryNonIdempotent bool          `yaml:"retry_non_idempotent"`
+	PerTryTimeout      time.Duration `yaml:"per_try_timeout"`
+	MaxBodyBytes       int64         `yaml:"max_body_bytes"`
 }
 
-// MatchConfig defines criteria for matching requests
+// MatchConfig defines criteria for matching requests. Path matches exactly,
+// or as a wildcard pattern when it contains *; PathPrefix matches a path and
+// everything below it; PathRegex is a regular expression matched against the
+// whole path. At most one of the three may be set.
 type MatchConfig struct {
-	Host    string            `yaml:"host"`
-	Path    string            `yaml:"path"`
-	Method  string            `yaml:"method"`
-	Headers map[string]string `yaml:"headers"`
+	Host       string            `yaml:"host"`
+	Path       string            `yaml:"path"`
+	PathPrefix string            `yaml:"path_prefix"`
+	PathRegex  string            `yaml:"path_regex"`
+	Method     string            `yaml:"method"`
+	Headers    map[string]string `yaml:"headers"`
 }
 
-// PolicyConfig defines policies to apply to matched requests
+// PolicyConfig defines a policy to apply to matched requests. A policy is
+// either referenced by its registered name with typed arguments, or set
+// through the legacy rate_limit/transform/acl shorthand fields.
 type PolicyConfig struct {
+	Name      string `yaml:"name"`
+	Args      Args   `yaml:"args"`
 	RateLimit string `yaml:"rate_limit"`
 	Transform string `yaml:"transform"`
 	ACL       string `yaml:"acl"`
@@ -99,18 +254,18 @@ type TracingConfig struct {
 
 // LoggingConfig contains logging configuration
 type LoggingConfig struct {
-	Level         string `yaml:"level"`
-	Format        string `yaml:"format"`
-	Output        string `yaml:"output"`
+	Level          string `yaml:"level"`
+	Format         string `yaml:"format"`
+	Output         string `yaml:"output"`
 	IncludeTraceID bool   `yaml:"include_trace_id"`
-	IncludeSpanID bool   `yaml:"include_span_id"`
+	IncludeSpanID  bool   `yaml:"include_span_id"`
 }
 
 // MetricsConfig contains metrics retention and aggregation settings
 type MetricsConfig struct {
 	RetentionPeriod     string `yaml:"retention_period"`
 	AggregationInterval string `yaml:"aggregation_interval"`
-	MaxSeries          int    `yaml:"max_series"`
+	MaxSeries           int    `yaml:"max_series"`
 }
 
 // AlertsConfig contains alerting thresholds
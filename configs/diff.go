@@ -0,0 +1,132 @@
+package configs
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Change is a single configuration value that differs between two
+// configurations. Old or New is empty when the value was added or removed.
+type Change struct {
+	Path string
+	Old  string
+	New  string
+}
+
+// String formats the change for logging
+func (c Change) String() string {
+	switch {
+	case c.Old == "":
+		return fmt.Sprintf("%s: added %s", c.Path, c.New)
+	case c.New == "":
+		return fmt.Sprintf("%s: removed %s", c.Path, c.Old)
+	default:
+		return fmt.Sprintf("%s: %s -> %s", c.Path, c.Old, c.New)
+	}
+}
+
+// Diff returns the values that differ between old and new, sorted by path.
+// Paths use the config file field names; pools and rules are identified by
+// name and backends by URL so reordering them is not reported as a change.
+// Secrets such as admin tokens and sticky session keys are redacted.
+func Diff(old, new *Config) []Change {
+	before := make(map[string]string)
+	after := make(map[string]string)
+	flatten(reflect.ValueOf(old).Elem(), "", before)
+	flatten(reflect.ValueOf(new).Elem(), "", after)
+
+	var changes []Change
+	for path, oldValue := range before {
+		if newValue := after[path]; newValue != oldValue {
+			changes = append(changes, Change{Path: path, Old: oldValue, New: newValue})
+		}
+	}
+	for path, newValue := range after {
+		if _, ok := before[path]; !ok {
+			changes = append(changes, Change{Path: path, New: newValue})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// secretFields are the field names whose values are redacted wherever the
+// configuration is printed
+var secretFields = map[string]bool{"token": true, "secret": true}
+
+// flatten records every non-zero leaf value of v under its dotted path
+func flatten(v reflect.Value, path string, out map[string]string) {
+	if v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case v.Type() == durationType:
+		if v.Int() != 0 {
+			out[path] = time.Duration(v.Int()).String()
+		}
+
+	case v.Kind() == reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			if secretFields[name] {
+				if v.Field(i).String() != "" {
+					out[join(path, name)] = "<redacted>"
+				}
+				continue
+			}
+			flatten(v.Field(i), join(path, name), out)
+		}
+
+	case v.Kind() == reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			flatten(v.Index(i), fmt.Sprintf("%s[%s]", path, elementKey(v.Index(i), i)), out)
+		}
+
+	case v.Kind() == reflect.Map:
+		for _, key := range v.MapKeys() {
+			flatten(v.MapIndex(key), fmt.Sprintf("%s[%v]", path, key.Interface()), out)
+		}
+
+	default:
+		if !v.IsZero() {
+			out[path] = fmt.Sprint(v.Interface())
+		}
+	}
+}
+
+// elementKey identifies a slice element by its name or URL, falling back to
+// its index
+func elementKey(v reflect.Value, index int) string {
+	if v.Kind() == reflect.Struct {
+		for _, field := range []string{"Name", "URL"} {
+			if f := v.FieldByName(field); f.IsValid() && f.Kind() == reflect.String && f.String() != "" {
+				return f.String()
+			}
+		}
+	}
+	return fmt.Sprint(index)
+}
+
+// join appends a field name to a dotted path
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,452 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of environment variables that override config
+// values
+const EnvPrefix = "LB_"
+
+// envAliases maps environment variables that predate the full mapping to
+// their config paths
+var envAliases = map[string]string{
+	"LB_LOG_LEVEL":    "monitoring.logging.level",
+	"LB_ADMIN_ENABLE": "server.admin_enable",
+}
+
+var configType = reflect.TypeOf(Config{})
+
+// mapProvider is a koanf provider for an already parsed layer
+type mapProvider map[string]interface{}
+
+// ReadBytes is not supported, the layer is read with Read
+func (p mapProvider) ReadBytes() ([]byte, error) {
+	return nil, errors.New("mapProvider does not support ReadBytes")
+}
+
+// Read returns the layer
+func (p mapProvider) Read() (map[string]interface{}, error) {
+	return p, nil
+}
+
+// indexed holds list elements set by index, e.g. from LB_BACKEND_POOLS_0_NAME.
+// Unlike a list in a config file, which replaces the list below it, indexed
+// elements are merged into the existing list.
+type indexed map[int]interface{}
+
+// envLayer is the value set by a single environment variable
+type envLayer struct {
+	source string
+	values map[string]interface{}
+}
+
+// envLayers maps LB_* variables onto config paths. Variable names are matched
+// against the config schema, so LB_BACKEND_POOLS_0_HEALTH_CHECK_PATH sets
+// backend_pools[0].health_check.path. Variables that match no config key are
+// ignored, since other tools may share the prefix.
+func envLayers(environ []string) ([]envLayer, error) {
+	var layers []envLayer
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+
+		var (
+			path []interface{}
+			t    reflect.Type
+		)
+		if alias, ok := envAliases[name]; ok {
+			path, t, _ = resolveKey(configType, strings.Split(alias, "."))
+		} else {
+			tokens := strings.Split(strings.ToLower(strings.TrimPrefix(name, EnvPrefix)), "_")
+			path, t, ok = resolveEnv(configType, tokens)
+			if !ok {
+				continue
+			}
+		}
+
+		v, err := parseValue(value, t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		layers = append(layers, envLayer{
+			source: "env:" + name,
+			values: insert(nil, path, v).(map[string]interface{}),
+		})
+	}
+
+	// Apply in a stable order so overlapping variables resolve predictably
+	sort.Slice(layers, func(i, j int) bool {
+		return layers[i].source < layers[j].source
+	})
+	return layers, nil
+}
+
+// overrideLayer parses a key=value command-line override
+func overrideLayer(override string) (map[string]interface{}, error) {
+	key, value, ok := strings.Cut(override, "=")
+	if !ok || key == "" {
+		return nil, fmt.Errorf("invalid override %q: expected key=value", override)
+	}
+
+	path, t, err := resolveKey(configType, strings.Split(key, "."))
+	if err != nil {
+		return nil, fmt.Errorf("invalid override %q: %w", override, err)
+	}
+
+	v, err := parseValue(value, t)
+	if err != nil {
+		return nil, fmt.Errorf("invalid override %q: %w", override, err)
+	}
+	return insert(nil, path, v).(map[string]interface{}), nil
+}
+
+// resolveEnv matches the lower-cased tokens of an environment variable name
+// against t. Field names themselves contain underscores, so the longest
+// matching field name is tried first. Map keys take the remaining tokens.
+func resolveEnv(t reflect.Type, tokens []string) ([]interface{}, reflect.Type, bool) {
+	if len(tokens) == 0 {
+		return nil, t, true
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := fieldNames(t)
+		for n := len(tokens); n > 0; n-- {
+			field, ok := fields[strings.Join(tokens[:n], "_")]
+			if !ok {
+				continue
+			}
+			if rest, leaf, ok := resolveEnv(field.Type, tokens[n:]); ok {
+				return append([]interface{}{fieldName(field)}, rest...), leaf, true
+			}
+		}
+
+	case reflect.Slice:
+		index, err := strconv.Atoi(tokens[0])
+		if err != nil || index < 0 {
+			return nil, nil, false
+		}
+		if rest, leaf, ok := resolveEnv(t.Elem(), tokens[1:]); ok {
+			return append([]interface{}{index}, rest...), leaf, true
+		}
+
+	case reflect.Map:
+		return []interface{}{strings.Join(tokens, "_")}, t.Elem(), true
+	}
+
+	return nil, nil, false
+}
+
+// resolveKey matches the parts of a dotted config key against t. Map keys
+// take the remaining parts so they may contain dots.
+func resolveKey(t reflect.Type, parts []string) ([]interface{}, reflect.Type, error) {
+	if len(parts) == 0 {
+		return nil, t, nil
+	}
+
+	var (
+		segment interface{}
+		next    reflect.Type
+	)
+	switch t.Kind() {
+	case reflect.Struct:
+		field, ok := fieldNames(t)[parts[0]]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown config key: %s", parts[0])
+		}
+		segment, next = parts[0], field.Type
+
+	case reflect.Slice:
+		index, err := strconv.Atoi(parts[0])
+		if err != nil || index < 0 {
+			return nil, nil, fmt.Errorf("expected a list index, got %s", parts[0])
+		}
+		segment, next = index, t.Elem()
+
+	case reflect.Map:
+		return []interface{}{strings.Join(parts, ".")}, t.Elem(), nil
+
+	default:
+		return nil, nil, fmt.Errorf("%s is not a config section", parts[0])
+	}
+
+	rest, leaf, err := resolveKey(next, parts[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+	return append([]interface{}{segment}, rest...), leaf, nil
+}
+
+// fieldNames indexes the fields of a config struct by their yaml name
+func fieldNames(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if name := fieldName(t.Field(i)); name != "" && name != "-" {
+			fields[name] = t.Field(i)
+		}
+	}
+	return fields
+}
+
+// fieldName returns the yaml name of a struct field
+func fieldName(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("yaml"), ",")[0]
+}
+
+// parseValue converts a string from the environment or command line for a
+// config value of type t. Strings are taken verbatim; anything else is
+// parsed as YAML so lists and whole sections can be set too.
+func parseValue(s string, t reflect.Type) (interface{}, error) {
+	if t.Kind() == reflect.String {
+		return s, nil
+	}
+
+	var v interface{}
+	if err := yaml3.Unmarshal([]byte(s), &v); err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return s, nil
+	}
+	return v, nil
+}
+
+// insert sets value at path below node, creating maps for field names and
+// indexed elements for list indexes
+func insert(node interface{}, path []interface{}, value interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+
+	switch key := path[0].(type) {
+	case int:
+		m, ok := node.(indexed)
+		if !ok {
+			m = indexed{}
+		}
+		m[key] = insert(m[key], path[1:], value)
+		return m
+	default:
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			m = make(map[string]interface{})
+		}
+		name := key.(string)
+		m[name] = insert(m[name], path[1:], value)
+		return m
+	}
+}
+
+// mergeLayer merges a layer into the config loaded so far. Maps are merged
+// key by key, lists replace the list below them and indexed elements are
+// merged into it.
+func mergeLayer(src, dest map[string]interface{}) error {
+	for key, value := range src {
+		dest[key] = mergeValue(dest[key], value)
+	}
+	return nil
+}
+
+func mergeValue(dest, src interface{}) interface{} {
+	switch s := src.(type) {
+	case map[string]interface{}:
+		d, ok := dest.(map[string]interface{})
+		if !ok {
+			d = make(map[string]interface{}, len(s))
+		}
+		mergeLayer(s, d)
+		return d
+
+	case indexed:
+		d, _ := dest.([]interface{})
+		size := len(d)
+		for i := range s {
+			if i >= size {
+				size = i + 1
+			}
+		}
+		list := make([]interface{}, size)
+		copy(list, d)
+		for i, value := range s {
+			list[i] = mergeValue(list[i], value)
+		}
+		return list
+
+	default:
+		return src
+	}
+}
+
+// flattenValues records every leaf of a layer under its dotted path, with
+// list elements addressed by index
+func flattenValues(v interface{}, path string, out map[string]interface{}) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 && path != "" {
+			out[path] = val
+		}
+		for key, item := range val {
+			flattenValues(item, join(path, key), out)
+		}
+	case []interface{}:
+		if len(val) == 0 {
+			out[path] = val
+		}
+		for i, item := range val {
+			flattenValues(item, join(path, strconv.Itoa(i)), out)
+		}
+	case indexed:
+		for i, item := range val {
+			flattenValues(item, join(path, strconv.Itoa(i)), out)
+		}
+	case nil:
+	default:
+		out[path] = v
+	}
+}
+
+// keyLines returns the line of every key in a YAML or JSON document, keyed
+// by dotted path with list indexes
+func keyLines(data []byte) map[string]int {
+	var doc yaml3.Node
+	if err := yaml3.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return nil
+	}
+
+	lines := make(map[string]int)
+	nodeLines(doc.Content[0], "", lines)
+	return lines
+}
+
+func nodeLines(node *yaml3.Node, path string, lines map[string]int) {
+	switch node.Kind {
+	case yaml3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := join(path, node.Content[i].Value)
+			lines[key] = node.Content[i].Line
+			nodeLines(node.Content[i+1], key, lines)
+		}
+	case yaml3.SequenceNode:
+		for i, item := range node.Content {
+			key := join(path, strconv.Itoa(i))
+			lines[key] = item.Line
+			nodeLines(item, key, lines)
+		}
+	}
+}
+
+// setKey sets the value of key in a YAML mapping, appending it when the
+// mapping has no such key
+func setKey(mapping *yaml3.Node, key string, value *yaml3.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml3.Node{Kind: yaml3.ScalarNode, Value: key}, value)
+}
+
+// valueNode encodes a config value the way it is written in a config file:
+// struct fields that are not set are left out and durations are written
+// like "10s"
+func valueNode(v reflect.Value) *yaml3.Node {
+	if v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return &yaml3.Node{Kind: yaml3.ScalarNode, Tag: "!!null", Value: "null"}
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case v.Type() == durationType:
+		return &yaml3.Node{Kind: yaml3.ScalarNode, Value: time.Duration(v.Int()).String()}
+
+	case v.Kind() == reflect.Struct:
+		node := &yaml3.Node{Kind: yaml3.MappingNode}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name := fieldName(t.Field(i))
+			if name == "" || name == "-" || isUnset(v.Field(i)) {
+				continue
+			}
+			node.Content = append(node.Content, &yaml3.Node{Kind: yaml3.ScalarNode, Value: name}, valueNode(v.Field(i)))
+		}
+		return node
+
+	case v.Kind() == reflect.Slice:
+		node := &yaml3.Node{Kind: yaml3.SequenceNode}
+		for i := 0; i < v.Len(); i++ {
+			node.Content = append(node.Content, valueNode(v.Index(i)))
+		}
+		return node
+
+	case v.Kind() == reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		node := &yaml3.Node{Kind: yaml3.MappingNode}
+		for _, key := range keys {
+			node.Content = append(node.Content, &yaml3.Node{Kind: yaml3.ScalarNode, Value: fmt.Sprint(key.Interface())}, valueNode(v.MapIndex(key)))
+		}
+		return node
+
+	default:
+		node := &yaml3.Node{}
+		if err := node.Encode(v.Interface()); err != nil {
+			return &yaml3.Node{Kind: yaml3.ScalarNode, Value: fmt.Sprint(v.Interface())}
+		}
+		return node
+	}
+}
+
+// isUnset reports whether a config value is zero or an empty list or map,
+// which a config file leaves out
+func isUnset(v reflect.Value) bool {
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Map {
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// unknownKeys returns the keys in lines that are not part of the schema,
+// reporting only the outermost unknown key of a section
+func unknownKeys(lines map[string]int) []*FieldError {
+	var unknown []*FieldError
+	for key := range lines {
+		if _, _, err := resolveKey(configType, strings.Split(key, ".")); err == nil {
+			continue
+		}
+		if parent := parentPath(key); parent != "" {
+			if _, _, err := resolveKey(configType, strings.Split(parent, ".")); err != nil {
+				continue
+			}
+		}
+		unknown = append(unknown, &FieldError{Path: key, Message: "unknown config key"})
+	}
+
+	sort.Slice(unknown, func(i, j int) bool {
+		return lines[unknown[i].Path] < lines[unknown[j].Path]
+	})
+	return unknown
+}
+
+// parentPath returns the path of the section containing path
+func parentPath(path string) string {
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
@@ -1,49 +1,363 @@
 package configs
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 
+	kjson "github.com/knadh/koanf/parsers/json"
+	kyaml "github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
 	"gopkg.in/yaml.v2"
+	yaml3 "gopkg.in/yaml.v3"
 )
 
-// LoadConfig loads configuration from the specified file
+// LoadConfig loads configuration from the specified file, layered over the
+// defaults and overridden by LB_* environment variables
 func LoadConfig(path string) (*Config, error) {
-	// Expand path if it contains ~
-	if strings.HasPrefix(path, "~/") {
-		homeDir, err := os.UserHomeDir()
+	return NewLoader([]string{path}, nil).Load()
+}
+
+// Loader builds the configuration from layered sources. Each layer overrides
+// the ones before it: defaults, config files in the order given, LB_*
+// environment variables, then command-line overrides. The source of every
+// value is recorded and reported by Origins.
+type Loader struct {
+	files     []string
+	overrides []string
+	origins   []Origin
+	sources   map[string]string
+	locations map[string]string
+	unknown   []*FieldError
+}
+
+// Origin records the effective value of a config key and the source that
+// set it
+type Origin struct {
+	Path   string
+	Value  string
+	Source string
+}
+
+// NewLoader creates a loader for the given YAML or JSON files and
+// command-line overrides. Overrides have the form key=value where key is a
+// dotted config path such as backend_pools.0.algorithm.
+func NewLoader(files []string, overrides []string) *Loader {
+	return &Loader{
+		files:     files,
+		overrides: overrides,
+	}
+}
+
+// Files returns the config files the loader reads
+func (l *Loader) Files() []string {
+	return l.files
+}
+
+// Origins returns the effective values of the last successful Load and the
+// source of each, sorted by path. Secrets such as admin tokens and sticky
+// session keys are redacted.
+func (l *Loader) Origins() []Origin {
+	return l.origins
+}
+
+// Locate returns where the value at path, or its closest parent that was
+// set explicitly, came from: "file:line" for config files, "env:NAME" for
+// environment variables or "flag". It returns "" for defaults.
+func (l *Loader) Locate(path string) string {
+	for ; path != ""; path = parentPath(path) {
+		source, ok := l.sources[path]
+		switch {
+		case !ok || strings.HasPrefix(source, "file:"):
+			// Sections have no source of their own but do have a line
+			if location, ok := l.locations[path]; ok {
+				return location
+			}
+			if ok {
+				return strings.TrimPrefix(source, "file:")
+			}
+		case source != "default":
+			return source
+		}
+	}
+	return ""
+}
+
+// Unknown returns the keys in the config files of the last Merge that are
+// not part of the configuration schema. They are ignored when loading and
+// usually indicate a typo.
+func (l *Loader) Unknown() []*FieldError {
+	return l.unknown
+}
+
+// Load reads every layer, merges them and validates the result
+func (l *Loader) Load() (*Config, error) {
+	config, err := l.Merge()
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate configuration
+	if err := Validate(config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+// Merge reads and merges every layer without validating the result
+func (l *Loader) Merge() (*Config, error) {
+	k := koanf.New(".")
+	sources := make(map[string]string)
+	locations := make(map[string]string)
+	l.unknown = nil
+
+	defaults, err := defaultsMap()
+	if err != nil {
+		return nil, err
+	}
+	if err := loadLayer(k, mapProvider(defaults), "default", sources); err != nil {
+		return nil, err
+	}
+
+	for _, path := range l.files {
+		unknown, err := loadFile(k, path, sources, locations)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get home directory: %w", err)
+			return nil, err
 		}
-		path = filepath.Join(homeDir, path[2:])
+		l.unknown = append(l.unknown, unknown...)
 	}
 
-	// Load default configuration
-	config := DefaultConfig()
+	env, err := envLayers(os.Environ())
+	if err != nil {
+		return nil, err
+	}
+	for _, layer := range env {
+		if err := loadLayer(k, mapProvider(layer.values), layer.source, sources); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, override := range l.overrides {
+		values, err := overrideLayer(override)
+		if err != nil {
+			return nil, err
+		}
+		if err := loadLayer(k, mapProvider(values), "flag", sources); err != nil {
+			return nil, err
+		}
+	}
+
+	config := &Config{}
+	if err := k.UnmarshalWithConf("", config, koanf.UnmarshalConf{Tag: "yaml"}); err != nil {
+		return nil, fmt.Errorf("failed to decode configuration: %w", err)
+	}
+
+	l.origins = origins(k.Raw(), sources)
+	l.sources = sources
+	l.locations = locations
+	return config, nil
+}
+
+// loadFile merges a YAML or JSON config file, chosen by extension, records
+// the line of every key in locations and returns the keys that are not part
+// of the schema
+func loadFile(k *koanf.Koanf, path string, sources, locations map[string]string) ([]*FieldError, error) {
+	path, err := expandHome(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var parser koanf.Parser = kyaml.Parser()
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		parser = kjson.Parser()
+	}
 
-	// Read config file
-	data, err := ioutil.ReadFile(path)
+	data, err := file.Provider(path).ReadBytes()
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
+	values, err := parser.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	lines := keyLines(data)
+	for key, line := range lines {
+		locations[key] = fmt.Sprintf("%s:%d", path, line)
+	}
 
-	// Parse YAML
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	if err := loadLayer(k, mapProvider(values), "file:"+path, sources); err != nil {
+		return nil, err
 	}
+	return unknownKeys(lines), nil
+}
 
-	// Apply environment variables
-	applyEnvironmentVariables(config)
+// expandHome expands a leading ~/ in path to the home directory
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, path[2:]), nil
+}
 
-	// Validate configuration
-	if err := validateConfig(config); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+// loadLayer merges values into k and records source for every value set
+func loadLayer(k *koanf.Koanf, p mapProvider, source string, sources map[string]string) error {
+	leaves := make(map[string]interface{})
+	flattenValues(map[string]interface{}(p), "", leaves)
+	for path := range leaves {
+		sources[path] = source
 	}
+	return k.Load(p, nil, koanf.WithMergeFunc(mergeLayer))
+}
 
-	return config, nil
+// defaultsMap returns DefaultConfig as a generic map
+func defaultsMap() (map[string]interface{}, error) {
+	data, err := yaml.Marshal(DefaultConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode default configuration: %w", err)
+	}
+	values, err := kyaml.Parser().Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode default configuration: %w", err)
+	}
+	return values, nil
+}
+
+// origins lists the leaf values of the merged configuration with the source
+// that last set each of them
+func origins(values map[string]interface{}, sources map[string]string) []Origin {
+	leaves := make(map[string]interface{})
+	flattenValues(values, "", leaves)
+
+	result := make([]Origin, 0, len(leaves))
+	for path, value := range leaves {
+		origin := Origin{Path: path, Value: fmt.Sprint(value), Source: sources[path]}
+		if secretFields[path[strings.LastIndex(path, ".")+1:]] {
+			origin.Value = "<redacted>"
+		}
+		result = append(result, origin)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result
+}
+
+// Persistable returns an error unless every backend pool and routing rule
+// of the last Load came from the config file at path, so that SaveRouting
+// copies no defaults, values of other files, environment variables or
+// flags into it
+func (l *Loader) Persistable(path string) error {
+	var foreign []string
+	for key, source := range l.sources {
+		if source != "default" && source != "file:"+path && isRoutingKey(key) {
+			foreign = append(foreign, key)
+		}
+	}
+	if len(foreign) == 0 {
+		return nil
+	}
+
+	sort.Strings(foreign)
+	return fmt.Errorf("%s is set by %s, not by %s", foreign[0], l.sources[foreign[0]], path)
+}
+
+// isRoutingKey reports whether key is part of the backend_pools or
+// routing_rules section
+func isRoutingKey(key string) bool {
+	for _, section := range []string{"backend_pools", "routing_rules"} {
+		if key == section || strings.HasPrefix(key, section+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveRouting replaces the backend_pools and routing_rules sections of the
+// YAML or JSON config file at path with those of config and leaves the rest
+// of the file, including comments in YAML files, as it is. Only the fields
+// that are set are written. The file is replaced atomically so a failed
+// write never leaves a partial config, and keeps the permissions of the
+// file it replaces.
+func SaveRouting(path string, config *Config) error {
+	path, err := expandHome(path)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc yaml3.Node
+	if err := yaml3.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml3.Node{Kind: yaml3.DocumentNode, Content: []*yaml3.Node{{Kind: yaml3.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml3.MappingNode {
+		return fmt.Errorf("config file %s is not a mapping", path)
+	}
+	setKey(root, "backend_pools", valueNode(reflect.ValueOf(config.BackendPools)))
+	setKey(root, "routing_rules", valueNode(reflect.ValueOf(config.RoutingRules)))
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var values interface{}
+		if err := doc.Decode(&values); err != nil {
+			return fmt.Errorf("failed to encode config: %w", err)
+		}
+		data, err = json.MarshalIndent(values, "", "  ")
+		data = append(data, '\n')
+	} else {
+		var buf bytes.Buffer
+		encoder := yaml3.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		err = encoder.Encode(&doc)
+		data = buf.Bytes()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace config file: %w", err)
+	}
+	return nil
 }
 
 // DefaultConfig returns the default configuration
@@ -55,6 +369,9 @@ func DefaultConfig() *Config {
 			WriteTimeout: 30,
 			IdleTimeout:  60,
 			CorsEnabled:  false,
+			AdminAddress: "127.0.0.1:8081",
+			AdminPath:    "/admin",
+			HealthPath:   "/health",
 		},
 		Monitoring: MonitoringConfig{
 			Prometheus: PrometheusConfig{
@@ -82,70 +399,3 @@ func DefaultConfig() *Config {
 		},
 	}
 }
-
-// applyEnvironmentVariables applies environment variables to the configuration
-func applyEnvironmentVariables(config *Config) {
-	// Server configuration
-	if addr := os.Getenv("LB_SERVER_ADDRESS"); addr != "" {
-		config.Server.Address = addr
-	}
-
-	// Logging configuration
-	if level := os.Getenv("LB_LOG_LEVEL"); level != "" {
-		config.Monitoring.Logging.Level = level
-	}
-}
-
-// validateConfig validates the configuration
-func validateConfig(config *Config) error {
-	// Validate server configuration
-	if config.Server.Address == "" {
-		return fmt.Errorf("server address is required")
-	}
-
-	// Validate backend pools
-	if len(config.BackendPools) == 0 {
-		return fmt.Errorf("at least one backend pool is required")
-	}
-
-	// Validate each backend pool
-	poolNames := make(map[string]bool)
-	for _, pool := range config.BackendPools {
-		if pool.Name == "" {
-			return fmt.Errorf("backend pool name is required")
-		}
-
-		if poolNames[pool.Name] {
-			return fmt.Errorf("duplicate backend pool name: %s", pool.Name)
-		}
-		poolNames[pool.Name] = true
-
-		if len(pool.Backends) == 0 {
-			return fmt.Errorf("at least one backend is required in pool: %s", pool.Name)
-		}
-
-		for _, backend := range pool.Backends {
-			if backend.URL == "" {
-				return fmt.Errorf("backend URL is required in pool: %s", pool.Name)
-			}
-		}
-	}
-
-	// Validate routing rules
-	if len(config.RoutingRules) == 0 {
-		return fmt.Errorf("at least one routing rule is required")
-	}
-
-	// Validate each routing rule
-	for _, rule := range config.RoutingRules {
-		if rule.TargetPool == "" {
-			return fmt.Errorf("target pool is required in routing rule")
-		}
-
-		if !poolNames[rule.TargetPool] {
-			return fmt.Errorf("target pool does not exist: %s", rule.TargetPool)
-		}
-	}
-
-	return nil
-}
@@ -0,0 +1,147 @@
+package configs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveRoutingKeepsFileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("server:\n  address: \":8080\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SaveRouting(path, validConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o644 {
+		t.Errorf("config file mode %v, want %v", mode, os.FileMode(0o644))
+	}
+}
+
+// writeConfig writes a config file into a temporary directory
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const layeredConfig = `
+server:
+  address: ":9000"
+  read_timeout: 5
+backend_pools:
+  - name: web
+    algorithm: round_robin
+    backends:
+      - url: http://10.0.0.1:8080
+      - url: http://10.0.0.2:8080
+`
+
+func TestLoaderLayers(t *testing.T) {
+	base := writeConfig(t, "base.yml", layeredConfig)
+	override := writeConfig(t, "override.json", `{"server": {"read_timeout": 7}}`)
+
+	t.Setenv("LB_SERVER_ADDRESS", ":9100")
+	t.Setenv("LB_LOG_LEVEL", "debug")
+	t.Setenv("LB_BACKEND_POOLS_0_ALGORITHM", "least_conn")
+	t.Setenv("LB_BACKEND_POOLS_0_BACKENDS_1_WEIGHT", "4")
+	t.Setenv("LB_UNRELATED_TOOL_SETTING", "ignored")
+
+	loader := NewLoader([]string{base, override}, []string{
+		"server.address=:9200",
+		"backend_pools.0.backends.0.weight=2",
+	})
+	config, err := loader.Merge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flags beat environment variables, which beat files, which beat
+	// defaults
+	if config.Server.Address != ":9200" {
+		t.Errorf("address %q, want the flag", config.Server.Address)
+	}
+	if config.Server.ReadTimeout != 7 {
+		t.Errorf("read_timeout %d, want the second file", config.Server.ReadTimeout)
+	}
+	if config.Server.WriteTimeout != 30 {
+		t.Errorf("write_timeout %d, want the default", config.Server.WriteTimeout)
+	}
+	if config.Monitoring.Logging.Level != "debug" {
+		t.Errorf("log level %q, want the aliased variable", config.Monitoring.Logging.Level)
+	}
+
+	// Indexed variables and flags merge into the list from the file
+	if len(config.BackendPools) != 1 || len(config.BackendPools[0].Backends) != 2 {
+		t.Fatalf("pools %+v, want the pool of the file", config.BackendPools)
+	}
+	pool := config.BackendPools[0]
+	if pool.Name != "web" || pool.Algorithm != "least_conn" {
+		t.Errorf("pool %q with %q, want web with least_conn", pool.Name, pool.Algorithm)
+	}
+	if pool.Backends[0].URL != "http://10.0.0.1:8080" || pool.Backends[0].Weight != 2 || pool.Backends[1].Weight != 4 {
+		t.Errorf("backends %+v", pool.Backends)
+	}
+
+	sources := make(map[string]string)
+	for _, origin := range loader.Origins() {
+		sources[origin.Path] = origin.Source
+	}
+	want := map[string]string{
+		"server.address":                    "flag",
+		"server.read_timeout":               "file:" + override,
+		"server.write_timeout":              "default",
+		"monitoring.logging.level":          "env:LB_LOG_LEVEL",
+		"backend_pools.0.algorithm":         "env:LB_BACKEND_POOLS_0_ALGORITHM",
+		"backend_pools.0.name":              "file:" + base,
+		"backend_pools.0.backends.1.weight": "env:LB_BACKEND_POOLS_0_BACKENDS_1_WEIGHT",
+	}
+	for path, source := range want {
+		if sources[path] != source {
+			t.Errorf("%s set by %q, want %q", path, sources[path], source)
+		}
+	}
+
+	if location := loader.Locate("backend_pools.0.name"); location != base+":6" {
+		t.Errorf("Locate() = %q, want %s:6", location, base)
+	}
+	if location := loader.Locate("monitoring.prometheus.path"); location != "" {
+		t.Errorf("Locate() of a default = %q", location)
+	}
+}
+
+func TestLoaderLayerErrors(t *testing.T) {
+	path := writeConfig(t, "config.yml", layeredConfig)
+
+	tests := []struct {
+		name      string
+		env       map[string]string
+		overrides []string
+	}{
+		{name: "env value of the wrong type", env: map[string]string{"LB_SERVER_READ_TIMEOUT": "soon"}},
+		{name: "override without value", overrides: []string{"server.address"}},
+		{name: "override of an unknown key", overrides: []string{"server.adress=:80"}},
+		{name: "override of the wrong type", overrides: []string{"server.admin_enable=maybe"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			if _, err := NewLoader([]string{path}, tt.overrides).Merge(); err == nil {
+				t.Error("Merge() succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package configs
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// placeholderTokenPrefix starts the example admin tokens of the docs, which
+// must be replaced before use
+const placeholderTokenPrefix = "change-me"
+
+// FieldError is a problem with a configuration value. Path is the dotted
+// config key with list indexes, e.g. backend_pools.0.backends.1.url.
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// fieldErrors collects the problems found while checking a config
+type fieldErrors []*FieldError
+
+func (errs *fieldErrors) add(path, format string, args ...interface{}) {
+	*errs = append(*errs, &FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate validates the configuration and returns the first problem found
+func Validate(config *Config) error {
+	if errs := Check(config); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// Check returns every structural problem in the configuration: missing
+// required values, duplicates and references to pools that do not exist
+func Check(config *Config) []*FieldError {
+	var errs fieldErrors
+
+	// Validate server configuration
+	if config.Server.Address == "" {
+		errs.add("server.address", "server address is required")
+	}
+
+	for i, proxy := range config.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			errs.add(fmt.Sprintf("server.trusted_proxies.%d", i), "invalid IP or CIDR %q", proxy)
+		}
+	}
+
+	// Validate admin API configuration
+	if config.Server.AdminEnable {
+		checkAdminConfig(config.Server, &errs)
+	}
+
+	// Validate backend pools
+	if len(config.BackendPools) == 0 {
+		errs.add("backend_pools", "at least one backend pool is required")
+	}
+
+	poolNames := make(map[string]bool)
+	for i, pool := range config.BackendPools {
+		path := fmt.Sprintf("backend_pools.%d", i)
+
+		if pool.Name == "" {
+			errs.add(path+".name", "backend pool name is required")
+		} else if poolNames[pool.Name] {
+			errs.add(path+".name", "duplicate backend pool name: %s", pool.Name)
+		}
+		poolNames[pool.Name] = true
+
+		if len(pool.Backends) == 0 {
+			errs.add(path+".backends", "at least one backend is required in pool: %s", pool.Name)
+		}
+
+		backendURLs := make(map[string]bool)
+		for j, backend := range pool.Backends {
+			backendPath := fmt.Sprintf("%s.backends.%d.url", path, j)
+			if backend.URL == "" {
+				errs.add(backendPath, "backend URL is required in pool: %s", pool.Name)
+				continue
+			}
+			if backendURLs[backend.URL] {
+				errs.add(backendPath, "duplicate backend %s in pool: %s", backend.URL, pool.Name)
+			}
+			backendURLs[backend.URL] = true
+		}
+	}
+
+	// Validate routing rules
+	if len(config.RoutingRules) == 0 {
+		errs.add("routing_rules", "at least one routing rule is required")
+	}
+
+	ruleNames := make(map[string]bool)
+	for i, rule := range config.RoutingRules {
+		path := fmt.Sprintf("routing_rules.%d", i)
+
+		if rule.Name != "" {
+			if ruleNames[rule.Name] {
+				errs.add(path+".name", "duplicate routing rule name: %s", rule.Name)
+			}
+			ruleNames[rule.Name] = true
+		}
+
+		if rule.TargetPool == "" {
+			errs.add(path+".target_pool", "target pool is required in routing rule")
+		} else if !poolNames[rule.TargetPool] {
+			errs.add(path+".target_pool", "target pool does not exist: %s", rule.TargetPool)
+		}
+	}
+
+	return errs
+}
+
+// checkAdminConfig checks the admin API listener and its authentication
+func checkAdminConfig(server ServerConfig, errs *fieldErrors) {
+	if server.AdminAddress == "" {
+		errs.add("server.admin_address", "admin address is required when the admin API is enabled")
+	} else if server.AdminAddress == server.Address {
+		errs.add("server.admin_address", "admin address must differ from server address")
+	}
+
+	auth := server.AdminAuth
+	if len(auth.Tokens) == 0 && auth.ClientCA == "" {
+		errs.add("server.admin_auth", "admin API requires at least one token or a client CA")
+	}
+
+	operator := false
+	for i, token := range auth.Tokens {
+		path := fmt.Sprintf("server.admin_auth.tokens.%d", i)
+		if token.Token == "" {
+			errs.add(path+".token", "admin token must not be empty")
+		} else if strings.HasPrefix(token.Token, placeholderTokenPrefix) {
+			errs.add(path+".token", "admin token is still a placeholder; set a secret token")
+		}
+		if !isAdminRole(token.Role) {
+			errs.add(path+".role", "invalid admin role: %s", token.Role)
+		}
+		operator = operator || token.Role == "operator"
+	}
+
+	// Operator tokens sent in the clear could be replayed to rewrite routing
+	if operator && auth.TLSCert == "" && server.AdminAddress != "" && !isLoopback(server.AdminAddress) {
+		errs.add("server.admin_auth.tls_cert", "operator tokens require TLS when the admin API listens on %s; set tls_cert and tls_key or listen on loopback", server.AdminAddress)
+	}
+
+	if auth.ClientCA != "" && (auth.TLSCert == "" || auth.TLSKey == "") {
+		errs.add("server.admin_auth.client_ca", "admin client CA requires tls_cert and tls_key")
+	}
+	for name, role := range auth.ClientRoles {
+		if !isAdminRole(role) {
+			errs.add("server.admin_auth.client_roles."+name, "invalid admin role for client %s: %s", name, role)
+		}
+	}
+}
+
+// isLoopback reports whether address only accepts connections from the
+// local host
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isAdminRole reports whether role is a known admin API role
+func isAdminRole(role string) bool {
+	return role == "read_only" || role == "operator"
+}
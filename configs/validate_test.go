@@ -0,0 +1,87 @@
+package configs
+
+import (
+	"strings"
+	"testing"
+)
+
+// validConfig returns a config that passes Check
+func validConfig() *Config {
+	config := DefaultConfig()
+	config.BackendPools = []BackendPoolConfig{{
+		Name:     "web",
+		Backends: []BackendConfig{{URL: "http://10.0.0.1:8080"}},
+	}}
+	config.RoutingRules = []RoutingRuleConfig{{TargetPool: "web"}}
+	return config
+}
+
+func TestCheckAdminConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		tlsCert string
+		tokens  []AdminTokenConfig
+		wantErr string
+	}{
+		{name: "operator on loopback", address: "127.0.0.1:8081", tokens: []AdminTokenConfig{{Token: "s3cret", Role: "operator"}}},
+		{name: "operator on localhost", address: "localhost:8081", tokens: []AdminTokenConfig{{Token: "s3cret", Role: "operator"}}},
+		{name: "operator over TLS", address: ":8081", tlsCert: "admin.crt", tokens: []AdminTokenConfig{{Token: "s3cret", Role: "operator"}}},
+		{name: "read only over plain HTTP", address: ":8081", tokens: []AdminTokenConfig{{Token: "s3cret", Role: "read_only"}}},
+		{name: "operator over plain HTTP", address: ":8081", tokens: []AdminTokenConfig{{Token: "s3cret", Role: "operator"}}, wantErr: "server.admin_auth.tls_cert"},
+		{name: "placeholder token", address: "127.0.0.1:8081", tokens: []AdminTokenConfig{{Token: "change-me-operator", Role: "operator"}}, wantErr: "server.admin_auth.tokens.0.token"},
+		{name: "unknown role", address: "127.0.0.1:8081", tokens: []AdminTokenConfig{{Token: "s3cret", Role: "root"}}, wantErr: "server.admin_auth.tokens.0.role"},
+		{name: "no credentials", address: "127.0.0.1:8081", wantErr: "server.admin_auth"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig()
+			config.Server.AdminEnable = true
+			config.Server.AdminAddress = tt.address
+			config.Server.AdminAuth = AdminAuthConfig{Tokens: tt.tokens, TLSCert: tt.tlsCert, TLSKey: tt.tlsCert}
+
+			errs := Check(config)
+			if tt.wantErr == "" {
+				if len(errs) > 0 {
+					t.Fatalf("unexpected problems: %v", errs)
+				}
+				return
+			}
+			for _, err := range errs {
+				if err.Path == tt.wantErr {
+					return
+				}
+			}
+			t.Fatalf("no problem at %s in %v", tt.wantErr, errs)
+		})
+	}
+}
+
+func TestCheckReportsEveryProblem(t *testing.T) {
+	config := &Config{
+		BackendPools: []BackendPoolConfig{
+			{Name: "web", Backends: []BackendConfig{{URL: "http://10.0.0.1"}, {URL: "http://10.0.0.1"}}},
+			{Name: "web"},
+		},
+		RoutingRules: []RoutingRuleConfig{{TargetPool: "api"}, {}},
+		Server:       ServerConfig{TrustedProxies: []string{"10.0.0.0/8", "proxy"}},
+	}
+
+	var paths []string
+	for _, err := range Check(config) {
+		paths = append(paths, err.Path)
+	}
+	want := []string{
+		"server.address",
+		"server.trusted_proxies.1",
+		"backend_pools.0.backends.1.url",
+		"backend_pools.1.name",
+		"backend_pools.1.backends",
+		"routing_rules.0.target_pool",
+		"routing_rules.1.target_pool",
+	}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("problems at %v, want %v", paths, want)
+	}
+}
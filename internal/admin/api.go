@@ -2,25 +2,53 @@ package admin
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"sync"
 
+	"github.com/rixtrayker/go-loadbalancer/configs"
 	"github.com/rixtrayker/go-loadbalancer/internal/logging"
 	"github.com/rixtrayker/go-loadbalancer/internal/serverpool"
 )
 
+// ErrConfigChanged is returned by Manager.Update when the configuration
+// was replaced, e.g. by a reload, since the update was derived from it
+var ErrConfigChanged = errors.New("configuration changed concurrently")
+
+// maxUpdateAttempts bounds how often an update is derived again from a
+// configuration that changed under it
+const maxUpdateAttempts = 3
+
+// Manager gives the admin API access to the live load balancer state
+type Manager interface {
+	// Pools returns the backend pools currently serving traffic
+	Pools() map[string]*serverpool.Pool
+	// Config returns the configuration currently applied
+	Config() *configs.Config
+	// Update atomically applies a new configuration derived from base,
+	// provided base is still the configuration applied. Otherwise it
+	// returns ErrConfigChanged and leaves the current one in place.
+	Update(base, config *configs.Config) error
+	// PersistPath returns the config file changes are written back to, or
+	// an error if they cannot be persisted
+	PersistPath() (string, error)
+}
+
 // API handles admin API requests
 type API struct {
-	pools   map[string]*serverpool.Pool
+	manager Manager
 	logger  *logging.Logger
+	mutex   sync.Mutex
 }
 
-// NewAPI creates a new admin API
+// NewAPI creates a new admin API. Changes are written back to the config
+// file the manager names when a request asks for them to be persisted.
 func NewAPI(
-	pools map[string]*serverpool.Pool,
+	manager Manager,
 	logger *logging.Logger,
 ) *API {
 	return &API{
-		pools:   pools,
+		manager: manager,
 		logger:  logger,
 	}
 }
@@ -30,13 +58,27 @@ func (a *API) RegisterHandlers(mux *http.ServeMux, basePath string) {
 	mux.HandleFunc(basePath+"/status", a.handleStatus)
 	mux.HandleFunc(basePath+"/backends", a.handleBackends)
 	mux.HandleFunc(basePath+"/metrics", a.handleMetrics)
+
+	// Runtime configuration
+	mux.HandleFunc("GET "+basePath+"/pools", a.handleListPools)
+	mux.HandleFunc("POST "+basePath+"/pools", a.handleCreatePool)
+	mux.HandleFunc("GET "+basePath+"/pools/{pool}", a.handleGetPool)
+	mux.HandleFunc("PUT "+basePath+"/pools/{pool}", a.handleUpdatePool)
+	mux.HandleFunc("DELETE "+basePath+"/pools/{pool}", a.handleDeletePool)
+	mux.HandleFunc("POST "+basePath+"/pools/{pool}/backends", a.handleCreateBackend)
+	mux.HandleFunc("PUT "+basePath+"/pools/{pool}/backends", a.handleUpdateBackend)
+	mux.HandleFunc("DELETE "+basePath+"/pools/{pool}/backends", a.handleDeleteBackend)
+	mux.HandleFunc("GET "+basePath+"/rules", a.handleListRules)
+	mux.HandleFunc("POST "+basePath+"/rules", a.handleCreateRule)
+	mux.HandleFunc("PUT "+basePath+"/rules/{rule}", a.handleUpdateRule)
+	mux.HandleFunc("DELETE "+basePath+"/rules/{rule}", a.handleDeleteRule)
 }
 
 // handleStatus handles status requests
 func (a *API) handleStatus(w http.ResponseWriter, r *http.Request) {
 	status := map[string]interface{}{
 		"status": "ok",
-		"pools":  len(a.pools),
+		"pools":  len(a.manager.Pools()),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -50,15 +92,21 @@ func (a *API) handleBackends(w http.ResponseWriter, r *http.Request) {
 		// List backends
 		result := make(map[string][]map[string]interface{})
 
-		for name, pool := range a.pools {
+		for name, pool := range a.manager.Pools() {
 			backends := make([]map[string]interface{}, 0, len(pool.Backends))
 			for _, b := range pool.Backends {
 				backends = append(backends, map[string]interface{}{
-					"url":            b.URL.String(),
-					"healthy":        b.IsHealthy(),
-					"active_conns":   b.GetActiveConnections(),
-					"total_requests": b.GetTotalRequests(),
-					"weight":         b.Weight,
+					"url":             b.URL.String(),
+					"healthy":         b.IsHealthy(),
+					"circuit":         b.Breaker().State().String(),
+					"active_conns":    b.GetActiveConnections(),
+					"max_connections": b.GetMaxConnections(),
+					"total_requests":  b.GetTotalRequests(),
+					"weight":          b.GetWeight(),
+					"priority":        b.GetPriority(),
+					"backup":          b.IsBackup(),
+					"warming":         b.IsWarming(),
+					"weight_factor":   b.SlowStartFactor(),
 				})
 			}
 			result[name] = backends
@@ -80,7 +128,7 @@ func (a *API) handleBackends(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		pool, ok := a.pools[req.Pool]
+		pool, ok := a.manager.Pools()[req.Pool]
 		if !ok {
 			http.Error(w, "Pool not found", http.StatusNotFound)
 			return
@@ -94,36 +142,30 @@ func (a *API) handleBackends(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleMetrics handles metrics requests
+// handleMetrics handles metrics requests with per-pool traffic totals.
+// Prometheus metrics are served separately by the metrics server.
 func (a *API) handleMetrics(w http.ResponseWriter, r *http.Request) {
-	// This would typically use Prometheus HTTP handler
-	// For now, just return a simple status
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status": "metrics available at /metrics endpoint",
-	})
-}
-
-// StatusHandler handles status requests
-func StatusHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status": "ok",
-	})
-}
+	result := make(map[string]map[string]interface{})
+
+	for name, pool := range a.manager.Pools() {
+		var healthy, activeConns int
+		var totalRequests int64
+		for _, b := range pool.Backends {
+			if b.IsHealthy() {
+				healthy++
+			}
+			activeConns += b.GetActiveConnections()
+			totalRequests += b.GetTotalRequests()
+		}
 
-// BackendsHandler handles backend management requests
-func BackendsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status": "ok",
-	})
-}
+		result[name] = map[string]interface{}{
+			"backends":         len(pool.Backends),
+			"healthy_backends": healthy,
+			"active_conns":     activeConns,
+			"total_requests":   totalRequests,
+		}
+	}
 
-// MetricsHandler handles metrics requests
-func MetricsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status": "ok",
-	})
+	json.NewEncoder(w).Encode(result)
 }
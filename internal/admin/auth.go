@@ -0,0 +1,112 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/logging"
+)
+
+// Role is the access level granted to an admin API client
+type Role string
+
+const (
+	// RoleReadOnly may only read state
+	RoleReadOnly Role = "read_only"
+	// RoleOperator may read and change state
+	RoleOperator Role = "operator"
+)
+
+// allows reports whether the role may perform a request with the given method
+func (r Role) allows(method string) bool {
+	switch r {
+	case RoleOperator:
+		return true
+	case RoleReadOnly:
+		return method == http.MethodGet || method == http.MethodHead
+	default:
+		return false
+	}
+}
+
+// token is a bearer token with its role
+type token struct {
+	value []byte
+	role  Role
+}
+
+// Authenticator authenticates admin API clients by bearer token or TLS
+// client certificate
+type Authenticator struct {
+	tokens      []token
+	clientRoles map[string]Role
+	logger      *logging.Logger
+}
+
+// NewAuthenticator creates a new authenticator
+func NewAuthenticator(config configs.AdminAuthConfig, logger *logging.Logger) *Authenticator {
+	a := &Authenticator{
+		tokens:      make([]token, 0, len(config.Tokens)),
+		clientRoles: make(map[string]Role, len(config.ClientRoles)),
+		logger:      logger,
+	}
+
+	for _, t := range config.Tokens {
+		a.tokens = append(a.tokens, token{value: []byte(t.Token), role: Role(t.Role)})
+	}
+	for name, role := range config.ClientRoles {
+		a.clientRoles[name] = Role(role)
+	}
+
+	return a
+}
+
+// Middleware rejects unauthenticated requests with 401 and requests the
+// client's role does not permit with 403
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, ok := a.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !role.allows(r.Method) {
+			a.logger.Warn("Admin request forbidden", "role", role, "method", r.Method, "path", r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate resolves the role of the client making the request
+func (a *Authenticator) authenticate(r *http.Request) (Role, bool) {
+	// Verified client certificates take precedence
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		if role, ok := a.clientRoles[name]; ok {
+			return role, true
+		}
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", false
+	}
+	presented := []byte(strings.TrimPrefix(auth, "Bearer "))
+
+	// Compare against every token in constant time
+	var role Role
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(presented, t.value) == 1 {
+			role = t.role
+		}
+	}
+
+	return role, role != ""
+}
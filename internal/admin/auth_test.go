@@ -0,0 +1,72 @@
+package admin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/logging"
+)
+
+func TestAuthenticatorRoles(t *testing.T) {
+	auth := NewAuthenticator(configs.AdminAuthConfig{
+		Tokens: []configs.AdminTokenConfig{
+			{Token: "reader-token", Role: string(RoleReadOnly)},
+			{Token: "operator-token", Role: string(RoleOperator)},
+			{Token: "unknown-role-token", Role: "admin"},
+		},
+		ClientRoles: map[string]string{"deployer": string(RoleOperator)},
+	}, logging.NewLogger())
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		header string
+		client string // common name of a verified client certificate
+		want   int
+	}{
+		{name: "no token", method: "GET", want: http.StatusUnauthorized},
+		{name: "unknown token", method: "GET", header: "Bearer guess", want: http.StatusUnauthorized},
+		{name: "not a bearer token", method: "GET", header: "Basic reader-token", want: http.StatusUnauthorized},
+		{name: "token prefix", method: "GET", header: "Bearer reader", want: http.StatusUnauthorized},
+		{name: "read only reads", method: "GET", header: "Bearer reader-token", want: http.StatusNoContent},
+		{name: "read only heads", method: "HEAD", header: "Bearer reader-token", want: http.StatusNoContent},
+		{name: "read only writes", method: "POST", header: "Bearer reader-token", want: http.StatusForbidden},
+		{name: "read only deletes", method: "DELETE", header: "Bearer reader-token", want: http.StatusForbidden},
+		{name: "operator writes", method: "PUT", header: "Bearer operator-token", want: http.StatusNoContent},
+		{name: "operator deletes", method: "DELETE", header: "Bearer operator-token", want: http.StatusNoContent},
+		{name: "unknown role", method: "GET", header: "Bearer unknown-role-token", want: http.StatusForbidden},
+		{name: "client certificate", method: "POST", client: "deployer", want: http.StatusNoContent},
+		{name: "unknown client certificate", method: "GET", client: "intruder", want: http.StatusUnauthorized},
+		{name: "unknown client certificate with token", method: "GET", client: "intruder", header: "Bearer reader-token", want: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/admin/v1/pools", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.client != "" {
+				cert := &x509.Certificate{Subject: pkix.Name{CommonName: tt.client}}
+				r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
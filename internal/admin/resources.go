@@ -0,0 +1,447 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/validation"
+	"gopkg.in/yaml.v2"
+)
+
+// maxBodySize caps the size of admin request bodies
+const maxBodySize = 1 << 20
+
+// apiError is an error with the HTTP status it should be reported with
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func notFound(format string, args ...interface{}) error {
+	return &apiError{status: http.StatusNotFound, message: fmt.Sprintf(format, args...)}
+}
+
+func conflict(format string, args ...interface{}) error {
+	return &apiError{status: http.StatusConflict, message: fmt.Sprintf(format, args...)}
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &apiError{status: http.StatusBadRequest, message: fmt.Sprintf(format, args...)}
+}
+
+// handleListPools lists the configured backend pools
+func (a *API) handleListPools(w http.ResponseWriter, r *http.Request) {
+	pools := a.manager.Config().BackendPools
+	redacted := make([]configs.BackendPoolConfig, len(pools))
+	for i, pool := range pools {
+		redacted[i] = redactPool(pool)
+	}
+	writeConfigJSON(w, http.StatusOK, redacted)
+}
+
+// handleGetPool returns a single backend pool
+func (a *API) handleGetPool(w http.ResponseWriter, r *http.Request) {
+	config := a.manager.Config()
+	i := findPool(config, r.PathValue("pool"))
+	if i < 0 {
+		writeError(w, notFound("pool not found: %s", r.PathValue("pool")))
+		return
+	}
+	writeConfigJSON(w, http.StatusOK, redactPool(config.BackendPools[i]))
+}
+
+// handleCreatePool adds a backend pool
+func (a *API) handleCreatePool(w http.ResponseWriter, r *http.Request) {
+	var pool configs.BackendPoolConfig
+	if err := decodeBody(r, &pool); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	a.update(w, r, http.StatusCreated, redactPool(pool), func(config *configs.Config) error {
+		if findPool(config, pool.Name) >= 0 {
+			return conflict("pool already exists: %s", pool.Name)
+		}
+		config.BackendPools = append(config.BackendPools, pool)
+		return nil
+	})
+}
+
+// handleUpdatePool replaces a backend pool
+func (a *API) handleUpdatePool(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("pool")
+
+	var pool configs.BackendPoolConfig
+	if err := decodeBody(r, &pool); err != nil {
+		writeError(w, err)
+		return
+	}
+	if pool.Name != "" && pool.Name != name {
+		writeError(w, badRequest("pool name cannot be changed"))
+		return
+	}
+	pool.Name = name
+
+	a.update(w, r, http.StatusOK, redactPool(pool), func(config *configs.Config) error {
+		i := findPool(config, name)
+		if i < 0 {
+			return notFound("pool not found: %s", name)
+		}
+		// Pools are read without their secret, so a pool written back
+		// unchanged keeps the current one
+		if pool.StickySession.Secret == "" {
+			pool.StickySession.Secret = config.BackendPools[i].StickySession.Secret
+		}
+		config.BackendPools[i] = pool
+		return nil
+	})
+}
+
+// handleDeletePool removes a backend pool that no rule routes to
+func (a *API) handleDeletePool(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("pool")
+
+	a.update(w, r, http.StatusNoContent, nil, func(config *configs.Config) error {
+		i := findPool(config, name)
+		if i < 0 {
+			return notFound("pool not found: %s", name)
+		}
+		for _, rule := range config.RoutingRules {
+			if rule.TargetPool == name {
+				return conflict("pool %s is the target of a routing rule", name)
+			}
+		}
+		config.BackendPools = append(config.BackendPools[:i], config.BackendPools[i+1:]...)
+		return nil
+	})
+}
+
+// handleCreateBackend adds a backend to a pool
+func (a *API) handleCreateBackend(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("pool")
+
+	var b configs.BackendConfig
+	if err := decodeBody(r, &b); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	a.update(w, r, http.StatusCreated, b, func(config *configs.Config) error {
+		i := findPool(config, name)
+		if i < 0 {
+			return notFound("pool not found: %s", name)
+		}
+		if findBackend(config.BackendPools[i], b.URL) >= 0 {
+			return conflict("backend already exists: %s", b.URL)
+		}
+		config.BackendPools[i].Backends = append(config.BackendPools[i].Backends, b)
+		return nil
+	})
+}
+
+// handleUpdateBackend replaces the backend identified by the url query
+// parameter
+func (a *API) handleUpdateBackend(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("pool")
+	url := r.URL.Query().Get("url")
+
+	var b configs.BackendConfig
+	if err := decodeBody(r, &b); err != nil {
+		writeError(w, err)
+		return
+	}
+	if b.URL == "" {
+		b.URL = url
+	}
+
+	a.update(w, r, http.StatusOK, b, func(config *configs.Config) error {
+		i := findPool(config, name)
+		if i < 0 {
+			return notFound("pool not found: %s", name)
+		}
+		j := findBackend(config.BackendPools[i], url)
+		if j < 0 {
+			return notFound("backend not found: %s", url)
+		}
+		config.BackendPools[i].Backends[j] = b
+		return nil
+	})
+}
+
+// handleDeleteBackend removes the backend identified by the url query
+// parameter
+func (a *API) handleDeleteBackend(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("pool")
+	url := r.URL.Query().Get("url")
+
+	a.update(w, r, http.StatusNoContent, nil, func(config *configs.Config) error {
+		i := findPool(config, name)
+		if i < 0 {
+			return notFound("pool not found: %s", name)
+		}
+		j := findBackend(config.BackendPools[i], url)
+		if j < 0 {
+			return notFound("backend not found: %s", url)
+		}
+		backends := config.BackendPools[i].Backends
+		config.BackendPools[i].Backends = append(backends[:j], backends[j+1:]...)
+		return nil
+	})
+}
+
+// handleListRules lists the routing rules in evaluation order: by
+// descending priority, and in configuration order within a priority, as
+// routing.Router sorts them
+func (a *API) handleListRules(w http.ResponseWriter, r *http.Request) {
+	rules := append([]configs.RoutingRuleConfig(nil), a.manager.Config().RoutingRules...)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Priority > rules[j].Priority
+	})
+	writeConfigJSON(w, http.StatusOK, rules)
+}
+
+// handleCreateRule appends a routing rule. Rules created through the API
+// must be named so they can be addressed later.
+func (a *API) handleCreateRule(w http.ResponseWriter, r *http.Request) {
+	var rule configs.RoutingRuleConfig
+	if err := decodeBody(r, &rule); err != nil {
+		writeError(w, err)
+		return
+	}
+	if rule.Name == "" {
+		writeError(w, badRequest("rule name is required"))
+		return
+	}
+
+	a.update(w, r, http.StatusCreated, rule, func(config *configs.Config) error {
+		if findRule(config, rule.Name) >= 0 {
+			return conflict("rule already exists: %s", rule.Name)
+		}
+		config.RoutingRules = append(config.RoutingRules, rule)
+		return nil
+	})
+}
+
+// handleUpdateRule replaces a routing rule in place
+func (a *API) handleUpdateRule(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("rule")
+
+	var rule configs.RoutingRuleConfig
+	if err := decodeBody(r, &rule); err != nil {
+		writeError(w, err)
+		return
+	}
+	if rule.Name != "" && rule.Name != name {
+		writeError(w, badRequest("rule name cannot be changed"))
+		return
+	}
+	rule.Name = name
+
+	a.update(w, r, http.StatusOK, rule, func(config *configs.Config) error {
+		i := findRule(config, name)
+		if i < 0 {
+			return notFound("rule not found: %s", name)
+		}
+		config.RoutingRules[i] = rule
+		return nil
+	})
+}
+
+// handleDeleteRule removes a routing rule
+func (a *API) handleDeleteRule(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("rule")
+
+	a.update(w, r, http.StatusNoContent, nil, func(config *configs.Config) error {
+		i := findRule(config, name)
+		if i < 0 {
+			return notFound("rule not found: %s", name)
+		}
+		config.RoutingRules = append(config.RoutingRules[:i], config.RoutingRules[i+1:]...)
+		return nil
+	})
+}
+
+// update applies change to a copy of the live configuration, validates it
+// and applies it atomically. With ?persist=true the pools and rules are also
+// written back to the config file, which is refused when the file is not
+// their only source. Updates are serialized so concurrent requests do not
+// overwrite each other. A reload that replaces the configuration in the
+// meantime is not overwritten either: the change is made again on top of
+// the reloaded configuration.
+func (a *API) update(w http.ResponseWriter, r *http.Request, status int, result interface{}, change func(config *configs.Config) error) {
+	var persistPath string
+	if r.URL.Query().Get("persist") == "true" {
+		path, err := a.manager.PersistPath()
+		if err != nil {
+			writeError(w, conflict("cannot persist: %v", err))
+			return
+		}
+		persistPath = path
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var config *configs.Config
+	for attempt := 1; ; attempt++ {
+		base := a.manager.Config()
+		config = base.Clone()
+		if err := change(config); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if problems := validation.Validate(config); len(problems) > 0 {
+			messages := make([]string, len(problems))
+			for i, problem := range problems {
+				messages[i] = problem.Error()
+			}
+			writeError(w, badRequest("invalid configuration: %s", strings.Join(messages, "; ")))
+			return
+		}
+
+		err := a.manager.Update(base, config)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrConfigChanged) {
+			writeError(w, badRequest("failed to apply configuration: %v", err))
+			return
+		}
+		if attempt == maxUpdateAttempts {
+			writeError(w, conflict("configuration kept changing, try again"))
+			return
+		}
+	}
+	a.logger.Info("Applied configuration change", "method", r.Method, "path", r.URL.Path)
+
+	if persistPath != "" {
+		if err := configs.SaveRouting(persistPath, config); err != nil {
+			a.logger.Error("Failed to persist configuration", "path", persistPath, "error", err)
+			writeError(w, &apiError{
+				status:  http.StatusInternalServerError,
+				message: "change applied but not persisted: " + err.Error(),
+			})
+			return
+		}
+		a.logger.Info("Persisted configuration", "path", persistPath)
+	}
+
+	if result == nil {
+		w.WriteHeader(status)
+		return
+	}
+	writeConfigJSON(w, status, result)
+}
+
+// redactPool hides the sticky session secret, with which clients could
+// forge sessions for any backend
+func redactPool(pool configs.BackendPoolConfig) configs.BackendPoolConfig {
+	pool.StickySession.Secret = ""
+	return pool
+}
+
+// findPool returns the index of the named pool or -1
+func findPool(config *configs.Config, name string) int {
+	for i, pool := range config.BackendPools {
+		if pool.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// findBackend returns the index of the backend with the given URL or -1
+func findBackend(pool configs.BackendPoolConfig, url string) int {
+	for i, b := range pool.Backends {
+		if b.URL == url {
+			return i
+		}
+	}
+	return -1
+}
+
+// findRule returns the index of the named rule or -1
+func findRule(config *configs.Config, name string) int {
+	for i, rule := range config.RoutingRules {
+		if rule.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// decodeBody decodes a JSON request body into a config struct. JSON is
+// parsed as YAML so field names and durations follow the config file format.
+func decodeBody(r *http.Request, v interface{}) error {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		return badRequest("failed to read request body: %v", err)
+	}
+	if err := yaml.UnmarshalStrict(data, v); err != nil {
+		return badRequest("invalid request body: %v", err)
+	}
+	return nil
+}
+
+// writeConfigJSON writes config structs as JSON using their config file
+// field names
+func writeConfigJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var generic interface{}
+	if err := yaml.Unmarshal(data, &generic); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(jsonCompatible(generic))
+}
+
+// jsonCompatible converts the map[interface{}]interface{} values produced
+// by yaml into types encoding/json accepts
+func jsonCompatible(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[fmt.Sprint(k)] = jsonCompatible(item)
+		}
+		return out
+	case []interface{}:
+		for i, item := range val {
+			val[i] = jsonCompatible(item)
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+// writeError writes an error as a JSON body
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if apiErr, ok := err.(*apiError); ok {
+		status = apiErr.status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,149 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/logging"
+	"github.com/rixtrayker/go-loadbalancer/internal/serverpool"
+)
+
+// fakeManager holds a configuration without serving it. beforeUpdate, if
+// set, runs before every Update, e.g. to simulate a concurrent reload.
+type fakeManager struct {
+	mutex        sync.Mutex
+	config       *configs.Config
+	updates      int
+	beforeUpdate func(m *fakeManager)
+}
+
+func (m *fakeManager) Pools() map[string]*serverpool.Pool { return nil }
+
+func (m *fakeManager) Config() *configs.Config {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.config
+}
+
+func (m *fakeManager) Update(base, config *configs.Config) error {
+	if m.beforeUpdate != nil {
+		m.beforeUpdate(m)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.updates++
+	if m.config != base {
+		return ErrConfigChanged
+	}
+	m.config = config
+	return nil
+}
+
+func (m *fakeManager) PersistPath() (string, error) { return "", nil }
+
+// reload replaces the configuration with a copy that has pool added
+func (m *fakeManager) reload(pool string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	config := m.config.Clone()
+	config.BackendPools = append(config.BackendPools, configs.BackendPoolConfig{
+		Name:     pool,
+		Backends: []configs.BackendConfig{{URL: "http://10.0.1.1:8080"}},
+	})
+	m.config = config
+}
+
+func newTestManager() *fakeManager {
+	config := configs.DefaultConfig()
+	config.BackendPools = []configs.BackendPoolConfig{{
+		Name:     "web",
+		Backends: []configs.BackendConfig{{URL: "http://10.0.0.1:8080"}},
+	}}
+	config.RoutingRules = []configs.RoutingRuleConfig{
+		{Name: "low", TargetPool: "web", Match: configs.MatchConfig{Path: "/low"}},
+		{Name: "high", TargetPool: "web", Priority: 10, Match: configs.MatchConfig{Path: "/high"}},
+		{Name: "default", TargetPool: "web", Match: configs.MatchConfig{Path: "/default"}},
+	}
+	return &fakeManager{config: config}
+}
+
+func serve(api *API, method, path, body string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	api.RegisterHandlers(mux, "/admin/v1")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+func TestUpdateIsNotLostToConcurrentReload(t *testing.T) {
+	manager := newTestManager()
+	reloaded := false
+	manager.beforeUpdate = func(m *fakeManager) {
+		if !reloaded {
+			reloaded = true
+			m.reload("reloaded")
+		}
+	}
+	api := NewAPI(manager, logging.NewLogger())
+
+	w := serve(api, "POST", "/admin/v1/rules", `{"name": "new", "target_pool": "web", "match": {"path": "/new"}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	config := manager.Config()
+	if findPool(config, "reloaded") < 0 {
+		t.Error("admin change undid the reload")
+	}
+	if findRule(config, "new") < 0 {
+		t.Error("admin change was lost")
+	}
+	if manager.updates != 2 {
+		t.Errorf("%d updates, want 2", manager.updates)
+	}
+}
+
+func TestUpdateGivesUpWhenConfigKeepsChanging(t *testing.T) {
+	manager := newTestManager()
+	manager.beforeUpdate = func(m *fakeManager) {
+		m.reload(fmt.Sprintf("reloaded-%d", m.updates))
+	}
+	api := NewAPI(manager, logging.NewLogger())
+
+	w := serve(api, "DELETE", "/admin/v1/rules/low", "")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusConflict)
+	}
+	if findRule(manager.Config(), "low") < 0 {
+		t.Error("rule deleted despite the conflict")
+	}
+}
+
+func TestListRulesInEvaluationOrder(t *testing.T) {
+	api := NewAPI(newTestManager(), logging.NewLogger())
+
+	w := serve(api, "GET", "/admin/v1/rules", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var rules []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &rules); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+	}
+	if got := strings.Join(names, ","); got != "high,low,default" {
+		t.Errorf("rules listed as %s, want high,low,default", got)
+	}
+}
@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/logging"
+)
+
+// Server serves the admin API on its own listener
+type Server struct {
+	server *http.Server
+	auth   configs.AdminAuthConfig
+	logger *logging.Logger
+}
+
+// NewServer creates a new admin server. Requests are authenticated before
+// they reach handler.
+func NewServer(config configs.ServerConfig, handler http.Handler, logger *logging.Logger) (*Server, error) {
+	auth := config.AdminAuth
+
+	server := &http.Server{
+		Addr:    config.AdminAddress,
+		Handler: NewAuthenticator(auth, logger).Middleware(handler),
+	}
+
+	// Ask for client certificates when mTLS is configured. Certificates are
+	// optional at the TLS layer so that bearer tokens keep working.
+	if auth.ClientCA != "" {
+		pem, err := os.ReadFile(auth.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read admin client CA: %w", err)
+		}
+
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in admin client CA: %s", auth.ClientCA)
+		}
+
+		server.TLSConfig = &tls.Config{
+			ClientCAs:  clientCAs,
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	return &Server{
+		server: server,
+		auth:   auth,
+		logger: logger,
+	}, nil
+}
+
+// Start starts the admin server
+func (s *Server) Start() {
+	go func() {
+		var err error
+		if s.auth.TLSCert != "" {
+			s.logger.Info("Starting admin API server with TLS", "addr", s.server.Addr)
+			err = s.server.ListenAndServeTLS(s.auth.TLSCert, s.auth.TLSKey)
+		} else {
+			s.logger.Info("Starting admin API server", "addr", s.server.Addr)
+			err = s.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			s.logger.Error("Admin server error", "error", err)
+		}
+	}()
+}
+
+// Stop stops the admin server
+func (s *Server) Stop(ctx context.Context) error {
+	s.logger.Info("Stopping admin API server")
+	return s.server.Shutdown(ctx)
+}
@@ -2,33 +2,49 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	v1 "github.com/rixtrayker/go-loadbalancer/api/http/v1"
 	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/admin"
 	httpHandler "github.com/rixtrayker/go-loadbalancer/internal/handler/http"
+	"github.com/rixtrayker/go-loadbalancer/internal/healthcheck"
 	"github.com/rixtrayker/go-loadbalancer/internal/logging"
 	"github.com/rixtrayker/go-loadbalancer/internal/middleware"
 	"github.com/rixtrayker/go-loadbalancer/internal/monitoring"
+	"github.com/rixtrayker/go-loadbalancer/internal/serverpool"
 	"github.com/rixtrayker/go-loadbalancer/internal/tracing"
+	"github.com/rixtrayker/go-loadbalancer/internal/validation"
 )
 
 // App represents the load balancer application
 type App struct {
-	config     *configs.Config
-	httpServer *http.Server
-	logger     *logging.Logger
-	metrics    *monitoring.MetricsCollector
-	tracer     *tracing.Tracer
+	config        *configs.Config
+	loader        *configs.Loader
+	handler       *httpHandler.Handler
+	httpServer    *http.Server
+	adminServer   *admin.Server
+	healthChecker *healthcheck.HealthChecker
+	logger        *logging.Logger
+	metrics       *monitoring.MetricsCollector
+	tracer        *tracing.Tracer
+	mutex         sync.Mutex
+	reloadMutex   sync.Mutex
 }
 
-// New creates a new application instance
-func New(configPath string) (*App, error) {
+// New creates a new application instance from the configuration built by
+// loader. The loader is kept so reloads read the same sources.
+func New(loader *configs.Loader) (*App, error) {
 	// Load configuration
-	config, err := configs.LoadConfig(configPath)
+	config, err := load(loader)
 	if err != nil {
 		return nil, err
 	}
@@ -38,6 +54,12 @@ func New(configPath string) (*App, error) {
 	if err := logger.Configure(config.Monitoring.Logging); err != nil {
 		return nil, err
 	}
+	for _, origin := range loader.Origins() {
+		logger.Debug("Configuration value", "key", origin.Path, "value", origin.Value, "source", origin.Source)
+	}
+	for _, unknown := range loader.Unknown() {
+		logger.Warn("Ignoring unknown configuration key", "key", unknown.Path, "location", loader.Locate(unknown.Path))
+	}
 
 	// Initialize metrics collector
 	metricsCollector := monitoring.NewMetricsCollector(logger)
@@ -59,13 +81,18 @@ func New(configPath string) (*App, error) {
 	// Create the application
 	app := &App{
 		config:  config,
+		loader:  loader,
 		logger:  logger,
 		metrics: metricsCollector,
 		tracer:  tracer,
 	}
 
 	// Setup HTTP server with monitoring middleware
-	var handler http.Handler = httpHandler.NewHandler(config, logger)
+	app.handler, err = httpHandler.NewHandler(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	var handler http.Handler = app.handler
 	if config.Monitoring.Prometheus.Enabled {
 		handler = middleware.MonitoringMiddleware(handler)
 	}
@@ -78,31 +105,107 @@ func New(configPath string) (*App, error) {
 		Handler: handler,
 	}
 
+	// Setup active health checking for every pool and feed it the outcome
+	// of proxied requests for outlier detection
+	app.healthChecker = healthcheck.NewHealthChecker(app.handler.Pools(), healthConfigs(config), logger)
+	app.handler.SetObserver(app.healthChecker)
+
+	// Setup admin API on its own listener
+	if config.Server.AdminEnable {
+		adminMux := http.NewServeMux()
+		v1.RegisterAdminAPI(adminMux, admin.NewAPI(app, logger), config.Server.AdminPath)
+
+		app.adminServer, err = admin.NewServer(config.Server, adminMux, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return app, nil
 }
 
+// load loads the configuration and checks it with the same rules as the
+// validate command and the admin API
+func load(loader *configs.Loader) (*configs.Config, error) {
+	config, err := loader.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	problems := validation.Validate(config)
+	if len(problems) == 0 {
+		return config, nil
+	}
+	messages := make([]string, len(problems))
+	for i, problem := range problems {
+		messages[i] = problem.Error()
+		if location := loader.Locate(problem.Path); location != "" {
+			messages[i] = location + ": " + messages[i]
+		}
+	}
+	return nil, fmt.Errorf("invalid configuration: %s", strings.Join(messages, "; "))
+}
+
 // Run starts the application
 func (a *App) Run() error {
-	// Setup signal handling for graceful shutdown
+	// Setup signal handling for graceful shutdown and reloads
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	defer cancelRun()
+
+	// Start health checking
+	a.healthChecker.Start(context.Background())
+
+	// Watch the config files for changes
+	if a.config.Server.WatchConfig {
+		if err := a.watchConfig(runCtx); err != nil {
+			a.logger.Error("Failed to watch configuration files", "error", err)
+		}
+	}
+
+	// Start admin API server
+	if a.adminServer != nil {
+		a.adminServer.Start()
+	}
 
 	// Start HTTP server
 	go func() {
-		a.logger.Info("Starting HTTP server on " + a.config.Server.Address)
+		a.logger.Info("Starting HTTP server on " + a.httpServer.Addr)
 		if err := a.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			a.logger.Error("HTTP server error", "error", err)
 		}
 	}()
 
-	// Wait for shutdown signal
-	<-stop
+	// Reload on SIGHUP until a shutdown signal arrives
+	for waiting := true; waiting; {
+		select {
+		case <-reload:
+			a.Reload()
+		case <-stop:
+			waiting = false
+		}
+	}
 	a.logger.Info("Shutting down server...")
+	cancelRun()
 
 	// Create shutdown context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Stop health checking
+	a.healthChecker.Stop()
+
+	// Shutdown admin API server
+	if a.adminServer != nil {
+		if err := a.adminServer.Stop(ctx); err != nil {
+			a.logger.Error("Admin server forced to shutdown", "error", err)
+		}
+	}
+
 	// Shutdown HTTP server
 	if err := a.httpServer.Shutdown(ctx); err != nil {
 		a.logger.Error("Server forced to shutdown", "error", err)
@@ -112,3 +215,74 @@ func (a *App) Run() error {
 	a.logger.Info("Server gracefully stopped")
 	return nil
 }
+
+// Pools returns the backend pools currently serving traffic
+func (a *App) Pools() map[string]*serverpool.Pool {
+	return a.handler.Pools()
+}
+
+// Config returns the configuration currently applied
+func (a *App) Config() *configs.Config {
+	return a.handler.Config()
+}
+
+// Apply atomically swaps in a new pool and routing configuration and
+// updates health checking for the new set of backends
+func (a *App) Apply(config *configs.Config) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.apply(config)
+}
+
+// Update applies config like Apply, provided the configuration currently
+// applied is still base, the one config was derived from. Reloads and
+// admin changes are applied under the same lock, so neither silently
+// undoes the other.
+func (a *App) Update(base, config *configs.Config) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.handler.Config() != base {
+		return admin.ErrConfigChanged
+	}
+	return a.apply(config)
+}
+
+// apply swaps in config. The caller must hold a.mutex.
+func (a *App) apply(config *configs.Config) error {
+	if err := a.handler.Apply(config); err != nil {
+		return err
+	}
+	a.config = config
+	a.healthChecker.Update(a.handler.Pools(), healthConfigs(config))
+	return nil
+}
+
+// PersistPath returns the config file admin changes are written back to:
+// the last one, which takes precedence over the ones before it. Changes
+// are not persisted when the pools and rules were not all loaded from that
+// file, since writing them would copy defaults, environment variables or
+// flags into it.
+func (a *App) PersistPath() (string, error) {
+	a.reloadMutex.Lock()
+	defer a.reloadMutex.Unlock()
+
+	files := a.loader.Files()
+	if len(files) == 0 {
+		return "", errors.New("no config file to persist to")
+	}
+	path := files[len(files)-1]
+	if err := a.loader.Persistable(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// healthConfigs returns the health check config of every pool in config
+func healthConfigs(config *configs.Config) map[string]configs.HealthCheckConfig {
+	healthConfigs := make(map[string]configs.HealthCheckConfig, len(config.BackendPools))
+	for _, pool := range config.BackendPools {
+		healthConfigs[pool.Name] = pool.HealthCheck
+	}
+	return healthConfigs
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/admin"
+)
+
+func TestAdminChangeKeepsHealthState(t *testing.T) {
+	// Count the health probes the backends receive
+	var probes atomic.Int32
+	backends := make([]*httptest.Server, 3)
+	for i := range backends {
+		backends[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/health" {
+				probes.Add(1)
+			}
+		}))
+		defer backends[i].Close()
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	config := fmt.Sprintf(`
+backend_pools:
+  - name: web
+    backends:
+      - url: %s
+      - url: %s
+    health_check:
+      path: /health
+      interval: 1h
+      outlier_detection:
+        consecutive_5xx: 3
+        max_ejection_percent: 100
+routing_rules:
+  - target_pool: web
+    match:
+      path: /*
+`, backends[0].URL, backends[1].URL)
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := New(configs.NewLoader([]string{path}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.healthChecker.Start(context.Background())
+	defer a.healthChecker.Stop()
+	waitForProbes(t, &probes, 2)
+
+	// Take one backend down and get the other close to an ejection
+	pool := a.Pools()["web"]
+	down, failing := pool.Backends[1], pool.Backends[0]
+	down.SetHealth(false)
+	for i := 0; i < 2; i++ {
+		a.healthChecker.Observe("web", failing, http.StatusInternalServerError, nil, time.Millisecond)
+	}
+
+	mux := http.NewServeMux()
+	admin.NewAPI(a, a.logger).RegisterHandlers(mux, "/admin/v1")
+	w := httptest.NewRecorder()
+	body := fmt.Sprintf(`{"url": %q}`, backends[2].URL)
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/admin/v1/pools/web/backends", strings.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	// Only the added backend is probed; the others keep their state
+	waitForProbes(t, &probes, 3)
+	time.Sleep(50 * time.Millisecond)
+	if n := probes.Load(); n != 3 {
+		t.Errorf("%d probes after the change, want 3", n)
+	}
+	if down.IsHealthy() {
+		t.Error("unhealthy backend became healthy")
+	}
+	a.healthChecker.Observe("web", failing, http.StatusInternalServerError, nil, time.Millisecond)
+	if !failing.IsEjected() {
+		t.Error("5xx responses from before the change were forgotten")
+	}
+}
+
+// waitForProbes waits until probes reaches n
+func waitForProbes(t *testing.T, probes *atomic.Int32, n int32) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for probes.Load() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d probes, want %d", probes.Load(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
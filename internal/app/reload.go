@@ -0,0 +1,199 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rixtrayker/go-loadbalancer/configs"
+)
+
+// reloadDebounce coalesces the bursts of events editors produce when saving
+const reloadDebounce = 500 * time.Millisecond
+
+// restartSections are config sections whose changes only take effect after
+// a restart
+var restartSections = []string{"server.", "monitoring."}
+
+// reloadableKeys are keys within restartSections that apply on reload,
+// along with the elements of the lists among them
+var reloadableKeys = map[string]bool{
+	"server.zone":            true,
+	"server.trusted_proxies": true,
+	"server.health_path":     true,
+}
+
+// Reload loads and validates the configuration from its sources and applies
+// it. A config that fails to load, validate or apply is logged and the
+// running config is kept.
+func (a *App) Reload() {
+	a.reloadMutex.Lock()
+	defer a.reloadMutex.Unlock()
+
+	a.logger.Info("Reloading configuration", "files", a.loader.Files())
+
+	config, err := load(a.loader)
+	if err != nil {
+		a.logger.Error("Configuration reload failed, keeping current configuration", "error", err)
+		return
+	}
+
+	// The config is applied even without changed values: Diff identifies
+	// pools, rules and backends by name, so it does not see them reordered
+	changes := configs.Diff(a.Config(), config)
+	if err := a.Apply(config); err != nil {
+		a.logger.Error("Configuration reload failed, keeping current configuration", "error", err)
+		return
+	}
+
+	for _, change := range changes {
+		if requiresRestart(change.Path) {
+			a.logger.Warn("Configuration changed, restart required to take effect", "change", change.String())
+		} else {
+			a.logger.Info("Configuration changed", "change", change.String())
+		}
+	}
+	a.logger.Info("Configuration reloaded", "changes", len(changes))
+}
+
+// watchConfig reloads the configuration whenever one of the config files
+// changes. Directories are watched rather than files so that editors and
+// configs.SaveRouting, which replace the file, are picked up, as are
+// Kubernetes ConfigMap mounts, which swap a symlink to a new directory.
+// Bursts of events are coalesced into one reload.
+func (a *App) watchConfig(ctx context.Context) error {
+	files := a.loader.Files()
+	if len(files) == 0 {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	targets := newConfigTargets(files)
+	for _, dir := range targets.dirs() {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+	for _, file := range files {
+		a.logger.Info("Watching configuration file", "path", filepath.Clean(file))
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		var debounce *time.Timer
+		for {
+			select {
+			case <-ctx.Done():
+				if debounce != nil {
+					debounce.Stop()
+				}
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) || !targets.changed(event.Name) {
+					continue
+				}
+				// A symlink may now lead to a directory that is not watched yet
+				for _, dir := range targets.dirs() {
+					if err := watcher.Add(dir); err != nil {
+						a.logger.Warn("Failed to watch configuration directory", "path", dir, "error", err)
+					}
+				}
+				if debounce != nil {
+					debounce.Stop()
+				}
+				debounce = time.AfterFunc(reloadDebounce, a.Reload)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				a.logger.Error("Configuration watcher error", "error", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// configTargets tracks the config files and the files their symlinks
+// resolve to
+type configTargets struct {
+	paths   []string
+	targets map[string]string
+}
+
+// newConfigTargets resolves the symlinks of files
+func newConfigTargets(files []string) *configTargets {
+	t := &configTargets{targets: make(map[string]string, len(files))}
+	for _, file := range files {
+		path := filepath.Clean(file)
+		t.paths = append(t.paths, path)
+		t.targets[path] = resolveTarget(path)
+	}
+	return t
+}
+
+// changed reports whether an event on name may have changed a config file:
+// name is a config file or the file it resolved to, or a config file now
+// resolves elsewhere. The symlinks are resolved again.
+func (t *configTargets) changed(name string) bool {
+	name = filepath.Clean(name)
+	changed := false
+	for _, path := range t.paths {
+		target := resolveTarget(path)
+		if name == path || name == t.targets[path] || target != t.targets[path] {
+			changed = true
+		}
+		t.targets[path] = target
+	}
+	return changed
+}
+
+// dirs returns the directories of the config files and of their targets
+func (t *configTargets) dirs() []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, path := range t.paths {
+		for _, file := range []string{path, t.targets[path]} {
+			if dir := filepath.Dir(file); file != "" && !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}
+
+// resolveTarget returns the file path resolves to, or an empty string while
+// it does not exist
+func resolveTarget(path string) string {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+// requiresRestart reports whether a change to path only applies on restart
+func requiresRestart(path string) bool {
+	key, _, _ := strings.Cut(path, "[")
+	if reloadableKeys[key] {
+		return false
+	}
+	for _, section := range restartSections {
+		if strings.HasPrefix(path, section) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigTargetsFollowSymlinkSwap(t *testing.T) {
+	// Lay out a ConfigMap mount: config.yml -> ..data/config.yml, with
+	// ..data a symlink to the current version's directory
+	dir := t.TempDir()
+	for _, version := range []string{"v1", "v2"} {
+		if err := os.Mkdir(filepath.Join(dir, version), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, version, "config.yml"), []byte(version), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(dir, "config.yml")
+	if err := os.Symlink(filepath.Join("..data", "config.yml"), config); err != nil {
+		t.Fatal(err)
+	}
+
+	targets := newConfigTargets([]string{config})
+	if targets.changed(filepath.Join(dir, "unrelated.yml")) {
+		t.Error("event on an unrelated file reported as a change")
+	}
+
+	// The update renames a new symlink over ..data
+	if err := os.Symlink("v2", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if !targets.changed(filepath.Join(dir, "..data")) {
+		t.Error("symlink swap not reported as a change")
+	}
+	if targets.changed(filepath.Join(dir, "..data")) {
+		t.Error("change reported twice")
+	}
+
+	// Writes to the file the symlink resolves to
+	resolved, err := filepath.EvalSymlinks(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !targets.changed(resolved) {
+		t.Error("write to the target not reported as a change")
+	}
+
+	want := map[string]bool{dir: true, filepath.Dir(resolved): true}
+	for _, d := range targets.dirs() {
+		if !want[d] {
+			t.Errorf("watching unexpected directory %s", d)
+		}
+		delete(want, d)
+	}
+	if len(want) > 0 {
+		t.Errorf("not watching %v", want)
+	}
+}
+
+func TestConfigTargetsRenameOverFile(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(config, []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	targets := newConfigTargets([]string{config})
+
+	// Editors that save atomically write a temporary file and rename it
+	// over the config file; the config file is removed in between
+	if err := os.Remove(config); err != nil {
+		t.Fatal(err)
+	}
+	if !targets.changed(config) {
+		t.Error("removal not reported as a change")
+	}
+	if err := os.WriteFile(config+".tmp", []byte("b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(config+".tmp", config); err != nil {
+		t.Fatal(err)
+	}
+	if !targets.changed(config) {
+		t.Error("rename over the config file not reported as a change")
+	}
+}
+
+func TestRequiresRestart(t *testing.T) {
+	tests := map[string]bool{
+		"server.address":                    true,
+		"server.zone":                       false,
+		"server.trusted_proxies[0]":         false,
+		"monitoring.logging.level":          true,
+		"backend_pools[web].algorithm":      false,
+		"routing_rules[api].match.path":     false,
+		"server.admin_auth.tokens[0].token": true,
+	}
+	for path, want := range tests {
+		if got := requiresRestart(path); got != want {
+			t.Errorf("requiresRestart(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"net/url"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
 )
 
 // Backend represents a backend server
@@ -14,6 +17,29 @@ type Backend struct {
 	ActiveConns   int32
 	TotalRequests int64
 	mutex         sync.RWMutex
+
+	breaker       *CircuitBreaker
+	breakerConfig configs.CircuitBreakerConfig
+
+	ejectedUntil time.Time
+	ejections    int
+	ejectTimer   *time.Timer
+
+	// available caches IsAvailable. refreshMutex orders its updates, and
+	// watch is told about every change.
+	available    atomic.Bool
+	breakerOpen  atomic.Bool
+	refreshMutex sync.Mutex
+	watch        atomic.Pointer[func(*Backend)]
+
+	slowStart    configs.SlowStartConfig
+	warmingSince time.Time
+
+	priority int
+	backup   bool
+	zone     string
+
+	maxConns int32
 }
 
 // NewBackend creates a new backend instance
@@ -23,11 +49,13 @@ func NewBackend(urlStr string, weight int) (*Backend, error) {
 		return nil, err
 	}
 
-	return &Backend{
+	b := &Backend{
 		URL:     url,
 		Weight:  weight,
 		Healthy: true,
-	}, nil
+	}
+	b.available.Store(true)
+	return b, nil
 }
 
 // IsHealthy returns the health status of the backend
@@ -37,11 +65,181 @@ func (b *Backend) IsHealthy() bool {
 	return b.Healthy
 }
 
-// SetHealth sets the health status of the backend
+// SetHealth sets the health status of the backend. A backend that becomes
+// healthy again starts slow start.
 func (b *Backend) SetHealth(healthy bool) {
 	b.mutex.Lock()
-	defer b.mutex.Unlock()
+	if healthy && !b.Healthy {
+		b.warmingSince = time.Now()
+	}
 	b.Healthy = healthy
+	b.mutex.Unlock()
+
+	b.refresh()
+}
+
+// IsAvailable reports whether the backend can take requests: it is healthy,
+// not ejected as an outlier and its circuit breaker is not open. It is kept
+// up to date as these change, so it takes no locks. A half-open circuit
+// counts as available; its breaker's Allow hands out the trial requests.
+func (b *Backend) IsAvailable() bool {
+	return b.available.Load()
+}
+
+// Watch sets the function that is called whenever the backend becomes
+// available or unavailable, replacing the previous one. It is called on the
+// goroutine that made the change, which may hold the lock of the backend's
+// circuit breaker.
+func (b *Backend) Watch(watch func(*Backend)) {
+	b.watch.Store(&watch)
+}
+
+// refresh recomputes IsAvailable and tells the watcher when it changed
+func (b *Backend) refresh() {
+	b.refreshMutex.Lock()
+	available := b.IsHealthy() && !b.IsEjected() && !b.breakerOpen.Load()
+	changed := b.available.Swap(available) != available
+	b.refreshMutex.Unlock()
+
+	if watch := b.watch.Load(); changed && watch != nil {
+		(*watch)(b)
+	}
+}
+
+// IsEjected reports whether the backend is ejected as an outlier
+func (b *Backend) IsEjected() bool {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return time.Now().Before(b.ejectedUntil)
+}
+
+// Eject takes the backend out of rotation as an outlier. Every ejection in a
+// row lasts base longer than the one before, up to max. The backend returns
+// by itself once the time is up. It returns how long the backend is ejected
+// for.
+func (b *Backend) Eject(base, max time.Duration) time.Duration {
+	b.mutex.Lock()
+	b.ejections++
+	d := base * time.Duration(b.ejections)
+	if d > max || d <= 0 {
+		d = max
+	}
+	b.ejectedUntil = time.Now().Add(d)
+	if b.ejectTimer != nil {
+		b.ejectTimer.Stop()
+	}
+	b.ejectTimer = time.AfterFunc(d, b.refresh)
+	b.mutex.Unlock()
+
+	b.refresh()
+	return d
+}
+
+// ForgiveEjection lowers the ejection count of a backend that is back in
+// rotation, so its next ejection is shorter again
+func (b *Backend) ForgiveEjection() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.ejections > 0 && !time.Now().Before(b.ejectedUntil) {
+		b.ejections--
+	}
+}
+
+// Breaker returns the circuit breaker of the backend, nil when disabled
+func (b *Backend) Breaker() *CircuitBreaker {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.breaker
+}
+
+// ConfigureCircuitBreaker sets up the circuit breaker of the backend. When
+// the settings are unchanged the current breaker and its state are kept.
+// onChange, if set, is called with every new state of the breaker.
+func (b *Backend) ConfigureCircuitBreaker(config configs.CircuitBreakerConfig, onChange func(BreakerState)) {
+	b.mutex.Lock()
+	if b.breaker != nil && b.breakerConfig == config {
+		b.mutex.Unlock()
+		return
+	}
+	var cb *CircuitBreaker
+	cb = NewCircuitBreaker(config, func(state BreakerState) {
+		b.breakerChanged(cb, state)
+		if onChange != nil {
+			onChange(state)
+		}
+	})
+	b.breaker = cb
+	b.breakerConfig = config
+	b.breakerOpen.Store(false)
+	b.mutex.Unlock()
+
+	b.refresh()
+	if onChange != nil {
+		onChange(StateClosed)
+	}
+}
+
+// breakerChanged takes the backend out of rotation while cb is open, unless
+// cb was replaced in the meantime
+func (b *Backend) breakerChanged(cb *CircuitBreaker, state BreakerState) {
+	b.mutex.RLock()
+	if b.breaker == cb {
+		b.breakerOpen.Store(state == StateOpen)
+	}
+	b.mutex.RUnlock()
+
+	b.refresh()
+}
+
+// GetWeight returns the configured weight of the backend
+func (b *Backend) GetWeight() int {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.Weight
+}
+
+// SetWeight updates the configured weight of the backend
+func (b *Backend) SetWeight(weight int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.Weight = weight
+}
+
+// GetPriority returns the priority tier of the backend, lower is preferred
+func (b *Backend) GetPriority() int {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.priority
+}
+
+// IsBackup reports whether the backend is a backup
+func (b *Backend) IsBackup() bool {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.backup
+}
+
+// SetPriority updates the priority tier of the backend and whether it is a
+// backup
+func (b *Backend) SetPriority(priority int, backup bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.priority = priority
+	b.backup = backup
+}
+
+// GetZone returns the availability zone of the backend
+func (b *Backend) GetZone() string {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.zone
+}
+
+// SetZone updates the availability zone of the backend
+func (b *Backend) SetZone(zone string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.zone = zone
 }
 
 // IncrementConnections increments the active connection count
@@ -54,6 +252,38 @@ func (b *Backend) DecrementConnections() {
 	atomic.AddInt32(&b.ActiveConns, -1)
 }
 
+// SetMaxConnections caps the active connections of the backend, 0 for no
+// cap. Connections above a lowered cap stay open.
+func (b *Backend) SetMaxConnections(max int) {
+	atomic.StoreInt32(&b.maxConns, int32(max))
+}
+
+// GetMaxConnections returns the cap on active connections, 0 for no cap
+func (b *Backend) GetMaxConnections() int {
+	return int(atomic.LoadInt32(&b.maxConns))
+}
+
+// AcquireConnection increments the active connection count unless the
+// backend is at its cap, and reports whether it did
+func (b *Backend) AcquireConnection() bool {
+	for {
+		max := atomic.LoadInt32(&b.maxConns)
+		active := atomic.LoadInt32(&b.ActiveConns)
+		if max > 0 && active >= max {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&b.ActiveConns, active, active+1) {
+			return true
+		}
+	}
+}
+
+// HasCapacity reports whether the backend is below its connection cap
+func (b *Backend) HasCapacity() bool {
+	max := atomic.LoadInt32(&b.maxConns)
+	return max <= 0 || atomic.LoadInt32(&b.ActiveConns) < max
+}
+
 // GetActiveConnections returns the number of active connections
 func (b *Backend) GetActiveConnections() int {
 	return int(atomic.LoadInt32(&b.ActiveConns))
@@ -0,0 +1,276 @@
+package backend
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+)
+
+// Circuit breaker defaults, used for zero values in
+// configs.CircuitBreakerConfig
+const (
+	DefaultBreakerWindow           = 10 * time.Second
+	DefaultBreakerMinRequests      = 10
+	DefaultBreakerOpenDuration     = 30 * time.Second
+	DefaultBreakerHalfOpenRequests = 1
+)
+
+// windowBuckets is the number of buckets the rolling window is split into
+const windowBuckets = 10
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// StateClosed lets every request through
+	StateClosed BreakerState = iota
+	// StateOpen rejects every request until the open duration has passed
+	StateOpen
+	// StateHalfOpen lets a limited number of trial requests through
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker stops sending requests to a failing backend. A nil
+// *CircuitBreaker is a disabled breaker that is always closed.
+type CircuitBreaker struct {
+	config   configs.CircuitBreakerConfig
+	onChange func(BreakerState)
+
+	mutex     sync.Mutex
+	state     BreakerState
+	openedAt  time.Time
+	failures  int
+	buckets   [windowBuckets]bucket
+	trials    int
+	successes int
+}
+
+// bucket counts the requests of one slice of the rolling window
+type bucket struct {
+	start    time.Time
+	requests int
+	failures int
+}
+
+// NewCircuitBreaker creates a circuit breaker, or returns nil when config
+// enables neither trigger. onChange, if set, is called with every new state.
+func NewCircuitBreaker(config configs.CircuitBreakerConfig, onChange func(BreakerState)) *CircuitBreaker {
+	if config.ConsecutiveFailures <= 0 && config.ErrorRate <= 0 {
+		return nil
+	}
+
+	if config.Window <= 0 {
+		config.Window = DefaultBreakerWindow
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = DefaultBreakerMinRequests
+	}
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = DefaultBreakerOpenDuration
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = DefaultBreakerHalfOpenRequests
+	}
+
+	return &CircuitBreaker{
+		config:   config,
+		onChange: onChange,
+	}
+}
+
+// State returns the current state of the breaker
+func (cb *CircuitBreaker) State() BreakerState {
+	if cb == nil {
+		return StateClosed
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	return cb.current(time.Now())
+}
+
+// Ready reports whether the breaker would let a request through
+func (cb *CircuitBreaker) Ready() bool {
+	if cb == nil {
+		return true
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	switch cb.current(time.Now()) {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		return cb.trials < cb.config.HalfOpenRequests
+	default:
+		return true
+	}
+}
+
+// Allow reports whether a request may be sent. In the half-open state it
+// takes one of the trial slots, which the request's Success, Failure or
+// Release gives back.
+func (cb *CircuitBreaker) Allow() bool {
+	if cb == nil {
+		return true
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	switch cb.current(time.Now()) {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		if cb.trials >= cb.config.HalfOpenRequests {
+			return false
+		}
+		cb.trials++
+	}
+	return true
+}
+
+// Success records a request that succeeded
+func (cb *CircuitBreaker) Success() {
+	if cb == nil {
+		return
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	now := time.Now()
+
+	switch cb.current(now) {
+	case StateHalfOpen:
+		cb.release()
+		cb.successes++
+		if cb.successes >= cb.config.HalfOpenRequests {
+			cb.setState(StateClosed, now)
+		}
+	case StateClosed:
+		cb.failures = 0
+		cb.bucket(now).requests++
+	}
+}
+
+// Failure records a request that failed
+func (cb *CircuitBreaker) Failure() {
+	if cb == nil {
+		return
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	now := time.Now()
+
+	switch cb.current(now) {
+	case StateHalfOpen:
+		cb.release()
+		cb.setState(StateOpen, now)
+	case StateClosed:
+		cb.failures++
+		b := cb.bucket(now)
+		b.requests++
+		b.failures++
+		if cb.tripped(now) {
+			cb.setState(StateOpen, now)
+		}
+	}
+}
+
+// Release gives back the trial slot of a request that ended without telling
+// whether the backend works, e.g. because the client went away
+func (cb *CircuitBreaker) Release() {
+	if cb == nil {
+		return
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	if cb.current(time.Now()) == StateHalfOpen {
+		cb.release()
+	}
+}
+
+// current returns the state at now, moving an open breaker whose open
+// duration has passed to half-open
+func (cb *CircuitBreaker) current(now time.Time) BreakerState {
+	if cb.state == StateOpen && now.Sub(cb.openedAt) >= cb.config.OpenDuration {
+		cb.setState(StateHalfOpen, now)
+	}
+	return cb.state
+}
+
+// setState moves the breaker to state and resets the counters of the old
+// one. An open breaker moves on to half-open by itself once the open
+// duration has passed, so that onChange hears about it without a request.
+func (cb *CircuitBreaker) setState(state BreakerState, now time.Time) {
+	cb.state = state
+	cb.failures = 0
+	cb.trials = 0
+	cb.successes = 0
+	cb.buckets = [windowBuckets]bucket{}
+	if state == StateOpen {
+		cb.openedAt = now
+		time.AfterFunc(cb.config.OpenDuration, func() {
+			cb.mutex.Lock()
+			defer cb.mutex.Unlock()
+			cb.current(time.Now())
+		})
+	}
+
+	if cb.onChange != nil {
+		cb.onChange(state)
+	}
+}
+
+func (cb *CircuitBreaker) release() {
+	if cb.trials > 0 {
+		cb.trials--
+	}
+}
+
+// tripped reports whether either trigger has been reached
+func (cb *CircuitBreaker) tripped(now time.Time) bool {
+	if cb.config.ConsecutiveFailures > 0 && cb.failures >= cb.config.ConsecutiveFailures {
+		return true
+	}
+	if cb.config.ErrorRate <= 0 {
+		return false
+	}
+
+	var requests, failures int
+	for _, b := range cb.buckets {
+		if now.Sub(b.start) < cb.config.Window {
+			requests += b.requests
+			failures += b.failures
+		}
+	}
+	return requests >= cb.config.MinRequests && float64(failures) >= cb.config.ErrorRate*float64(requests)
+}
+
+// bucket returns the bucket of the rolling window that now falls in,
+// clearing it when it still holds counts from an earlier window
+func (cb *CircuitBreaker) bucket(now time.Time) *bucket {
+	size := cb.config.Window / windowBuckets
+	if size <= 0 {
+		size = 1
+	}
+	start := now.Truncate(size)
+	b := &cb.buckets[(start.UnixNano()/int64(size))%windowBuckets]
+	if !b.start.Equal(start) {
+		*b = bucket{start: start}
+	}
+	return b
+}
@@ -0,0 +1,187 @@
+package backend
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+)
+
+// openDuration is short so that tests can wait for a breaker to half-open
+const openDuration = 20 * time.Millisecond
+
+// tripBreaker creates a breaker that opens after two consecutive failures
+// and opens it
+func tripBreaker(t *testing.T, halfOpenRequests int) *CircuitBreaker {
+	t.Helper()
+	cb := NewCircuitBreaker(configs.CircuitBreakerConfig{
+		ConsecutiveFailures: 2,
+		OpenDuration:        openDuration,
+		HalfOpenRequests:    halfOpenRequests,
+	}, nil)
+	cb.Failure()
+	cb.Failure()
+	if state := cb.State(); state != StateOpen {
+		t.Fatalf("state = %v, want open", state)
+	}
+	return cb
+}
+
+// halfOpen waits until cb has left the open state
+func halfOpen(t *testing.T, cb *CircuitBreaker) {
+	t.Helper()
+	time.Sleep(openDuration + 5*time.Millisecond)
+	if state := cb.State(); state != StateHalfOpen {
+		t.Fatalf("state = %v, want half_open", state)
+	}
+}
+
+func TestNilBreaker(t *testing.T) {
+	cb := NewCircuitBreaker(configs.CircuitBreakerConfig{}, nil)
+	if cb != nil {
+		t.Fatal("breaker without triggers should be nil")
+	}
+	cb.Failure()
+	cb.Success()
+	cb.Release()
+	if !cb.Allow() || !cb.Ready() || cb.State() != StateClosed {
+		t.Error("nil breaker should always be closed")
+	}
+}
+
+func TestBreakerTrips(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   configs.CircuitBreakerConfig
+		outcomes string // s for success, f for failure
+		want     BreakerState
+	}{
+		{
+			name:     "consecutive failures",
+			config:   configs.CircuitBreakerConfig{ConsecutiveFailures: 3},
+			outcomes: "sfff",
+			want:     StateOpen,
+		},
+		{
+			name:     "success resets consecutive failures",
+			config:   configs.CircuitBreakerConfig{ConsecutiveFailures: 3},
+			outcomes: "ffsff",
+			want:     StateClosed,
+		},
+		{
+			name:     "error rate",
+			config:   configs.CircuitBreakerConfig{ErrorRate: 0.5, MinRequests: 4},
+			outcomes: "sfsf",
+			want:     StateOpen,
+		},
+		{
+			name:     "error rate below min requests",
+			config:   configs.CircuitBreakerConfig{ErrorRate: 0.5, MinRequests: 4},
+			outcomes: "fff",
+			want:     StateClosed,
+		},
+		{
+			name:     "error rate below threshold",
+			config:   configs.CircuitBreakerConfig{ErrorRate: 0.5, MinRequests: 4},
+			outcomes: "ssfsf",
+			want:     StateClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := NewCircuitBreaker(tt.config, nil)
+			for _, outcome := range tt.outcomes {
+				if outcome == 's' {
+					cb.Success()
+				} else {
+					cb.Failure()
+				}
+			}
+			if state := cb.State(); state != tt.want {
+				t.Errorf("state = %v, want %v", state, tt.want)
+			}
+			if allowed := cb.Allow(); allowed != (tt.want == StateClosed) {
+				t.Errorf("Allow() = %v in state %v", allowed, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpenTrials(t *testing.T) {
+	cb := tripBreaker(t, 2)
+	if cb.Allow() || cb.Ready() {
+		t.Fatal("open breaker should reject requests")
+	}
+	halfOpen(t, cb)
+
+	if !cb.Allow() || !cb.Allow() {
+		t.Fatal("half-open breaker should allow two trials")
+	}
+	if cb.Ready() || cb.Allow() {
+		t.Fatal("half-open breaker should reject a third trial")
+	}
+
+	// A released trial frees its slot without counting as a success
+	cb.Release()
+	if !cb.Allow() {
+		t.Fatal("released trial slot should be taken again")
+	}
+
+	cb.Success()
+	if state := cb.State(); state != StateHalfOpen {
+		t.Fatalf("state after one success = %v, want half_open", state)
+	}
+	cb.Success()
+	if state := cb.State(); state != StateClosed {
+		t.Fatalf("state after two successes = %v, want closed", state)
+	}
+}
+
+func TestBreakerHalfOpenFailure(t *testing.T) {
+	cb := tripBreaker(t, 1)
+	halfOpen(t, cb)
+
+	if !cb.Allow() {
+		t.Fatal("half-open breaker should allow a trial")
+	}
+	cb.Failure()
+	if state := cb.State(); state != StateOpen {
+		t.Fatalf("state after failed trial = %v, want open", state)
+	}
+	if cb.Allow() {
+		t.Error("reopened breaker should reject requests")
+	}
+}
+
+func TestBreakerOnChange(t *testing.T) {
+	var mutex sync.Mutex
+	var states []BreakerState
+	cb := NewCircuitBreaker(configs.CircuitBreakerConfig{
+		ConsecutiveFailures: 1,
+		OpenDuration:        openDuration,
+	}, func(state BreakerState) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		states = append(states, state)
+	})
+
+	cb.Failure()
+
+	// The breaker half-opens without any request asking for its state
+	time.Sleep(openDuration + 20*time.Millisecond)
+	mutex.Lock()
+	got := append([]BreakerState(nil), states...)
+	mutex.Unlock()
+
+	want := []BreakerState{StateOpen, StateHalfOpen}
+	if len(got) != len(want) {
+		t.Fatalf("states = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("states = %v, want %v", got, want)
+		}
+	}
+}
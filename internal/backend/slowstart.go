@@ -0,0 +1,59 @@
+package backend
+
+import (
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+)
+
+// DefaultSlowStartMinWeightPercent is the share of its weight a backend
+// starts slow start with when min_weight_percent is not set
+const DefaultSlowStartMinWeightPercent = 10
+
+// ConfigureSlowStart sets the slow start settings of the backend. A backend
+// that is warming up keeps ramping with the new settings.
+func (b *Backend) ConfigureSlowStart(config configs.SlowStartConfig) {
+	if config.MinWeightPercent <= 0 {
+		config.MinWeightPercent = DefaultSlowStartMinWeightPercent
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.slowStart = config
+}
+
+// StartSlowStart starts warming the backend up, e.g. because it was just
+// added to a running pool
+func (b *Backend) StartSlowStart() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.warmingSince = time.Now()
+}
+
+// SlowStartFactor returns the share of its weight the backend currently
+// gets: 1 outside of slow start, and from the minimum share up to 1 over
+// the slow start window
+func (b *Backend) SlowStartFactor() float64 {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	window := b.slowStart.Window
+	if window <= 0 || b.warmingSince.IsZero() {
+		return 1
+	}
+	elapsed := time.Since(b.warmingSince)
+	if elapsed >= window {
+		return 1
+	}
+
+	min := float64(b.slowStart.MinWeightPercent) / 100
+	if min >= 1 {
+		return 1
+	}
+	return min + (1-min)*float64(elapsed)/float64(window)
+}
+
+// IsWarming reports whether the backend is in slow start
+func (b *Backend) IsWarming() bool {
+	return b.SlowStartFactor() < 1
+}
@@ -0,0 +1,66 @@
+package backend
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+)
+
+func TestSlowStartFactor(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  configs.SlowStartConfig
+		elapsed time.Duration // since warming started, negative when not warming
+		want    float64
+	}{
+		{name: "disabled", config: configs.SlowStartConfig{}, elapsed: 0, want: 1},
+		{name: "not warming", config: configs.SlowStartConfig{Window: time.Minute}, elapsed: -1, want: 1},
+		{name: "just started with default minimum", config: configs.SlowStartConfig{Window: time.Minute}, elapsed: 0, want: 0.1},
+		{name: "just started", config: configs.SlowStartConfig{Window: time.Minute, MinWeightPercent: 20}, elapsed: 0, want: 0.2},
+		{name: "half way", config: configs.SlowStartConfig{Window: time.Minute, MinWeightPercent: 20}, elapsed: 30 * time.Second, want: 0.6},
+		{name: "window passed", config: configs.SlowStartConfig{Window: time.Minute}, elapsed: 2 * time.Minute, want: 1},
+		{name: "minimum of full weight", config: configs.SlowStartConfig{Window: time.Minute, MinWeightPercent: 100}, elapsed: 0, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBackend("http://10.0.0.1:8080", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.ConfigureSlowStart(tt.config)
+			if tt.elapsed >= 0 {
+				b.warmingSince = time.Now().Add(-tt.elapsed)
+			}
+
+			if got := b.SlowStartFactor(); math.Abs(got-tt.want) > 0.01 {
+				t.Errorf("SlowStartFactor() = %.3f, want %.3f", got, tt.want)
+			}
+			if got := b.IsWarming(); got != (tt.want < 1) {
+				t.Errorf("IsWarming() = %v", got)
+			}
+		})
+	}
+}
+
+func TestRecoveredBackendWarmsUp(t *testing.T) {
+	b, err := NewBackend("http://10.0.0.1:8080", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.ConfigureSlowStart(configs.SlowStartConfig{Window: time.Minute})
+
+	// A backend that stays healthy does not warm up
+	b.SetHealth(true)
+	if b.IsWarming() {
+		t.Fatal("healthy backend should not warm up")
+	}
+
+	b.SetHealth(false)
+	b.SetHealth(true)
+	if !b.IsWarming() {
+		t.Error("recovered backend should warm up")
+	}
+}
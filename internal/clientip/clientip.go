@@ -0,0 +1,118 @@
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Resolver finds the IP address of the client that sent a request. The
+// peer address of the connection is the client unless it is a trusted
+// proxy, in which case the client is taken from the forwarding headers the
+// proxy set.
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+// defaultResolver is used by FromRequest. It trusts no proxy until the
+// configuration sets some.
+var defaultResolver atomic.Pointer[Resolver]
+
+func init() {
+	defaultResolver.Store(&Resolver{})
+}
+
+// New creates a resolver that trusts the forwarding headers of proxies,
+// given as IP addresses or CIDRs
+func New(proxies []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, proxy := range proxies {
+		ipNet, err := parseNet(proxy)
+		if err != nil {
+			return nil, err
+		}
+		r.trusted = append(r.trusted, ipNet)
+	}
+	return r, nil
+}
+
+// Validate checks that every proxy is an IP address or a CIDR
+func Validate(proxies []string) error {
+	_, err := New(proxies)
+	return err
+}
+
+// SetDefault replaces the resolver used by FromRequest
+func SetDefault(r *Resolver) {
+	defaultResolver.Store(r)
+}
+
+// FromRequest returns the client IP of a request using the default resolver
+func FromRequest(r *http.Request) string {
+	return defaultResolver.Load().IP(r)
+}
+
+// IP returns the client IP of a request. X-Forwarded-For is read from the
+// right, skipping trusted proxies, since only the entries appended by them
+// can be believed. X-Real-IP is used when there is no X-Forwarded-For.
+func (res *Resolver) IP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !res.isTrusted(ip) {
+		return ip
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			ip = hop
+			if !res.isTrusted(hop) {
+				break
+			}
+		}
+		return ip
+	}
+
+	if xrip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(xrip) != nil {
+		return xrip
+	}
+	return ip
+}
+
+// isTrusted reports whether ip belongs to a trusted proxy
+func (res *Resolver) isTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range res.trusted {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNet parses a CIDR, or an IP address as a network of one address
+func parseNet(s string) (*net.IPNet, error) {
+	if _, ipNet, err := net.ParseCIDR(s); err == nil {
+		return ipNet, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP or CIDR %q", s)
+	}
+	bits := 8 * net.IPv6len
+	if v4 := ip.To4(); v4 != nil {
+		ip, bits = v4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
@@ -0,0 +1,65 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolverIP(t *testing.T) {
+	resolver, err := New([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		xRealIP    string
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:4711", want: "203.0.113.7"},
+		{name: "untrusted peer sends headers", remoteAddr: "203.0.113.7:4711", xff: []string{"1.2.3.4"}, xRealIP: "5.6.7.8", want: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.1:4711", xff: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		{name: "client prepends a spoofed entry", remoteAddr: "10.0.0.1:4711", xff: []string{"1.2.3.4, 203.0.113.7"}, want: "203.0.113.7"},
+		{name: "chain of trusted proxies", remoteAddr: "192.168.1.1:4711", xff: []string{"203.0.113.7, 10.1.2.3", "10.0.0.2"}, want: "203.0.113.7"},
+		{name: "only trusted proxies", remoteAddr: "10.0.0.1:4711", xff: []string{"10.0.0.3, 10.0.0.2"}, want: "10.0.0.3"},
+		{name: "invalid entry stops the walk", remoteAddr: "10.0.0.1:4711", xff: []string{"203.0.113.7, garbage, 10.0.0.2"}, want: "10.0.0.2"},
+		{name: "real IP from trusted proxy", remoteAddr: "10.0.0.1:4711", xRealIP: "203.0.113.7", want: "203.0.113.7"},
+		{name: "invalid real IP", remoteAddr: "10.0.0.1:4711", xRealIP: "garbage", want: "10.0.0.1"},
+		{name: "remote address without port", remoteAddr: "203.0.113.7", want: "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, xff := range tt.xff {
+				r.Header.Add("X-Forwarded-For", xff)
+			}
+			if tt.xRealIP != "" {
+				r.Header.Set("X-Real-IP", tt.xRealIP)
+			}
+			if got := resolver.IP(r); got != tt.want {
+				t.Errorf("IP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultTrustsNoProxy(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:4711"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	if got := FromRequest(r); got != "10.0.0.1" {
+		t.Errorf("FromRequest() = %q, want the peer address", got)
+	}
+}
+
+func TestNewRejectsInvalidProxies(t *testing.T) {
+	for _, proxy := range []string{"", "10.0.0.0/33", "proxy.internal"} {
+		if _, err := New([]string{proxy}); err == nil {
+			t.Errorf("New(%q) succeeded", proxy)
+		}
+	}
+}
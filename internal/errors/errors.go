@@ -19,6 +19,10 @@ const (
 	ErrorTypeRouting ErrorType = "ROUTING_ERROR"
 	// ErrorTypeHealthCheck represents health check related errors
 	ErrorTypeHealthCheck ErrorType = "HEALTH_CHECK_ERROR"
+	// ErrorTypeRateLimit represents rate limiting errors
+	ErrorTypeRateLimit ErrorType = "RATE_LIMIT_ERROR"
+	// ErrorTypeInternal represents internal errors such as misconfiguration
+	ErrorTypeInternal ErrorType = "INTERNAL_ERROR"
 )
 
 // LoadBalancerError represents a custom error type for the load balancer
@@ -36,6 +40,11 @@ func (e *LoadBalancerError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Type, e.Message)
 }
 
+// Unwrap returns the underlying error
+func (e *LoadBalancerError) Unwrap() error {
+	return e.Err
+}
+
 // NewValidationError creates a new validation error
 func NewValidationError(message string, err error) *LoadBalancerError {
 	return &LoadBalancerError{
@@ -84,4 +93,24 @@ func NewHealthCheckError(message string, err error) *LoadBalancerError {
 		Err:     err,
 		Code:    http.StatusServiceUnavailable,
 	}
-} 
\ No newline at end of file
+}
+
+// NewRateLimitError creates a new rate limit error
+func NewRateLimitError(message string, err error) *LoadBalancerError {
+	return &LoadBalancerError{
+		Type:    ErrorTypeRateLimit,
+		Message: message,
+		Err:     err,
+		Code:    http.StatusTooManyRequests,
+	}
+}
+
+// NewInternalError creates a new internal error
+func NewInternalError(message string, err error) *LoadBalancerError {
+	return &LoadBalancerError{
+		Type:    ErrorTypeInternal,
+		Message: message,
+		Err:     err,
+		Code:    http.StatusInternalServerError,
+	}
+}
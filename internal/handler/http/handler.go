@@ -1,140 +1,355 @@
 package http
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
-	"net/http/httputil"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/gorilla/mux"
 	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+	"github.com/rixtrayker/go-loadbalancer/internal/clientip"
+	lberrors "github.com/rixtrayker/go-loadbalancer/internal/errors"
 	"github.com/rixtrayker/go-loadbalancer/internal/logging"
-	"github.com/rixtrayker/go-loadbalancer/internal/policy"
+	"github.com/rixtrayker/go-loadbalancer/internal/monitoring"
+	"github.com/rixtrayker/go-loadbalancer/internal/retry"
+	"github.com/rixtrayker/go-loadbalancer/internal/routing"
 	"github.com/rixtrayker/go-loadbalancer/internal/serverpool"
 )
 
+// failurePenalty is the least response time an attempt that failed without
+// a response counts as for latency-aware algorithms
+const failurePenalty = time.Second
+
 // Handler handles HTTP requests
 type Handler struct {
-	router  *mux.Router
-	config  *configs.Config
-	logger  *logging.Logger
-	pools   map[string]*serverpool.Pool
+	logger   *logging.Logger
+	mutex    sync.Mutex
+	state    atomic.Pointer[state]
+	observer atomic.Pointer[Observer]
+}
+
+// Observer is told the outcome of every request proxied to a backend.
+// status is 0 when the request failed before a response arrived, with err
+// telling why; latency is the time until the response headers arrived.
+type Observer interface {
+	Observe(pool string, b *backend.Backend, status int, err error, latency time.Duration)
+}
+
+// state is an immutable snapshot of the routing tree. Apply builds a new
+// state and swaps it in, so in-flight requests finish on the old one.
+type state struct {
+	config    *configs.Config
+	router    *routing.Router
+	pools     map[string]*serverpool.Pool
+	upstreams map[*backend.Backend]*upstream
 }
 
 // NewHandler creates a new HTTP handler
-func NewHandler(config *configs.Config, logger *logging.Logger) *Handler {
+func NewHandler(config *configs.Config, logger *logging.Logger) (*Handler, error) {
 	h := &Handler{
-		router:  mux.NewRouter(),
-		config:  config,
-		logger:  logger,
-		pools:   make(map[string]*serverpool.Pool),
+		logger: logger,
 	}
 
-	h.setupRoutes()
-	return h
+	if err := h.Apply(config); err != nil {
+		return nil, err
+	}
+	return h, nil
 }
 
 // ServeHTTP implements the http.Handler interface
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	h.router.ServeHTTP(w, r)
+	s := h.state.Load()
+	match, err := s.router.Match(r)
+	if err != nil {
+		// The load balancer answers its own health endpoint unless a
+		// routing rule sends the path to a backend
+		if path := s.config.Server.HealthPath; path != "" && r.URL.Path == path {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+			return
+		}
+
+		h.logger.Info("No matching route", "path", r.URL.Path)
+		http.Error(w, "No matching route", http.StatusNotFound)
+		return
+	}
+
+	h.proxy(w, r, s, match)
 }
 
-// setupRoutes configures the HTTP routes
-func (h *Handler) setupRoutes() {
+// SetObserver sets the observer of proxied requests, replacing the previous
+// one
+func (h *Handler) SetObserver(observer Observer) {
+	h.observer.Store(&observer)
+}
+
+// Pools returns the backend pools served by the handler
+func (h *Handler) Pools() map[string]*serverpool.Pool {
+	return h.state.Load().pools
+}
+
+// Config returns the configuration the handler is serving. It must not be
+// modified; use Clone to derive a new configuration.
+func (h *Handler) Config() *configs.Config {
+	return h.state.Load().config
+}
+
+// Apply builds pools and routes for config and atomically swaps them in.
+// Existing pools are rebuilt so backends that are still configured keep
+// their health state and connection counters. On error the current state
+// is left untouched.
+func (h *Handler) Apply(config *configs.Config) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var previous map[string]*serverpool.Pool
+	var previousUpstreams map[*backend.Backend]*upstream
+	if current := h.state.Load(); current != nil {
+		previous = current.pools
+		previousUpstreams = current.upstreams
+	}
+
 	// Setup backend pools
-	for _, poolConfig := range h.config.BackendPools {
-		pool, err := serverpool.NewPool(poolConfig)
+	pools := make(map[string]*serverpool.Pool, len(config.BackendPools))
+	for _, poolConfig := range config.BackendPools {
+		var pool *serverpool.Pool
+		var err error
+		if old, ok := previous[poolConfig.Name]; ok {
+			pool, err = old.Rebuild(poolConfig, config.Server.Zone)
+		} else {
+			pool, err = serverpool.NewPool(poolConfig, config.Server.Zone)
+		}
 		if err != nil {
-			h.logger.Error("Failed to create backend pool", "name", poolConfig.Name, "error", err)
-			continue
+			return fmt.Errorf("failed to create backend pool %s: %w", poolConfig.Name, err)
 		}
-		h.pools[poolConfig.Name] = pool
+		pools[poolConfig.Name] = pool
 	}
 
-	// Setup routing rules
-	for _, rule := range h.config.RoutingRules {
-		pool, ok := h.pools[rule.TargetPool]
-		if !ok {
-			h.logger.Error("Target pool not found", "pool", rule.TargetPool)
-			continue
-		}
+	router, err := h.buildRouter(config, pools)
+	if err != nil {
+		return err
+	}
 
-		// Create route handler
-		handler := func(w http.ResponseWriter, r *http.Request) {
-			// Apply policies
-			for _, policyConfig := range rule.Policies {
-				if err := policy.Apply(policyConfig, r); err != nil {
-					h.logger.Error("Policy application failed", "error", err)
-					http.Error(w, "Policy violation", http.StatusForbidden)
-					return
-				}
-			}
+	resolver, err := clientip.New(config.Server.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("invalid trusted proxies: %w", err)
+	}
 
-			// Select backend
-			backend, err := pool.NextBackend(r)
-			if err != nil {
-				h.logger.Error("Failed to select backend", "error", err)
-				http.Error(w, "No backend available", http.StatusServiceUnavailable)
-				return
+	// Keep the proxies of backends whose transport settings did not change
+	upstreams := make(map[*backend.Backend]*upstream)
+	for _, poolConfig := range config.BackendPools {
+		pool := pools[poolConfig.Name]
+		for _, b := range pool.Backends {
+			if u, ok := previousUpstreams[b]; ok && u.config == poolConfig.Transport {
+				upstreams[b] = u
+				continue
 			}
+			upstreams[b] = newUpstream(b, pool.Name, poolConfig.Transport, h.logger)
+		}
+	}
 
-			// Start timer for backend response time
-			_ = time.Now()
+	// Nothing can fail anymore: apply the new settings to the backends
+	// and algorithm instances shared with the current pools
+	for _, pool := range pools {
+		pool.Commit()
+	}
+	clientip.SetDefault(resolver)
 
-			// Proxy the request
-			proxy := httputil.NewSingleHostReverseProxy(backend.URL)
-			proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-				h.logger.Error("Proxy error", "error", err, "backend", backend.URL.String())
-				http.Error(w, "Backend error", http.StatusBadGateway)
-			}
+	h.state.Store(&state{
+		config:    config,
+		router:    router,
+		pools:     pools,
+		upstreams: upstreams,
+	})
 
-			// Add X-Forwarded headers
-			director := proxy.Director
-			proxy.Director = func(req *http.Request) {
-				director(req)
-				req.Header.Set("X-Forwarded-Host", r.Host)
-				req.Header.Set("X-Forwarded-Proto", "http")
-			}
+	for b, u := range previousUpstreams {
+		if upstreams[b] != u {
+			u.close()
+		}
+	}
+	return nil
+}
+
+// buildRouter compiles the routing rules for pools
+func (h *Handler) buildRouter(config *configs.Config, pools map[string]*serverpool.Pool) (*routing.Router, error) {
+	router, err := routing.NewRouter(config.RoutingRules, pools, h.logger)
+	if err != nil {
+		return nil, err
+	}
 
-			h.logger.Info("Proxying request", 
-				"path", r.URL.Path, 
-				"backend", backend.URL.String(),
-				"pool", pool.Name,
-			)
-			
-			proxy.ServeHTTP(w, r)
-			
-			// Decrement active connections
-			backend.DecrementConnections()
+	for _, rule := range router.Rules() {
+		h.logger.Info("Registered route", "rule", rule.String(), "priority", rule.Priority, "pool", rule.TargetPool)
+	}
+	return router, nil
+}
+
+// proxy applies the policies of the matched rule and forwards the request
+// to a backend of its pool
+func (h *Handler) proxy(w http.ResponseWriter, r *http.Request, s *state, match *routing.Match) {
+	chain := match.Policies
+	pool := match.Pool
+
+	// Apply request policies
+	if err := chain.OnRequest(r); err != nil {
+		h.logger.Warn("Policy rejected request", "path", r.URL.Path, "error", err)
+		chain.OnError(r, err)
+		h.writeError(w, err)
+		return
+	}
+
+	// Buffer the body of retried requests so it can be sent again
+	retryPolicy := match.Rule.Retry
+	if retryPolicy != nil && !retryPolicy.Allows(r.Method) {
+		retryPolicy = nil
+	}
+	if retryPolicy != nil {
+		replay, err := retry.BufferBody(r, retryPolicy.MaxBodyBytes)
+		if err != nil {
+			h.logger.Warn("Failed to read request body", "path", r.URL.Path, "error", err)
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if !replay {
+			h.logger.Debug("Request body too large to retry", "path", r.URL.Path, "limit", retryPolicy.MaxBodyBytes)
+			retryPolicy = nil
 		}
+	}
 
-		// Register route
-		route := h.router.NewRoute()
-		if rule.Match.Host != "" {
-			route = route.Host(rule.Match.Host)
+	hooks := &routeHooks{chain: chain, retry: retryPolicy, sticky: pool.Sticky}
+	var tried map[*backend.Backend]bool
+	for attempt := 1; ; attempt++ {
+		// Select a backend the request has not been sent to, waiting in
+		// line while every backend is at its connection cap
+		b, err := pool.AwaitBackend(r, tried)
+		if errors.Is(err, serverpool.ErrAtCapacity) {
+			h.logger.Warn("Backends at capacity", "pool", pool.Name, "error", err)
+			chain.OnError(r, err)
+			http.Error(w, "All backends are at capacity", http.StatusServiceUnavailable)
+			return
 		}
-		if rule.Match.Path != "" {
-			route = route.Path(rule.Match.Path)
+		if err != nil {
+			h.logger.Error("Failed to select backend", "error", err)
+			chain.OnError(r, err)
+			http.Error(w, "No backend available", http.StatusServiceUnavailable)
+			return
 		}
-		if rule.Match.Method != "" {
-			route = route.Methods(rule.Match.Method)
+
+		// Only requests that may be retried remember the backends they
+		// were sent to
+		hooks.final = retryPolicy == nil || attempt >= retryPolicy.MaxAttempts
+		if !hooks.final {
+			if tried == nil {
+				tried = make(map[*backend.Backend]bool, retryPolicy.MaxAttempts)
+			}
+			tried[b] = true
+			hooks.final = !pool.HasHealthyBackend(tried)
 		}
-		for k, v := range rule.Match.Headers {
-			route = route.HeadersRegexp(k, v)
+		hooks.err, hooks.status, hooks.failure = nil, 0, nil
+
+		h.logger.Info("Proxying request",
+			"path", r.URL.Path,
+			"rule", match.Rule.String(),
+			"backend", b.URL.String(),
+			"pool", pool.Name,
+			"attempt", attempt,
+		)
+
+		h.forward(w, r, s.upstreams[b], pool, b, hooks)
+		if hooks.err == nil {
+			return
 		}
 
-		route.HandlerFunc(handler)
-		h.logger.Info("Registered route", "host", rule.Match.Host, "path", rule.Match.Path)
+		reason := retryPolicy.Reason(hooks.err)
+		monitoring.RecordRetry(b.URL.String(), pool.Name, reason)
+		h.logger.Warn("Retrying request on another backend",
+			"path", r.URL.Path,
+			"backend", b.URL.String(),
+			"attempt", attempt,
+			"reason", reason,
+			"error", hooks.err,
+		)
 	}
+}
 
-	// Add health check endpoint
-	h.router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
+// forward sends one attempt of a request to backend b of pool, applying the
+// per-try timeout of the route
+func (h *Handler) forward(w http.ResponseWriter, r *http.Request, upstream *upstream, pool *serverpool.Pool, b *backend.Backend, hooks *routeHooks) {
+	defer pool.Release(b)
+	defer reportOutcome(b.Breaker(), hooks)
+	defer h.observe(pool, b, hooks)
+	hooks.start = time.Now()
 
-	// Add catch-all route
-	h.router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		h.logger.Info("No matching route", "path", r.URL.Path)
-		http.Error(w, "No matching route", http.StatusNotFound)
-	})
+	ctx := r.Context()
+	if hooks.retry != nil && hooks.retry.PerTryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hooks.retry.PerTryTimeout)
+		defer cancel()
+	}
+
+	req := r.WithContext(ctx)
+	if r.GetBody != nil {
+		req.Body, _ = r.GetBody()
+	}
+	upstream.ServeHTTP(w, req, hooks)
+}
+
+// observe tells the observer how an attempt went, and feeds the response
+// time back to the pool's algorithm
+func (h *Handler) observe(pool *serverpool.Pool, b *backend.Backend, hooks *routeHooks) {
+	if hooks.status > 0 {
+		pool.ObserveLatency(b, hooks.latency)
+	} else if hooks.failure != nil {
+		pool.ObserveLatency(b, failureLatency(hooks))
+	}
+	if observer := h.observer.Load(); observer != nil {
+		(*observer).Observe(pool.Name, b, hooks.status, hooks.failure, hooks.latency)
+	}
+}
+
+// failureLatency is the response time fed to the algorithm for an attempt
+// that got no response. A backend that fails or hangs must not look fast,
+// so it counts as at least the per-try timeout or failurePenalty. An
+// attempt the client cancelled took as long as the client waited.
+func failureLatency(hooks *routeHooks) time.Duration {
+	latency := time.Since(hooks.start)
+	if errors.Is(hooks.failure, context.Canceled) {
+		return latency
+	}
+
+	penalty := failurePenalty
+	if hooks.retry != nil && hooks.retry.PerTryTimeout > penalty {
+		penalty = hooks.retry.PerTryTimeout
+	}
+	return max(latency, penalty)
+}
+
+// reportOutcome tells the circuit breaker of a backend how an attempt went.
+// Responses with a 5xx status and errors before a response count as
+// failures; attempts the client cancelled count as neither.
+func reportOutcome(breaker *backend.CircuitBreaker, hooks *routeHooks) {
+	switch {
+	case hooks.status >= http.StatusInternalServerError:
+		breaker.Failure()
+	case hooks.status > 0:
+		breaker.Success()
+	case hooks.failure != nil && !errors.Is(hooks.failure, context.Canceled):
+		breaker.Failure()
+	default:
+		breaker.Release()
+	}
+}
+
+// writeError writes an error response using the status code carried by a
+// LoadBalancerError, falling back to 500 for untyped errors
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	var lbErr *lberrors.LoadBalancerError
+	if errors.As(err, &lbErr) {
+		http.Error(w, lbErr.Message, lbErr.Code)
+		return
+	}
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
 }
@@ -0,0 +1,92 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/logging"
+	"github.com/rixtrayker/go-loadbalancer/internal/retry"
+)
+
+// newTestHandler serves rules, all sent to a pool of one backend that
+// answers "backend"
+func newTestHandler(t *testing.T, rules ...configs.RoutingRuleConfig) *Handler {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "backend")
+	}))
+	t.Cleanup(upstream.Close)
+
+	config := configs.DefaultConfig()
+	config.BackendPools = []configs.BackendPoolConfig{{
+		Name:     "web",
+		Backends: []configs.BackendConfig{{URL: upstream.URL}},
+	}}
+	for i := range rules {
+		rules[i].TargetPool = "web"
+	}
+	config.RoutingRules = rules
+
+	h, err := NewHandler(config, logging.NewLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestHealthPath(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []configs.RoutingRuleConfig
+		path  string
+		want  string
+	}{
+		{name: "no rule for the path", rules: []configs.RoutingRuleConfig{{Match: configs.MatchConfig{Path: "/api/*"}}}, path: "/health", want: "OK"},
+		{name: "rule for the path", rules: []configs.RoutingRuleConfig{{Match: configs.MatchConfig{Path: "/health"}}}, path: "/health", want: "backend"},
+		{name: "catch-all rule", rules: []configs.RoutingRuleConfig{{Match: configs.MatchConfig{Path: "/*"}}}, path: "/health", want: "backend"},
+		{name: "other paths", rules: []configs.RoutingRuleConfig{{Match: configs.MatchConfig{Path: "/api/*"}}}, path: "/healthz", want: "No matching route\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, tt.rules...)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("GET %s = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailureLatency(t *testing.T) {
+	refused := errors.New("connection refused")
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		failure error
+		retry   *retry.Policy
+		want    time.Duration
+	}{
+		{name: "fast failure", elapsed: time.Millisecond, failure: refused, want: failurePenalty},
+		{name: "slow failure", elapsed: 3 * time.Second, failure: refused, want: 3 * time.Second},
+		{name: "per-try timeout", elapsed: time.Millisecond, failure: context.DeadlineExceeded, retry: &retry.Policy{PerTryTimeout: 5 * time.Second}, want: 5 * time.Second},
+		{name: "client gave up", elapsed: 2 * time.Second, failure: context.Canceled, want: 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hooks := &routeHooks{start: time.Now().Add(-tt.elapsed), failure: tt.failure, retry: tt.retry}
+			got := failureLatency(hooks)
+			if got < tt.want || got > tt.want+100*time.Millisecond {
+				t.Errorf("failureLatency() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"sync"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+	lberrors "github.com/rixtrayker/go-loadbalancer/internal/errors"
+	"github.com/rixtrayker/go-loadbalancer/internal/logging"
+	"github.com/rixtrayker/go-loadbalancer/internal/monitoring"
+	"github.com/rixtrayker/go-loadbalancer/internal/policy"
+	"github.com/rixtrayker/go-loadbalancer/internal/retry"
+	"github.com/rixtrayker/go-loadbalancer/internal/serverpool"
+)
+
+// Transport defaults, used for zero values in configs.TransportConfig
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultIdleConnTimeout     = 90 * time.Second
+	DefaultDialTimeout         = 30 * time.Second
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+	DefaultKeepAlive           = 30 * time.Second
+)
+
+// upstream is the long-lived reverse proxy and transport of one backend.
+// Route specific behaviour is passed to the proxy per request through the
+// request context.
+type upstream struct {
+	proxy     *httputil.ReverseProxy
+	transport *http.Transport
+	config    configs.TransportConfig
+	trace     *httptrace.ClientTrace
+}
+
+// routeHooksKey is the context key for the hooks of the matched route
+type routeHooksKey struct{}
+
+// routeHooks are the per-request callbacks of the matched route. When the
+// route is retried, failures of all but the final attempt are recorded in
+// err instead of being written to the client. status, failure and latency
+// record the outcome of the current attempt for the backend's circuit
+// breaker and the handler's observer. sticky, if set, pins the client to
+// the backend that answers.
+type routeHooks struct {
+	chain   *policy.Chain
+	retry   *retry.Policy
+	sticky  *serverpool.StickySessions
+	final   bool
+	err     error
+	start   time.Time
+	status  int
+	failure error
+	latency time.Duration
+}
+
+// retryable reports whether a failure of the current attempt is retried
+func (h *routeHooks) retryable() bool {
+	return h.retry != nil && !h.final
+}
+
+// hooksFrom returns the route hooks of a request
+func hooksFrom(ctx context.Context) *routeHooks {
+	hooks, _ := ctx.Value(routeHooksKey{}).(*routeHooks)
+	return hooks
+}
+
+// newUpstream creates the proxy and transport for a backend of pool
+func newUpstream(b *backend.Backend, pool string, config configs.TransportConfig, logger *logging.Logger) *upstream {
+	transport := newTransport(b, pool, config)
+
+	proxy := httputil.NewSingleHostReverseProxy(b.URL)
+	proxy.Transport = transport
+
+	// Add X-Forwarded headers
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Header.Set("X-Forwarded-Host", req.Host)
+		req.Header.Set("X-Forwarded-Proto", "http")
+	}
+
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		hooks := hooksFrom(resp.Request.Context())
+		if hooks == nil {
+			return nil
+		}
+		hooks.status = resp.StatusCode
+		hooks.latency = time.Since(hooks.start)
+		if hooks.retryable() && hooks.retry.RetryStatus(resp.StatusCode) {
+			return &retry.StatusError{Code: resp.StatusCode}
+		}
+		hooks.sticky.Stick(resp.Request, resp.Header, b)
+		return hooks.chain.OnResponse(resp)
+	}
+
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		hooks := hooksFrom(r.Context())
+		if hooks != nil {
+			hooks.failure = err
+		}
+		if hooks != nil && hooks.retryable() && hooks.retry.Reason(err) != "" {
+			// Nothing was written, leave the response to the next attempt
+			hooks.err = err
+			return
+		}
+		if hooks != nil {
+			hooks.chain.OnError(r, err)
+		}
+
+		// Errors raised by response policies carry their own status
+		var lbErr *lberrors.LoadBalancerError
+		if errors.As(err, &lbErr) {
+			logger.Warn("Policy rejected response", "path", r.URL.Path, "error", err)
+			http.Error(w, lbErr.Message, lbErr.Code)
+			return
+		}
+
+		logger.Error("Proxy error", "error", err, "backend", b.URL.String())
+		http.Error(w, "Backend error", http.StatusBadGateway)
+	}
+
+	return &upstream{
+		proxy:     proxy,
+		transport: transport,
+		config:    config,
+		trace: &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				monitoring.RecordUpstreamConnectionAcquired(b.URL.String(), pool, info.Reused)
+			},
+		},
+	}
+}
+
+// ServeHTTP proxies a request to the backend, running the hooks of the
+// matched route
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request, hooks *routeHooks) {
+	ctx := context.WithValue(r.Context(), routeHooksKey{}, hooks)
+	ctx = httptrace.WithClientTrace(ctx, u.trace)
+	u.proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// close releases the idle connections of an upstream that is no longer used.
+// Requests still in flight keep their connections.
+func (u *upstream) close() {
+	u.transport.CloseIdleConnections()
+}
+
+// newTransport creates the HTTP transport for a backend. Dialled
+// connections are tracked so open connections per backend can be monitored.
+func newTransport(b *backend.Backend, pool string, config configs.TransportConfig) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   orDefault(config.DialTimeout, DefaultDialTimeout),
+		KeepAlive: orDefault(config.KeepAlive, DefaultKeepAlive),
+	}
+	backendURL := b.URL.String()
+
+	maxIdle := config.MaxIdleConns
+	if maxIdle == 0 {
+		maxIdle = DefaultMaxIdleConns
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				monitoring.RecordConnectionError(backendURL, pool, "dial")
+				return nil, err
+			}
+			monitoring.RecordUpstreamConnection(backendURL, pool, 1)
+			return &trackedConn{Conn: conn, onClose: func() {
+				monitoring.RecordUpstreamConnection(backendURL, pool, -1)
+			}}, nil
+		},
+		MaxIdleConns:          maxIdle,
+		MaxIdleConnsPerHost:   maxIdle,
+		MaxConnsPerHost:       config.MaxConns,
+		IdleConnTimeout:       orDefault(config.IdleConnTimeout, DefaultIdleConnTimeout),
+		TLSHandshakeTimeout:   orDefault(config.TLSHandshakeTimeout, DefaultTLSHandshakeTimeout),
+		ResponseHeaderTimeout: config.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		DisableKeepAlives:     config.DisableKeepAlives,
+		ForceAttemptHTTP2:     !config.DisableHTTP2,
+	}
+	if config.DisableHTTP2 {
+		// A non-nil empty map turns off HTTP/2 negotiation
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport
+}
+
+// orDefault returns d, or def when d is zero
+func orDefault(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
+
+// trackedConn calls onClose once when the connection is closed
+type trackedConn struct {
+	net.Conn
+	once    sync.Once
+	onClose func()
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(c.onClose)
+	return c.Conn.Close()
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+func TestNewTransport(t *testing.T) {
+	b, err := backend.NewBackend("http://10.0.0.1:8080", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaults := newTransport(b, "web", configs.TransportConfig{})
+	if defaults.MaxIdleConnsPerHost != DefaultMaxIdleConns || defaults.IdleConnTimeout != DefaultIdleConnTimeout {
+		t.Errorf("defaults: max idle %d, idle timeout %v", defaults.MaxIdleConnsPerHost, defaults.IdleConnTimeout)
+	}
+	if !defaults.ForceAttemptHTTP2 || defaults.DisableKeepAlives {
+		t.Error("defaults: HTTP/2 or keep-alives disabled")
+	}
+
+	tuned := newTransport(b, "web", configs.TransportConfig{
+		MaxIdleConns:          8,
+		MaxConns:              16,
+		IdleConnTimeout:       time.Minute,
+		ResponseHeaderTimeout: 3 * time.Second,
+		DisableKeepAlives:     true,
+		DisableHTTP2:          true,
+	})
+	if tuned.MaxIdleConnsPerHost != 8 || tuned.MaxConnsPerHost != 16 || tuned.IdleConnTimeout != time.Minute {
+		t.Errorf("tuned: max idle %d, max conns %d, idle timeout %v", tuned.MaxIdleConnsPerHost, tuned.MaxConnsPerHost, tuned.IdleConnTimeout)
+	}
+	if tuned.ResponseHeaderTimeout != 3*time.Second || !tuned.DisableKeepAlives {
+		t.Errorf("tuned: response header timeout %v, keep-alives disabled %v", tuned.ResponseHeaderTimeout, tuned.DisableKeepAlives)
+	}
+	if tuned.ForceAttemptHTTP2 || tuned.TLSNextProto == nil {
+		t.Error("tuned: HTTP/2 still enabled")
+	}
+}
+
+func TestUpstreamReusesConnections(t *testing.T) {
+	var conns atomic.Int32
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	upstream.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	upstream.Start()
+	defer upstream.Close()
+
+	h := newTestHandler(t, configs.RoutingRuleConfig{})
+	config := h.Config().Clone()
+	config.BackendPools[0].Backends[0].URL = upstream.URL
+	if err := h.Apply(config); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, w.Code)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("%d connections for 5 sequential requests, want 1", n)
+	}
+}
+
+func TestApplyKeepsUpstreamsWithUnchangedTransport(t *testing.T) {
+	h := newTestHandler(t, configs.RoutingRuleConfig{})
+	b := h.Pools()["web"].Backends[0]
+	before := h.state.Load().upstreams[b]
+
+	// Unrelated changes keep the proxy and its connections
+	config := h.Config().Clone()
+	config.BackendPools[0].Algorithm = "least_conn"
+	if err := h.Apply(config); err != nil {
+		t.Fatal(err)
+	}
+	if h.state.Load().upstreams[b] != before {
+		t.Error("upstream replaced although the transport did not change")
+	}
+
+	// New transport settings need a new transport
+	config = h.Config().Clone()
+	config.BackendPools[0].Transport.MaxIdleConns = 4
+	if err := h.Apply(config); err != nil {
+		t.Fatal(err)
+	}
+	if h.state.Load().upstreams[b] == before {
+		t.Error("upstream kept although the transport changed")
+	}
+}
@@ -2,99 +2,308 @@ package healthcheck
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
 	"github.com/rixtrayker/go-loadbalancer/internal/healthcheck/probes"
 	"github.com/rixtrayker/go-loadbalancer/internal/logging"
+	"github.com/rixtrayker/go-loadbalancer/internal/monitoring"
 	"github.com/rixtrayker/go-loadbalancer/internal/serverpool"
 )
 
-// HealthChecker monitors backend health
+const (
+	// DefaultInterval is used when a pool does not set a check interval
+	DefaultInterval = 30 * time.Second
+	// DefaultHealthyThreshold is the number of consecutive successful
+	// probes needed to mark an unhealthy backend healthy
+	DefaultHealthyThreshold = 2
+	// DefaultUnhealthyThreshold is the number of consecutive failed probes
+	// needed to mark a healthy backend unhealthy
+	DefaultUnhealthyThreshold = 3
+)
+
+// HealthChecker monitors backend health, actively through probes and
+// passively through the responses of proxied requests. It lives across
+// configuration changes: Update starts checking added backends and pools,
+// stops checking removed ones and reconfigures the rest, which keep their
+// probe counters and outlier statistics.
 type HealthChecker struct {
-	pools      map[string]*serverpool.Pool
-	configs    map[string]configs.HealthCheckConfig
-	probes     map[string]probes.Probe
-	logger     *logging.Logger
-	stopCh     chan struct{}
+	logger *logging.Logger
+	wg     sync.WaitGroup
+
+	mutex      sync.Mutex
+	ctx        context.Context
 	cancelFunc context.CancelFunc
+	targets    map[*backend.Backend]*target
+	detectors  map[string]*outlierDetector
+
+	// outliers is a copy of detectors read by Observe without locking
+	outliers atomic.Pointer[map[string]*outlierDetector]
 }
 
-// NewHealthChecker creates a new health checker
+// target is a single backend being probed. Its settings change when the
+// pool is reconfigured; the counters belong to its goroutine.
+type target struct {
+	backend *backend.Backend
+	cancel  context.CancelFunc
+
+	mutex  sync.Mutex
+	pool   string
+	probe  probes.Probe
+	config configs.HealthCheckConfig
+
+	successes int
+	failures  int
+}
+
+// NewHealthChecker creates a new health checker for pools
 func NewHealthChecker(
 	pools map[string]*serverpool.Pool,
 	configs map[string]configs.HealthCheckConfig,
 	logger *logging.Logger,
 ) *HealthChecker {
-	return &HealthChecker{
-		pools:   pools,
-		configs: configs,
-		probes:  make(map[string]probes.Probe),
-		logger:  logger,
-		stopCh:  make(chan struct{}),
+	hc := &HealthChecker{
+		logger:    logger,
+		targets:   make(map[*backend.Backend]*target),
+		detectors: make(map[string]*outlierDetector),
 	}
+	hc.Update(pools, configs)
+	return hc
 }
 
-// Start begins health checking
-func (hc *HealthChecker) Start(ctx context.Context) {
-	ctx, hc.cancelFunc = context.WithCancel(ctx)
+// Update checks the backends of pools with configs from now on. Backends
+// are identified by their instance, which rebuilt pools share with the
+// pools they replace. Update never waits for running probes.
+func (hc *HealthChecker) Update(pools map[string]*serverpool.Pool, configs map[string]configs.HealthCheckConfig) {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
 
-	// Create probes for each backend
-	for poolName, pool := range hc.pools {
-		config, ok := hc.configs[poolName]
+	targets := make(map[*backend.Backend]*target)
+	detectors := make(map[string]*outlierDetector)
+	for poolName, pool := range pools {
+		config, ok := configs[poolName]
 		if !ok {
 			hc.logger.Warn("No health check config for pool", "pool", poolName)
 			continue
 		}
+		applyDefaults(&config)
 
-		for _, backend := range pool.Backends {
-			var probe probes.Probe
-			switch {
-			case config.Path != "":
-				probe = probes.NewHTTPProbe(backend.URL, config.Path, config.Method, config.Timeout)
-			default:
-				probe = probes.NewTCPProbe(backend.URL, config.Timeout)
+		for _, b := range pool.Backends {
+			t, ok := hc.targets[b]
+			if !ok {
+				t = &target{backend: b}
+				monitoring.RecordBackendHealth(b.URL.String(), poolName, b.IsHealthy())
+			}
+			t.configure(poolName, config)
+			if !ok {
+				hc.start(t)
 			}
+			targets[b] = t
+		}
 
-			backendURL := backend.URL.String()
-			hc.probes[backendURL] = probe
+		if !outlierEnabled(config.OutlierDetection) {
+			continue
+		}
+		d, ok := hc.detectors[poolName]
+		if ok {
+			d.configure(pool, config.OutlierDetection)
+		} else {
+			d = newOutlierDetector(pool, config.OutlierDetection, hc.logger)
+			hc.startDetector(d)
+		}
+		detectors[poolName] = d
+	}
 
-			// Start health check for this backend
-			go hc.checkBackend(ctx, pool, backend.URL.String(), config.Interval)
+	for b, t := range hc.targets {
+		if _, ok := targets[b]; !ok && t.cancel != nil {
+			t.cancel()
+		}
+	}
+	for poolName, d := range hc.detectors {
+		if _, ok := detectors[poolName]; !ok && d.cancel != nil {
+			d.cancel()
 		}
 	}
+
+	hc.targets = targets
+	hc.detectors = detectors
+	outliers := make(map[string]*outlierDetector, len(detectors))
+	for poolName, d := range detectors {
+		outliers[poolName] = d
+	}
+	hc.outliers.Store(&outliers)
+}
+
+// Start begins health checking
+func (hc *HealthChecker) Start(ctx context.Context) {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	hc.ctx, hc.cancelFunc = context.WithCancel(ctx)
+	for _, t := range hc.targets {
+		hc.start(t)
+	}
+	for _, d := range hc.detectors {
+		hc.startDetector(d)
+	}
+}
+
+// start starts probing a backend once the checker runs. The caller must
+// hold hc.mutex.
+func (hc *HealthChecker) start(t *target) {
+	if hc.ctx == nil {
+		return
+	}
+	var ctx context.Context
+	ctx, t.cancel = context.WithCancel(hc.ctx)
+	hc.wg.Add(1)
+	go hc.checkBackend(ctx, t)
+}
+
+// startDetector starts the outlier detection of a pool once the checker
+// runs. The caller must hold hc.mutex.
+func (hc *HealthChecker) startDetector(d *outlierDetector) {
+	if hc.ctx == nil {
+		return
+	}
+	var ctx context.Context
+	ctx, d.cancel = context.WithCancel(hc.ctx)
+	hc.wg.Add(1)
+	go func() {
+		defer hc.wg.Done()
+		d.run(ctx)
+	}()
+}
+
+// Observe feeds the outcome of a request proxied to a backend of pool to
+// outlier detection. status is 0 when the request failed before a response
+// arrived, with err telling why.
+func (hc *HealthChecker) Observe(pool string, b *backend.Backend, status int, err error, latency time.Duration) {
+	outliers := hc.outliers.Load()
+	if outliers == nil {
+		return
+	}
+	if d, ok := (*outliers)[pool]; ok {
+		d.observe(b, status, err, latency)
+	}
 }
 
-// Stop stops health checking
+// Stop stops health checking and waits for running probes to finish
 func (hc *HealthChecker) Stop() {
+	hc.mutex.Lock()
 	if hc.cancelFunc != nil {
 		hc.cancelFunc()
 	}
-	close(hc.stopCh)
+	hc.ctx = nil
+	hc.mutex.Unlock()
+
+	hc.wg.Wait()
 }
 
-// checkBackend periodically checks a backend's health
-func (hc *HealthChecker) checkBackend(ctx context.Context, pool *serverpool.Pool, backendURL string, interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// checkBackend periodically checks a backend's health. A new interval takes
+// effect after the current one.
+func (hc *HealthChecker) checkBackend(ctx context.Context, t *target) {
+	defer hc.wg.Done()
 
-	probe, ok := hc.probes[backendURL]
-	if !ok {
-		hc.logger.Error("No probe found for backend", "backend", backendURL)
-		return
-	}
+	// Probe once right away so dead backends are found without waiting a
+	// full interval
+	hc.probe(ctx, t)
+
+	timer := time.NewTimer(t.settings().config.Interval)
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			healthy := probe.Check()
-			pool.MarkBackendStatus(backendURL, healthy)
+		case <-timer.C:
+			hc.probe(ctx, t)
+			timer.Reset(t.settings().config.Interval)
+		}
+	}
+}
 
-			if !healthy {
-				hc.logger.Warn("Backend is unhealthy", "backend", backendURL)
-			}
+// probe runs a single check and applies the rise/fall thresholds. The
+// result of a probe that outlived its backend's removal is dropped.
+func (hc *HealthChecker) probe(ctx context.Context, t *target) {
+	settings := t.settings()
+	backendURL := t.backend.URL.String()
+	wasHealthy := t.backend.IsHealthy()
+
+	ok := settings.probe.Check()
+	if ctx.Err() != nil {
+		return
+	}
+
+	if ok {
+		t.failures = 0
+		t.successes++
+		if wasHealthy || t.successes < settings.config.HealthyThreshold {
+			return
+		}
+	} else {
+		t.successes = 0
+		t.failures++
+		if !wasHealthy || t.failures < settings.config.UnhealthyThreshold {
+			return
+		}
+	}
+
+	healthy := !wasHealthy
+	t.backend.SetHealth(healthy)
+	monitoring.RecordBackendHealth(backendURL, settings.pool, healthy)
+
+	if healthy {
+		hc.logger.Info("Backend is healthy", "backend", backendURL, "pool", settings.pool, "successes", t.successes)
+	} else {
+		hc.logger.Warn("Backend is unhealthy", "backend", backendURL, "pool", settings.pool, "failures", t.failures)
+	}
+}
+
+// targetSettings are the settings a probe runs with
+type targetSettings struct {
+	pool   string
+	probe  probes.Probe
+	config configs.HealthCheckConfig
+}
+
+// settings returns the current settings of the target
+func (t *target) settings() targetSettings {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return targetSettings{pool: t.pool, probe: t.probe, config: t.config}
+}
+
+// configure sets the pool and health check config of the target, replacing
+// its probe only when the probe settings changed
+func (t *target) configure(pool string, config configs.HealthCheckConfig) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.probe == nil || config.Path != t.config.Path || config.Method != t.config.Method || config.Timeout != t.config.Timeout {
+		switch {
+		case config.Path != "":
+			t.probe = probes.NewHTTPProbe(t.backend.URL, config.Path, config.Method, config.Timeout)
+		default:
+			t.probe = probes.NewTCPProbe(t.backend.URL, config.Timeout)
 		}
 	}
+	t.pool = pool
+	t.config = config
+}
+
+// applyDefaults fills in unset health check parameters
+func applyDefaults(config *configs.HealthCheckConfig) {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.HealthyThreshold <= 0 {
+		config.HealthyThreshold = DefaultHealthyThreshold
+	}
+	if config.UnhealthyThreshold <= 0 {
+		config.UnhealthyThreshold = DefaultUnhealthyThreshold
+	}
 }
@@ -0,0 +1,152 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/logging"
+	"github.com/rixtrayker/go-loadbalancer/internal/serverpool"
+)
+
+// newTestPool creates a round robin pool of n backends
+func newTestPool(t *testing.T, n int) *serverpool.Pool {
+	t.Helper()
+	config := configs.BackendPoolConfig{Name: "checked", Algorithm: "round_robin"}
+	for i := 0; i < n; i++ {
+		config.Backends = append(config.Backends, configs.BackendConfig{
+			URL:    fmt.Sprintf("http://10.0.0.%d:8080", i+1),
+			Weight: 1,
+		})
+	}
+	pool, err := serverpool.NewPool(config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+// scriptedProbe returns its results in order
+type scriptedProbe struct {
+	results []bool
+}
+
+func (p *scriptedProbe) Check() bool {
+	result := p.results[0]
+	p.results = p.results[1:]
+	return result
+}
+
+func TestProbeThresholds(t *testing.T) {
+	tests := []struct {
+		name    string
+		healthy bool
+		results []bool
+		want    []bool // health after each probe
+	}{
+		{
+			name:    "falls after three failures",
+			healthy: true,
+			results: []bool{false, false, false},
+			want:    []bool{true, true, false},
+		},
+		{
+			name:    "success resets failures",
+			healthy: true,
+			results: []bool{false, false, true, false, false},
+			want:    []bool{true, true, true, true, true},
+		},
+		{
+			name:    "rises after two successes",
+			healthy: false,
+			results: []bool{true, true},
+			want:    []bool{false, true},
+		},
+		{
+			name:    "failure resets successes",
+			healthy: false,
+			results: []bool{true, false, true},
+			want:    []bool{false, false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := newTestPool(t, 1)
+			b := pool.Backends[0]
+			pool.MarkBackendStatus(b.URL.String(), tt.healthy)
+
+			config := configs.HealthCheckConfig{}
+			applyDefaults(&config)
+			hc := &HealthChecker{logger: logging.NewLogger()}
+			target := &target{backend: b}
+			target.configure(pool.Name, config)
+			target.probe = &scriptedProbe{results: tt.results}
+
+			for i, want := range tt.want {
+				hc.probe(context.Background(), target)
+				if got := b.IsHealthy(); got != want {
+					t.Fatalf("healthy after probe %d = %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateKeepsCheckers(t *testing.T) {
+	pool := newTestPool(t, 2)
+	config := configs.HealthCheckConfig{
+		Interval:         time.Hour,
+		OutlierDetection: configs.OutlierDetectionConfig{Consecutive5xx: 3},
+	}
+	hc := NewHealthChecker(map[string]*serverpool.Pool{pool.Name: pool},
+		map[string]configs.HealthCheckConfig{pool.Name: config}, logging.NewLogger())
+	hc.Start(context.Background())
+	defer hc.Stop()
+
+	kept, removed := pool.Backends[0], pool.Backends[1]
+	checker := hc.targets[kept]
+	detector := hc.detectors[pool.Name]
+	hc.Observe(pool.Name, kept, http.StatusInternalServerError, nil, time.Millisecond)
+	hc.Observe(pool.Name, kept, http.StatusInternalServerError, nil, time.Millisecond)
+
+	// Rebuild the pool without the second backend and with a new one, and
+	// change the thresholds
+	poolConfig := configs.BackendPoolConfig{Name: pool.Name, Algorithm: "round_robin"}
+	for _, url := range []string{kept.URL.String(), "http://10.0.0.9:8080"} {
+		poolConfig.Backends = append(poolConfig.Backends, configs.BackendConfig{URL: url, Weight: 1})
+	}
+	rebuilt, err := pool.Rebuild(poolConfig, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebuilt.Commit()
+	config.UnhealthyThreshold = 5
+	hc.Update(map[string]*serverpool.Pool{pool.Name: rebuilt},
+		map[string]configs.HealthCheckConfig{pool.Name: config})
+
+	if hc.targets[kept] != checker {
+		t.Error("checker of the kept backend replaced")
+	}
+	if got := checker.settings().config.UnhealthyThreshold; got != 5 {
+		t.Errorf("unhealthy threshold %d, want 5", got)
+	}
+	if _, ok := hc.targets[removed]; ok {
+		t.Error("removed backend still checked")
+	}
+	if _, ok := hc.targets[rebuilt.Backends[1]]; !ok {
+		t.Error("added backend not checked")
+	}
+	if hc.detectors[pool.Name] != detector {
+		t.Fatal("outlier detector replaced")
+	}
+
+	// The consecutive errors from before the update still count
+	hc.Observe(pool.Name, kept, http.StatusInternalServerError, nil, time.Millisecond)
+	if !kept.IsEjected() {
+		t.Error("third consecutive 5xx did not eject the backend")
+	}
+}
@@ -0,0 +1,316 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+	"github.com/rixtrayker/go-loadbalancer/internal/logging"
+	"github.com/rixtrayker/go-loadbalancer/internal/monitoring"
+	"github.com/rixtrayker/go-loadbalancer/internal/serverpool"
+)
+
+const (
+	// DefaultOutlierInterval is how often latency outliers are looked for
+	DefaultOutlierInterval = 10 * time.Second
+	// DefaultLatencyMinRequests is the number of responses a backend needs
+	// within an interval before its latency is compared
+	DefaultLatencyMinRequests = 10
+	// DefaultBaseEjectionTime is how long a first ejection lasts
+	DefaultBaseEjectionTime = 30 * time.Second
+	// DefaultMaxEjectionTime caps the ejection time of repeat outliers
+	DefaultMaxEjectionTime = 300 * time.Second
+	// DefaultMaxEjectionPercent is the share of a pool that may be ejected
+	// at once, counting backends that are down for any reason. The share is
+	// rounded up to one backend, but the last available one is never ejected.
+	DefaultMaxEjectionPercent = 10
+)
+
+// minLatencyBackends is the number of backends with enough responses needed
+// for a meaningful pool median
+const minLatencyBackends = 3
+
+// outlierDetector ejects the backends of a pool whose live responses stand
+// out from the rest. It outlives rebuilds of its pool, which configure
+// replaces.
+type outlierDetector struct {
+	logger *logging.Logger
+	cancel context.CancelFunc
+
+	mutex   sync.Mutex
+	pool    *serverpool.Pool
+	config  configs.OutlierDetectionConfig
+	stats   map[*backend.Backend]*outlierStats
+	ejected map[*backend.Backend]bool
+}
+
+// outlierStats are the observations of one backend
+type outlierStats struct {
+	consecutive5xx     int
+	consecutiveGateway int
+	latency            time.Duration
+	responses          int
+}
+
+// outlierEnabled reports whether config enables any trigger
+func outlierEnabled(config configs.OutlierDetectionConfig) bool {
+	return config.Consecutive5xx > 0 || config.ConsecutiveGatewayErrors > 0 || config.LatencyFactor > 0
+}
+
+// newOutlierDetector creates an outlier detector for a pool
+func newOutlierDetector(pool *serverpool.Pool, config configs.OutlierDetectionConfig, logger *logging.Logger) *outlierDetector {
+	applyOutlierDefaults(&config)
+	d := &outlierDetector{
+		pool:    pool,
+		config:  config,
+		logger:  logger,
+		stats:   make(map[*backend.Backend]*outlierStats),
+		ejected: make(map[*backend.Backend]bool),
+	}
+
+	// Ejections outlive the detector of a pool whose outlier detection was
+	// turned off and on again, so pick up the ones still running
+	for _, b := range pool.Backends {
+		if b.IsEjected() {
+			d.ejected[b] = true
+		}
+	}
+	return d
+}
+
+// configure replaces the pool and settings of the detector, forgetting the
+// backends that left the pool
+func (d *outlierDetector) configure(pool *serverpool.Pool, config configs.OutlierDetectionConfig) {
+	applyOutlierDefaults(&config)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.pool = pool
+	d.config = config
+	members := make(map[*backend.Backend]bool, len(pool.Backends))
+	for _, b := range pool.Backends {
+		members[b] = true
+	}
+	for b := range d.stats {
+		if !members[b] {
+			delete(d.stats, b)
+		}
+	}
+	for b := range d.ejected {
+		if !members[b] {
+			delete(d.ejected, b)
+		}
+	}
+}
+
+// observe records the outcome of a proxied request. status is 0 when the
+// request failed before a response arrived, with err telling why.
+func (d *outlierDetector) observe(b *backend.Backend, status int, err error, latency time.Duration) {
+	if status == 0 && (err == nil || errors.Is(err, context.Canceled)) {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	stats, ok := d.stats[b]
+	if !ok {
+		stats = &outlierStats{}
+		d.stats[b] = stats
+	}
+
+	// Errors before a response count as gateway errors, and so as 5xx
+	gateway := status == 0 || status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+	switch {
+	case gateway:
+		stats.consecutive5xx++
+		stats.consecutiveGateway++
+	case status >= http.StatusInternalServerError:
+		stats.consecutive5xx++
+		stats.consecutiveGateway = 0
+	default:
+		stats.consecutive5xx = 0
+		stats.consecutiveGateway = 0
+		stats.latency += latency
+		stats.responses++
+	}
+
+	switch {
+	case d.config.Consecutive5xx > 0 && stats.consecutive5xx >= d.config.Consecutive5xx:
+		d.eject(b, "consecutive_5xx")
+	case d.config.ConsecutiveGatewayErrors > 0 && stats.consecutiveGateway >= d.config.ConsecutiveGatewayErrors:
+		d.eject(b, "consecutive_gateway_errors")
+	}
+}
+
+// run checks latencies and returns ejected backends to rotation every
+// interval until ctx is done. A new interval takes effect after the current
+// one.
+func (d *outlierDetector) run(ctx context.Context) {
+	timer := time.NewTimer(d.interval())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			d.sweep()
+			timer.Reset(d.interval())
+		}
+	}
+}
+
+// interval returns the current sweep interval
+func (d *outlierDetector) interval() time.Duration {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.config.Interval
+}
+
+// sweep ends expired ejections, ejects latency outliers and starts a new
+// interval
+func (d *outlierDetector) sweep() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, b := range d.pool.Backends {
+		if b.IsEjected() {
+			continue
+		}
+		if d.ejected[b] {
+			delete(d.ejected, b)
+			monitoring.RecordOutlierEjected(b.URL.String(), d.pool.Name, false)
+			d.logger.Info("Outlier backend returned to rotation", "backend", b.URL.String(), "pool", d.pool.Name)
+		} else {
+			b.ForgiveEjection()
+		}
+	}
+
+	if d.config.LatencyFactor > 0 {
+		d.ejectSlow()
+	}
+
+	for _, stats := range d.stats {
+		stats.latency = 0
+		stats.responses = 0
+	}
+}
+
+// ejectSlow ejects backends whose mean latency in the interval is more than
+// LatencyFactor times the pool median
+func (d *outlierDetector) ejectSlow() {
+	means := make(map[*backend.Backend]time.Duration)
+	var all []time.Duration
+	for b, stats := range d.stats {
+		if stats.responses < d.config.LatencyMinRequests || b.IsEjected() {
+			continue
+		}
+		mean := stats.latency / time.Duration(stats.responses)
+		means[b] = mean
+		all = append(all, mean)
+	}
+	if len(all) < minLatencyBackends {
+		return
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	median := all[len(all)/2]
+	if len(all)%2 == 0 {
+		median = (all[len(all)/2-1] + all[len(all)/2]) / 2
+	}
+
+	limit := time.Duration(float64(median) * d.config.LatencyFactor)
+	for b, mean := range means {
+		if mean > limit {
+			d.logger.Warn("Backend latency is an outlier", "backend", b.URL.String(), "pool", d.pool.Name, "latency", mean, "median", median)
+			d.eject(b, "latency")
+		}
+	}
+}
+
+// eject takes a backend out of rotation unless the pool's ejection cap is
+// reached. The caller must hold d.mutex.
+func (d *outlierDetector) eject(b *backend.Backend, reason string) {
+	if b.IsEjected() {
+		return
+	}
+
+	backendURL := b.URL.String()
+	if !d.canEject(b) {
+		d.logger.Warn("Outlier backend not ejected, pool ejection limit reached",
+			"backend", backendURL,
+			"pool", d.pool.Name,
+			"reason", reason,
+		)
+		return
+	}
+
+	duration := b.Eject(d.config.BaseEjectionTime, d.config.MaxEjectionTime)
+	d.ejected[b] = true
+	if stats, ok := d.stats[b]; ok {
+		*stats = outlierStats{}
+	}
+
+	monitoring.RecordOutlierEjection(backendURL, d.pool.Name, reason)
+	monitoring.RecordOutlierEjected(backendURL, d.pool.Name, true)
+	d.logger.Warn("Ejected outlier backend",
+		"backend", backendURL,
+		"pool", d.pool.Name,
+		"reason", reason,
+		"duration", duration,
+	)
+}
+
+// canEject reports whether target may be ejected. Backends that are
+// already out of rotation, whether ejected, unhealthy or with an open
+// circuit, count towards the pool's ejection cap, and the last available
+// backend is never ejected.
+func (d *outlierDetector) canEject(target *backend.Backend) bool {
+	total := len(d.pool.Backends)
+	limit := total * d.config.MaxEjectionPercent / 100
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > total-1 {
+		limit = total - 1
+	}
+
+	var available, down int
+	for _, b := range d.pool.Backends {
+		switch {
+		case b == target:
+		case b.IsAvailable():
+			available++
+		default:
+			down++
+		}
+	}
+	return available > 0 && down < limit
+}
+
+// applyOutlierDefaults fills in unset outlier detection parameters
+func applyOutlierDefaults(config *configs.OutlierDetectionConfig) {
+	if config.Interval <= 0 {
+		config.Interval = DefaultOutlierInterval
+	}
+	if config.LatencyMinRequests <= 0 {
+		config.LatencyMinRequests = DefaultLatencyMinRequests
+	}
+	if config.BaseEjectionTime <= 0 {
+		config.BaseEjectionTime = DefaultBaseEjectionTime
+	}
+	if config.MaxEjectionTime <= 0 {
+		config.MaxEjectionTime = DefaultMaxEjectionTime
+	}
+	if config.MaxEjectionPercent <= 0 {
+		config.MaxEjectionPercent = DefaultMaxEjectionPercent
+	}
+}
@@ -0,0 +1,138 @@
+package healthcheck
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/logging"
+)
+
+// newTestDetector creates an outlier detector for a pool of n backends
+func newTestDetector(t *testing.T, n int, config configs.OutlierDetectionConfig) *outlierDetector {
+	t.Helper()
+	return newOutlierDetector(newTestPool(t, n), config, logging.NewLogger())
+}
+
+func TestCanEject(t *testing.T) {
+	tests := []struct {
+		name               string
+		backends           int
+		unhealthy          int
+		maxEjectionPercent int
+		want               int // backends left available
+	}{
+		{name: "single backend is never ejected", backends: 1, want: 1},
+		{name: "one of two by default", backends: 2, want: 1},
+		{name: "one of two at 100 percent", backends: 2, maxEjectionPercent: 100, want: 1},
+		{name: "one of ten by default", backends: 10, want: 9},
+		{name: "half of ten", backends: 10, maxEjectionPercent: 50, want: 5},
+		{name: "all but one of ten", backends: 10, maxEjectionPercent: 100, want: 1},
+		{name: "last available of three", backends: 3, unhealthy: 2, want: 1},
+		{name: "last available at 100 percent", backends: 2, unhealthy: 1, maxEjectionPercent: 100, want: 1},
+		{name: "unhealthy count towards the cap", backends: 10, unhealthy: 3, maxEjectionPercent: 50, want: 5},
+		{name: "unhealthy fill the cap", backends: 10, unhealthy: 2, want: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDetector(t, tt.backends, configs.OutlierDetectionConfig{
+				Consecutive5xx:     1,
+				MaxEjectionPercent: tt.maxEjectionPercent,
+			})
+			for _, b := range d.pool.Backends[:tt.unhealthy] {
+				d.pool.MarkBackendStatus(b.URL.String(), false)
+			}
+			for _, b := range d.pool.Backends {
+				d.observe(b, http.StatusInternalServerError, nil, time.Millisecond)
+			}
+
+			available := 0
+			for _, b := range d.pool.Backends {
+				if b.IsAvailable() {
+					available++
+				}
+			}
+			if available != tt.want {
+				t.Errorf("%d backends available, want %d", available, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutlierTriggers(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   configs.OutlierDetectionConfig
+		statuses []int // 0 is a failed request
+		want     bool
+	}{
+		{
+			name:     "consecutive 5xx",
+			config:   configs.OutlierDetectionConfig{Consecutive5xx: 3},
+			statuses: []int{500, 502, 500},
+			want:     true,
+		},
+		{
+			name:     "success resets 5xx",
+			config:   configs.OutlierDetectionConfig{Consecutive5xx: 3},
+			statuses: []int{500, 500, 200, 500},
+		},
+		{
+			name:     "consecutive gateway errors",
+			config:   configs.OutlierDetectionConfig{ConsecutiveGatewayErrors: 2},
+			statuses: []int{0, 503},
+			want:     true,
+		},
+		{
+			name:     "500 resets gateway errors",
+			config:   configs.OutlierDetectionConfig{ConsecutiveGatewayErrors: 2},
+			statuses: []int{502, 500, 504},
+		},
+		{
+			name:     "4xx is not an error",
+			config:   configs.OutlierDetectionConfig{Consecutive5xx: 1},
+			statuses: []int{404, 429},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDetector(t, 2, tt.config)
+			b := d.pool.Backends[0]
+			for _, status := range tt.statuses {
+				var err error
+				if status == 0 {
+					err = errors.New("connection refused")
+				}
+				d.observe(b, status, err, time.Millisecond)
+			}
+			if got := b.IsEjected(); got != tt.want {
+				t.Errorf("ejected = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutlierLatency(t *testing.T) {
+	d := newTestDetector(t, 4, configs.OutlierDetectionConfig{
+		LatencyFactor:      2,
+		LatencyMinRequests: 2,
+		MaxEjectionPercent: 100,
+	})
+	latencies := []time.Duration{10, 12, 11, 50}
+	for i, b := range d.pool.Backends {
+		for j := 0; j < 2; j++ {
+			d.observe(b, http.StatusOK, nil, latencies[i]*time.Millisecond)
+		}
+	}
+	d.sweep()
+
+	for i, b := range d.pool.Backends {
+		if want := i == 3; b.IsEjected() != want {
+			t.Errorf("backend %d ejected = %v, want %v", i, b.IsEjected(), want)
+		}
+	}
+}
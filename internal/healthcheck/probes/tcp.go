@@ -26,11 +26,8 @@ func NewTCPProbe(url *url.URL, timeout time.Duration) *TCPProbe {
 
 // Check performs a health check
 func (p *TCPProbe) Check() bool {
-	// Get host and port
-	host := p.url.Host
-
 	// Connect to host
-	conn, err := net.DialTimeout("tcp", host, p.timeout)
+	conn, err := net.DialTimeout("tcp", address(p.url), p.timeout)
 	if err != nil {
 		return false
 	}
@@ -38,3 +35,16 @@ func (p *TCPProbe) Check() bool {
 
 	return true
 }
+
+// address returns the host and port of u, taking the port from the scheme
+// when the URL has none
+func address(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return u.Host
+	}
+	port := "80"
+	if u.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
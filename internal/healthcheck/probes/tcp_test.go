@@ -0,0 +1,60 @@
+package probes
+
+import (
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "http://api.internal", want: "api.internal:80"},
+		{url: "https://api.internal", want: "api.internal:443"},
+		{url: "http://api.internal:8080", want: "api.internal:8080"},
+		{url: "http://[::1]", want: "[::1]:80"},
+		{url: "https://[::1]:8443", want: "[::1]:8443"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := address(u); got != tt.want {
+				t.Errorf("address(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTCPProbeCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	u := &url.URL{Scheme: "http", Host: listener.Addr().String()}
+	if !NewTCPProbe(u, time.Second).Check() {
+		t.Error("probe of a listening backend failed")
+	}
+
+	listener.Close()
+	if NewTCPProbe(u, time.Second).Check() {
+		t.Error("probe of a closed backend passed")
+	}
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/rixtrayker/go-loadbalancer/internal/logging"
@@ -37,7 +38,7 @@ func MonitoringMiddleware(next http.Handler) http.Handler {
 
 		// Record metrics
 		duration := time.Since(start)
-		monitoring.RecordRequestMetrics(r.Method, r.URL.Path, string(rw.statusCode), duration)
+		monitoring.RecordRequestMetrics(r.Method, r.URL.Path, strconv.Itoa(rw.statusCode), duration)
 	})
 }
 
@@ -3,6 +3,7 @@ package monitoring
 import (
 	"context"
 	"runtime"
+	"strconv"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -55,6 +56,79 @@ var (
 		[]string{"backend", "pool", "error_type"},
 	)
 
+	BackendCircuitState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "loadbalancer_backend_circuit_state",
+			Help: "Circuit breaker state of backend servers (0 = closed, 1 = open, 2 = half-open)",
+		},
+		[]string{"backend", "pool"},
+	)
+
+	OutlierEjections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "loadbalancer_outlier_ejections_total",
+			Help: "Total number of backends ejected as outliers, by trigger",
+		},
+		[]string{"backend", "pool", "reason"},
+	)
+
+	OutlierEjected = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "loadbalancer_outlier_ejected",
+			Help: "Whether a backend is ejected as an outlier (1 = ejected, 0 = in rotation)",
+		},
+		[]string{"backend", "pool"},
+	)
+
+	BackendRetries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "loadbalancer_backend_retries_total",
+			Help: "Total number of requests retried on another backend, by retry condition",
+		},
+		[]string{"backend", "pool", "reason"},
+	)
+
+	ZoneRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "loadbalancer_zone_requests_total",
+			Help: "Total number of requests sent from the zone of the load balancer to backends in each zone",
+		},
+		[]string{"pool", "source_zone", "zone"},
+	)
+
+	ZoneSpillover = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "loadbalancer_zone_spillover",
+			Help: "Whether requests spill over from the local zone to other zones (1 = spilling, 0 = local only)",
+		},
+		[]string{"pool", "zone"},
+	)
+
+	QueueDepth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "loadbalancer_queue_depth",
+			Help: "Number of requests waiting for a backend below its connection cap",
+		},
+		[]string{"pool"},
+	)
+
+	QueueWait = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "loadbalancer_queue_wait_seconds",
+			Help:    "Time requests waited in the queue, by outcome",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+		[]string{"pool", "outcome"},
+	)
+
+	QueueRejections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "loadbalancer_queue_rejections_total",
+			Help: "Total number of requests rejected because every backend was at its connection cap, by reason",
+		},
+		[]string{"pool", "reason"},
+	)
+
 	// Policy metrics
 	PolicyViolations = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -89,6 +163,22 @@ var (
 		[]string{"backend", "pool", "error_type"},
 	)
 
+	UpstreamOpenConnections = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "loadbalancer_upstream_open_connections",
+			Help: "Number of open connections to backend servers",
+		},
+		[]string{"backend", "pool"},
+	)
+
+	UpstreamConnectionsAcquired = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "loadbalancer_upstream_connections_acquired_total",
+			Help: "Total number of connections acquired for backend requests, by whether an idle connection was reused",
+		},
+		[]string{"backend", "pool", "reused"},
+	)
+
 	// System metrics
 	MemoryUsage = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -213,11 +303,115 @@ func RecordBackendMetrics(backend, pool string, healthy bool, responseTime time.
 	BackendResponseTime.WithLabelValues(backend, pool).Observe(responseTime.Seconds())
 }
 
+// RecordBackendHealth records the health status of a backend
+func RecordBackendHealth(backend, pool string, healthy bool) {
+	var healthStatus float64
+	if healthy {
+		healthStatus = 1
+	}
+	BackendHealthStatus.WithLabelValues(backend, pool).Set(healthStatus)
+}
+
 // RecordBackendError records a backend error
 func RecordBackendError(backend, pool, errorType string) {
 	BackendErrors.WithLabelValues(backend, pool, errorType).Inc()
 }
 
+// RecordCircuitBreakerState records the circuit breaker state of a backend:
+// 0 closed, 1 open, 2 half-open
+func RecordCircuitBreakerState(backend, pool string, state int) {
+	BackendCircuitState.WithLabelValues(backend, pool).Set(float64(state))
+}
+
+// RecordOutlierEjection records a backend being ejected as an outlier
+func RecordOutlierEjection(backend, pool, reason string) {
+	OutlierEjections.WithLabelValues(backend, pool, reason).Inc()
+}
+
+// RecordOutlierEjected records whether a backend is ejected as an outlier
+func RecordOutlierEjected(backend, pool string, ejected bool) {
+	var ejectedStatus float64
+	if ejected {
+		ejectedStatus = 1
+	}
+	OutlierEjected.WithLabelValues(backend, pool).Set(ejectedStatus)
+}
+
+// RecordRetry records a request to backend that is retried on another
+// backend of pool
+func RecordRetry(backend, pool, reason string) {
+	BackendRetries.WithLabelValues(backend, pool, reason).Inc()
+}
+
+// RecordZoneRequest records a request sent from the load balancer's zone to
+// a backend in zone
+func RecordZoneRequest(pool, sourceZone, zone string) {
+	ZoneRequests.WithLabelValues(pool, sourceZone, zone).Inc()
+}
+
+// ZoneRequestCounter returns the counter RecordZoneRequest increments, for
+// callers that resolve it once rather than on every request
+func ZoneRequestCounter(pool, sourceZone, zone string) prometheus.Counter {
+	return ZoneRequests.WithLabelValues(pool, sourceZone, zone)
+}
+
+// RecordZoneSpillover records whether requests of pool spill over from the
+// local zone
+func RecordZoneSpillover(pool, zone string, spilling bool) {
+	SetZoneSpillover(ZoneSpillover.WithLabelValues(pool, zone), spilling)
+}
+
+// ZoneSpilloverGauge returns the gauge RecordZoneSpillover sets, for callers
+// that resolve it once and update it with SetZoneSpillover
+func ZoneSpilloverGauge(pool, zone string) prometheus.Gauge {
+	return ZoneSpillover.WithLabelValues(pool, zone)
+}
+
+// SetZoneSpillover records on a gauge of ZoneSpilloverGauge whether
+// requests spill over from the local zone
+func SetZoneSpillover(gauge prometheus.Gauge, spilling bool) {
+	var spillingStatus float64
+	if spilling {
+		spillingStatus = 1
+	}
+	gauge.Set(spillingStatus)
+}
+
+// RecordQueueDepth records the number of requests waiting in the queue of
+// pool
+func RecordQueueDepth(pool string, depth int) {
+	QueueDepth.WithLabelValues(pool).Set(float64(depth))
+}
+
+// RecordQueueWait records how long a request waited in the queue of pool
+// and how the wait ended
+func RecordQueueWait(pool, outcome string, wait time.Duration) {
+	QueueWait.WithLabelValues(pool, outcome).Observe(wait.Seconds())
+}
+
+// RecordQueueRejection records a request of pool turned away because every
+// backend was at its connection cap
+func RecordQueueRejection(pool, reason string) {
+	QueueRejections.WithLabelValues(pool, reason).Inc()
+}
+
+// RecordConnectionError records a failure to connect to a backend
+func RecordConnectionError(backend, pool, errorType string) {
+	ConnectionErrors.WithLabelValues(backend, pool, errorType).Inc()
+}
+
+// RecordUpstreamConnection records a connection to a backend being opened
+// (delta 1) or closed (delta -1)
+func RecordUpstreamConnection(backend, pool string, delta int) {
+	UpstreamOpenConnections.WithLabelValues(backend, pool).Add(float64(delta))
+}
+
+// RecordUpstreamConnectionAcquired records a connection being taken from
+// the pool for a backend request
+func RecordUpstreamConnectionAcquired(backend, pool string, reused bool) {
+	UpstreamConnectionsAcquired.WithLabelValues(backend, pool, strconv.FormatBool(reused)).Inc()
+}
+
 // RecordPolicyViolation records a policy violation
 func RecordPolicyViolation(policyType, path string) {
 	PolicyViolations.WithLabelValues(policyType, path).Inc()
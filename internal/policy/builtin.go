@@ -0,0 +1,131 @@
+package policy
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	lberrors "github.com/rixtrayker/go-loadbalancer/internal/errors"
+	"github.com/rixtrayker/go-loadbalancer/internal/monitoring"
+	"github.com/rixtrayker/go-loadbalancer/internal/policy/ratelimit"
+	"github.com/rixtrayker/go-loadbalancer/internal/policy/security"
+	"github.com/rixtrayker/go-loadbalancer/internal/policy/transform"
+)
+
+func init() {
+	Register("acl", newACLPolicy)
+	Register("rate_limit", newRateLimitPolicy)
+	Register("transform", newTransformPolicy)
+}
+
+// aclPolicy rejects requests denied by an access control list
+type aclPolicy struct {
+	Base
+	rules string
+}
+
+// newACLPolicy builds an ACL policy. Arguments:
+//
+//	rules: list of "allow:<cidr>" or "deny:<cidr>" entries
+func newACLPolicy(args configs.Args) (Policy, error) {
+	rules, err := args.StringSlice("rules")
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("rules is required")
+	}
+
+	aclStr := strings.Join(rules, ",")
+	if err := security.Validate(aclStr); err != nil {
+		return nil, err
+	}
+	return &aclPolicy{rules: aclStr}, nil
+}
+
+func (p *aclPolicy) Name() string { return "acl" }
+
+func (p *aclPolicy) OnRequest(r *http.Request) error {
+	if err := security.Apply(p.rules, r); err != nil {
+		monitoring.RecordPolicyViolation("acl", r.URL.Path)
+		return lberrors.NewPolicyError("access denied", err)
+	}
+	return nil
+}
+
+// rateLimitPolicy limits the request rate per client IP
+type rateLimitPolicy struct {
+	Base
+	rate string
+}
+
+// newRateLimitPolicy builds a rate limit policy. Arguments:
+//
+//	rate: limit such as "100/minute"
+func newRateLimitPolicy(args configs.Args) (Policy, error) {
+	rate, err := args.String("rate", "")
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := ratelimit.ParseRate(rate); err != nil {
+		return nil, err
+	}
+	return &rateLimitPolicy{rate: rate}, nil
+}
+
+func (p *rateLimitPolicy) Name() string { return "rate_limit" }
+
+func (p *rateLimitPolicy) OnRequest(r *http.Request) error {
+	if err := ratelimit.Apply(p.rate, r); err != nil {
+		if errors.Is(err, ratelimit.ErrRateLimitExceeded) {
+			monitoring.RecordRateLimitHit(p.rate, r.URL.Path)
+			return lberrors.NewRateLimitError("rate limit exceeded", err)
+		}
+		return lberrors.NewInternalError("invalid rate limit policy", err)
+	}
+	return nil
+}
+
+// transformPolicy rewrites requests and response headers
+type transformPolicy struct {
+	Base
+	request  []transform.Rule
+	response []transform.Rule
+}
+
+// newTransformPolicy builds a transform policy. Arguments:
+//
+//	request:  list of request transforms such as "set-header:X-Env:prod"
+//	response: list of response header transforms
+func newTransformPolicy(args configs.Args) (Policy, error) {
+	request, err := args.StringSlice("request")
+	if err != nil {
+		return nil, err
+	}
+	response, err := args.StringSlice("response")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &transformPolicy{}
+	if p.request, err = transform.Parse(strings.Join(request, ",")); err != nil {
+		return nil, err
+	}
+	if p.response, err = transform.ParseResponse(strings.Join(response, ",")); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *transformPolicy) Name() string { return "transform" }
+
+func (p *transformPolicy) OnRequest(r *http.Request) error {
+	transform.ApplyRules(p.request, r)
+	return nil
+}
+
+func (p *transformPolicy) OnResponse(resp *http.Response) error {
+	transform.ApplyResponseRules(p.response, resp)
+	return nil
+}
@@ -1,34 +1,159 @@
 package policy
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/rixtrayker/go-loadbalancer/configs"
+	lberrors "github.com/rixtrayker/go-loadbalancer/internal/errors"
 )
 
-// Apply applies a policy to a request
-func Apply(policy configs.PolicyConfig, r *http.Request) error {
-	// This is a placeholder implementation
-	// In a real implementation, you would apply the policy based on its type
-	
-	// Apply rate limiting
-	if policy.RateLimit != "" {
-		// Apply rate limiting logic
-		fmt.Println("Applying rate limit policy:", policy.RateLimit)
+// Policy is a step in a route's policy chain. A policy can hook the request
+// before it is proxied, the backend response before it is written to the
+// client, and the error raised when the request fails.
+type Policy interface {
+	// Name returns the registered name of the policy
+	Name() string
+
+	// OnRequest runs before the request is proxied. Returning an error
+	// rejects the request.
+	OnRequest(r *http.Request) error
+
+	// OnResponse runs on the backend response. Returning an error replaces
+	// the response with an error response.
+	OnResponse(resp *http.Response) error
+
+	// OnError runs when the request fails after the chain started
+	OnError(r *http.Request, err error)
+}
+
+// Base provides no-op implementations of every phase. Policies embed it and
+// override only the phases they need.
+type Base struct{}
+
+// OnRequest does nothing
+func (Base) OnRequest(r *http.Request) error { return nil }
+
+// OnResponse does nothing
+func (Base) OnResponse(resp *http.Response) error { return nil }
+
+// OnError does nothing
+func (Base) OnError(r *http.Request, err error) {}
+
+// Chain is an ordered list of policies applied to a route
+type Chain struct {
+	policies []Policy
+}
+
+// NewChain builds a policy chain from route configuration
+func NewChain(policyConfigs []configs.PolicyConfig) (*Chain, error) {
+	chain := &Chain{}
+
+	for i, policyConfig := range policyConfigs {
+		specs, err := expand(policyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("policy %d: %w", i, err)
+		}
+
+		for _, spec := range specs {
+			p, err := New(spec.name, spec.args)
+			if err != nil {
+				return nil, fmt.Errorf("policy %d: %w", i, err)
+			}
+			chain.policies = append(chain.policies, p)
+		}
 	}
 
-	// Apply ACL
-	if policy.ACL != "" {
-		// Apply ACL logic
-		fmt.Println("Applying ACL policy:", policy.ACL)
+	return chain, nil
+}
+
+// Validate checks that a policy config names registered policies with valid
+// arguments
+func Validate(policyConfig configs.PolicyConfig) error {
+	specs, err := expand(policyConfig)
+	if err != nil {
+		return err
 	}
+	for _, spec := range specs {
+		if _, err := New(spec.name, spec.args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Policies returns the policies in the chain in order
+func (c *Chain) Policies() []Policy {
+	return c.policies
+}
 
-	// Apply transformations
-	if policy.Transform != "" {
-		// Apply transformation logic
-		fmt.Println("Applying transform policy:", policy.Transform)
+// OnRequest runs the request phase of every policy in order, stopping at the
+// first rejection. Untyped errors are reported as policy errors.
+func (c *Chain) OnRequest(r *http.Request) error {
+	for _, p := range c.policies {
+		if err := p.OnRequest(r); err != nil {
+			return wrap(p, err)
+		}
 	}
+	return nil
+}
 
+// OnResponse runs the response phase of every policy in reverse order, so
+// the first policy in the chain sees the response last
+func (c *Chain) OnResponse(resp *http.Response) error {
+	for i := len(c.policies) - 1; i >= 0; i-- {
+		if err := c.policies[i].OnResponse(resp); err != nil {
+			return wrap(c.policies[i], err)
+		}
+	}
 	return nil
 }
+
+// OnError runs the error phase of every policy
+func (c *Chain) OnError(r *http.Request, err error) {
+	for _, p := range c.policies {
+		p.OnError(r, err)
+	}
+}
+
+// wrap converts an untyped policy error into a LoadBalancerError
+func wrap(p Policy, err error) error {
+	var lbErr *lberrors.LoadBalancerError
+	if errors.As(err, &lbErr) {
+		return err
+	}
+	return lberrors.NewPolicyError("rejected by policy "+p.Name(), err)
+}
+
+// spec is a policy name with its arguments
+type spec struct {
+	name string
+	args configs.Args
+}
+
+// expand turns a policy config into named policy specs, translating the
+// legacy shorthand fields. ACL runs before rate limiting so denied clients
+// do not consume tokens.
+func expand(policyConfig configs.PolicyConfig) ([]spec, error) {
+	legacy := policyConfig.ACL != "" || policyConfig.RateLimit != "" || policyConfig.Transform != ""
+
+	if policyConfig.Name != "" {
+		if legacy {
+			return nil, errors.New("name cannot be combined with rate_limit, transform or acl")
+		}
+		return []spec{{name: policyConfig.Name, args: policyConfig.Args}}, nil
+	}
+
+	var specs []spec
+	if policyConfig.ACL != "" {
+		specs = append(specs, spec{name: "acl", args: configs.Args{"rules": policyConfig.ACL}})
+	}
+	if policyConfig.RateLimit != "" {
+		specs = append(specs, spec{name: "rate_limit", args: configs.Args{"rate": policyConfig.RateLimit}})
+	}
+	if policyConfig.Transform != "" {
+		specs = append(specs, spec{name: "transform", args: configs.Args{"request": policyConfig.Transform}})
+	}
+	return specs, nil
+}
@@ -0,0 +1,178 @@
+package policy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	lberrors "github.com/rixtrayker/go-loadbalancer/internal/errors"
+)
+
+// recorder is a test policy that appends its name to a shared log in every
+// phase and fails the phase named by args["fail"]
+type recorder struct {
+	name string
+	fail string
+	log  *[]string
+}
+
+var testLog []string
+
+func init() {
+	Register("test_recorder", func(args configs.Args) (Policy, error) {
+		name, err := args.String("name", "")
+		if err != nil {
+			return nil, err
+		}
+		fail, err := args.String("fail", "")
+		if err != nil {
+			return nil, err
+		}
+		return &recorder{name: name, fail: fail, log: &testLog}, nil
+	})
+}
+
+func (p *recorder) Name() string { return "test_recorder" }
+
+func (p *recorder) phase(phase string) error {
+	*p.log = append(*p.log, p.name+"."+phase)
+	if p.fail == phase {
+		return errors.New(p.name + " failed")
+	}
+	return nil
+}
+
+func (p *recorder) OnRequest(r *http.Request) error      { return p.phase("request") }
+func (p *recorder) OnResponse(resp *http.Response) error { return p.phase("response") }
+func (p *recorder) OnError(r *http.Request, err error)   { p.phase("error") }
+
+func recorderConfig(name, fail string) configs.PolicyConfig {
+	return configs.PolicyConfig{Name: "test_recorder", Args: configs.Args{"name": name, "fail": fail}}
+}
+
+func TestChainPhases(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies []configs.PolicyConfig
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "requests in order, responses in reverse",
+			policies: []configs.PolicyConfig{recorderConfig("a", ""), recorderConfig("b", "")},
+			want:     "a.request b.request b.response a.response",
+		},
+		{
+			name:     "rejected request stops the chain",
+			policies: []configs.PolicyConfig{recorderConfig("a", "request"), recorderConfig("b", "")},
+			want:     "a.request",
+			wantErr:  true,
+		},
+		{
+			name:     "rejected response stops the chain",
+			policies: []configs.PolicyConfig{recorderConfig("a", ""), recorderConfig("b", "response")},
+			want:     "a.request b.request b.response",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testLog = nil
+			chain, err := NewChain(tt.policies)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = chain.OnRequest(httptest.NewRequest("GET", "/", nil))
+			if err == nil {
+				err = chain.OnResponse(&http.Response{Header: http.Header{}})
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := strings.Join(testLog, " "); got != tt.want {
+				t.Errorf("phases %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChainWrapsUntypedErrors(t *testing.T) {
+	chain, err := NewChain([]configs.PolicyConfig{recorderConfig("a", "request")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lbErr *lberrors.LoadBalancerError
+	err = chain.OnRequest(httptest.NewRequest("GET", "/", nil))
+	if !errors.As(err, &lbErr) || lbErr.Code != http.StatusForbidden {
+		t.Errorf("OnRequest() = %v, want a policy error", err)
+	}
+}
+
+func TestChainOnError(t *testing.T) {
+	testLog = nil
+	chain, err := NewChain([]configs.PolicyConfig{recorderConfig("a", ""), recorderConfig("b", "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.OnError(httptest.NewRequest("GET", "/", nil), errors.New("backend down"))
+	if got := strings.Join(testLog, " "); got != "a.error b.error" {
+		t.Errorf("phases %q", got)
+	}
+}
+
+func TestExpandLegacyFields(t *testing.T) {
+	chain, err := NewChain([]configs.PolicyConfig{{
+		Transform: "set-header:X-Env:prod",
+		RateLimit: "100/minute",
+		ACL:       "allow:10.0.0.0/8",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, p := range chain.Policies() {
+		names = append(names, p.Name())
+	}
+	if got := strings.Join(names, ","); got != "acl,rate_limit,transform" {
+		t.Errorf("policies %s, want acl,rate_limit,transform", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  configs.PolicyConfig
+		wantErr bool
+	}{
+		{name: "named policy", config: configs.PolicyConfig{Name: "rate_limit", Args: configs.Args{"rate": "10/second"}}},
+		{name: "legacy fields", config: configs.PolicyConfig{ACL: "deny:10.0.0.1"}},
+		{name: "unknown policy", config: configs.PolicyConfig{Name: "nope"}, wantErr: true},
+		{name: "invalid arguments", config: configs.PolicyConfig{Name: "rate_limit", Args: configs.Args{"rate": "often"}}, wantErr: true},
+		{name: "name with legacy fields", config: configs.PolicyConfig{Name: "acl", ACL: "deny:10.0.0.1"}, wantErr: true},
+		{name: "malformed transform", config: configs.PolicyConfig{Transform: "garbage"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegisterPanicsOnDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering acl twice did not panic")
+		}
+	}()
+	Register("acl", newACLPolicy)
+}
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/internal/clientip"
 )
 
 // RateLimiter implements rate limiting
@@ -25,6 +27,9 @@ type limit struct {
 }
 
 var (
+	// ErrRateLimitExceeded is returned when a client has used up its tokens
+	ErrRateLimitExceeded = errors.New("rate limit exceeded")
+
 	// Global rate limiter instance
 	globalLimiter = NewRateLimiter()
 )
@@ -44,15 +49,32 @@ func NewRateLimiter() *RateLimiter {
 
 // Apply applies rate limiting to a request
 func Apply(rateStr string, r *http.Request) error {
-	// Parse rate limit string (e.g., "100/minute", "10/second")
+	rate, per, err := ParseRate(rateStr)
+	if err != nil {
+		return err
+	}
+
+	// Key on the policy as well as the client IP so that rules with
+	// different limits do not share a bucket
+	key := rateStr + "|" + clientip.FromRequest(r)
+
+	// Check rate limit
+	return globalLimiter.Allow(key, rate, per)
+}
+
+// ParseRate parses a rate limit string (e.g., "100/minute", "10/second")
+func ParseRate(rateStr string) (int, time.Duration, error) {
 	parts := strings.Split(rateStr, "/")
 	if len(parts) != 2 {
-		return errors.New("invalid rate limit format")
+		return 0, 0, errors.New("invalid rate limit format")
 	}
 
 	rate, err := strconv.Atoi(parts[0])
 	if err != nil {
-		return fmt.Errorf("invalid rate: %w", err)
+		return 0, 0, fmt.Errorf("invalid rate: %w", err)
+	}
+	if rate <= 0 {
+		return 0, 0, errors.New("rate must be positive")
 	}
 
 	var per time.Duration
@@ -64,14 +86,10 @@ func Apply(rateStr string, r *http.Request) error {
 	case "hour":
 		per = time.Hour
 	default:
-		return errors.New("invalid time unit")
+		return 0, 0, errors.New("invalid time unit")
 	}
 
-	// Get client IP as key
-	key := getClientIP(r)
-
-	// Check rate limit
-	return globalLimiter.Allow(key, rate, per)
+	return rate, per, nil
 }
 
 // Allow checks if a request is allowed based on rate limits
@@ -94,7 +112,7 @@ func (rl *RateLimiter) Allow(key string, rate int, per time.Duration) error {
 		now := time.Now()
 		elapsed := now.Sub(l.lastRefill)
 		tokensToAdd := int(float64(elapsed) / float64(per) * float64(rate))
-		
+
 		if tokensToAdd > 0 {
 			l.tokens = min(l.rate, l.tokens+tokensToAdd)
 			l.lastRefill = now
@@ -103,7 +121,7 @@ func (rl *RateLimiter) Allow(key string, rate int, per time.Duration) error {
 
 	// Check if we have tokens available
 	if l.tokens <= 0 {
-		return errors.New("rate limit exceeded")
+		return ErrRateLimitExceeded
 	}
 
 	// Consume a token
@@ -129,25 +147,6 @@ func (rl *RateLimiter) cleanup() {
 	}
 }
 
-// getClientIP extracts the client IP from a request
-func getClientIP(r *http.Request) string {
-	// Try X-Forwarded-For header first
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
-	}
-
-	// Try X-Real-IP header
-	if xrip := r.Header.Get("X-Real-IP"); xrip != "" {
-		return xrip
-	}
-
-	// Fall back to RemoteAddr
-	return r.RemoteAddr
-}
-
 // min returns the minimum of two integers
 func min(a, b int) int {
 	if a < b {
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		rate    string
+		want    int
+		per     time.Duration
+		wantErr bool
+	}{
+		{rate: "100/minute", want: 100, per: time.Minute},
+		{rate: "10/Second", want: 10, per: time.Second},
+		{rate: "5/hour", want: 5, per: time.Hour},
+		{rate: "0/minute", wantErr: true},
+		{rate: "-1/minute", wantErr: true},
+		{rate: "ten/minute", wantErr: true},
+		{rate: "10/day", wantErr: true},
+		{rate: "10", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rate, func(t *testing.T) {
+			rate, per, err := ParseRate(tt.rate)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRate(%q) error = %v, want error %v", tt.rate, err, tt.wantErr)
+			}
+			if rate != tt.want || per != tt.per {
+				t.Errorf("ParseRate(%q) = %d/%v, want %d/%v", tt.rate, rate, per, tt.want, tt.per)
+			}
+		})
+	}
+}
+
+func TestAllow(t *testing.T) {
+	rl := &RateLimiter{limits: make(map[string]*limit)}
+	for i := 0; i < 3; i++ {
+		if err := rl.Allow("client", 3, time.Hour); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if err := rl.Allow("client", 3, time.Hour); !errors.Is(err, ErrRateLimitExceeded) {
+		t.Errorf("fourth request: %v, want %v", err, ErrRateLimitExceeded)
+	}
+	if err := rl.Allow("other", 3, time.Hour); err != nil {
+		t.Errorf("other client: %v", err)
+	}
+
+	// Tokens come back as time passes
+	rl.limits["client"].lastRefill = time.Now().Add(-time.Hour)
+	if err := rl.Allow("client", 3, time.Hour); err != nil {
+		t.Errorf("after refill: %v", err)
+	}
+}
+
+func TestApplyKeysOnPeerAddress(t *testing.T) {
+	const rate = "2/hour"
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "203.0.113.50:4711"
+		if err := Apply(rate, r); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+
+	// A new X-Forwarded-For value does not buy a new bucket
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.50:4711"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if err := Apply(rate, r); !errors.Is(err, ErrRateLimitExceeded) {
+		t.Errorf("spoofed request: %v, want %v", err, ErrRateLimitExceeded)
+	}
+}
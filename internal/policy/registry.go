@@ -0,0 +1,65 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+)
+
+// Factory builds a policy from its configured arguments
+type Factory func(args configs.Args) (Policy, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a policy factory available under the given name. It panics
+// if the name is empty, the factory is nil or the name is already taken.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" {
+		panic("policy: Register with empty name")
+	}
+	if factory == nil {
+		panic("policy: Register factory is nil for " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("policy: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// New builds the named policy with the given arguments
+func New(name string, args configs.Args) (Policy, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown policy %q", name)
+	}
+
+	p, err := factory(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return p, nil
+}
+
+// Names returns the names of all registered policies in sorted order
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
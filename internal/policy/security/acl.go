@@ -2,10 +2,13 @@ package security
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
+
+	"github.com/rixtrayker/go-loadbalancer/internal/clientip"
 )
 
 // ACL implements access control lists
@@ -16,6 +19,9 @@ type ACL struct {
 }
 
 var (
+	// ErrAccessDenied is returned when a request is rejected by an ACL rule
+	ErrAccessDenied = errors.New("access denied by ACL")
+
 	// Global ACL instance
 	globalACL = NewACL()
 )
@@ -28,51 +34,72 @@ func NewACL() *ACL {
 	}
 }
 
-// Apply applies ACL rules to a request
-func Apply(aclStr string, r *http.Request) error {
-	// Parse ACL string (e.g., "allow:192.168.1.0/24,deny:10.0.0.1")
-	rules := strings.Split(aclStr, ",")
-	
-	// Get client IP
-	clientIP := getClientIP(r)
-	ip := net.ParseIP(clientIP)
-	if ip == nil {
-		return errors.New("invalid client IP")
-	}
+// rule is a single parsed ACL entry
+type rule struct {
+	deny    bool
+	network *net.IPNet
+}
 
-	// Check each rule
-	for _, rule := range rules {
-		parts := strings.SplitN(rule, ":", 2)
+// parse parses an ACL string (e.g., "allow:192.168.1.0/24,deny:10.0.0.1").
+// Any entry that is not an action with an IP address or CIDR is an error.
+func parse(aclStr string) ([]rule, error) {
+	entries := strings.Split(aclStr, ",")
+	rules := make([]rule, 0, len(entries))
+
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, ":", 2)
 		if len(parts) != 2 {
-			continue
+			return nil, fmt.Errorf("invalid ACL rule %q", entry)
 		}
 
 		action := strings.ToLower(parts[0])
-		cidr := parts[1]
+		if action != "allow" && action != "deny" {
+			return nil, fmt.Errorf("unknown ACL action %q", parts[0])
+		}
 
-		_, ipNet, err := net.ParseCIDR(cidr)
+		_, ipNet, err := net.ParseCIDR(parts[1])
 		if err != nil {
-			// Try as a single IP
-			singleIP := net.ParseIP(cidr)
+			// A single IP matches itself only
+			singleIP := net.ParseIP(parts[1])
 			if singleIP == nil {
-				continue
+				return nil, fmt.Errorf("invalid IP or CIDR %q", parts[1])
 			}
-			
-			// Check exact IP match
-			if ip.Equal(singleIP) {
-				if action == "deny" {
-					return errors.New("access denied by ACL")
-				}
-				return nil // Explicitly allowed
+			if ip4 := singleIP.To4(); ip4 != nil {
+				singleIP = ip4
 			}
-		} else {
-			// Check CIDR match
-			if ipNet.Contains(ip) {
-				if action == "deny" {
-					return errors.New("access denied by ACL")
-				}
-				return nil // Explicitly allowed
+			bits := len(singleIP) * 8
+			ipNet = &net.IPNet{IP: singleIP, Mask: net.CIDRMask(bits, bits)}
+		}
+
+		rules = append(rules, rule{deny: action == "deny", network: ipNet})
+	}
+
+	return rules, nil
+}
+
+// Apply applies ACL rules to a request. The first rule matching the client
+// IP decides; requests no rule matches are allowed. A malformed ACL string
+// is an error, so the request is rejected rather than let through by the
+// rules that remain.
+func Apply(aclStr string, r *http.Request) error {
+	rules, err := parse(aclStr)
+	if err != nil {
+		return err
+	}
+
+	// Get client IP
+	clientIP := clientip.FromRequest(r)
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return errors.New("invalid client IP")
+	}
+
+	for _, rule := range rules {
+		if rule.network.Contains(ip) {
+			if rule.deny {
+				return ErrAccessDenied
 			}
+			return nil // Explicitly allowed
 		}
 	}
 
@@ -80,6 +107,13 @@ func Apply(aclStr string, r *http.Request) error {
 	return nil
 }
 
+// Validate checks that every rule in an ACL string has a known action and a
+// valid IP address or CIDR
+func Validate(aclStr string) error {
+	_, err := parse(aclStr)
+	return err
+}
+
 // AddAllowRule adds an allow rule to the ACL
 func (a *ACL) AddAllowRule(cidr string) {
 	a.mutex.Lock()
@@ -133,23 +167,3 @@ func (a *ACL) Check(ipStr string) bool {
 
 	return false
 }
-
-// getClientIP extracts the client IP from a request
-func getClientIP(r *http.Request) string {
-	// Try X-Forwarded-For header first
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
-	}
-
-	// Try X-Real-IP header
-	if xrip := r.Header.Get("X-Real-IP"); xrip != "" {
-		return xrip
-	}
-
-	// Fall back to RemoteAddr
-	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-	return ip
-}
@@ -0,0 +1,72 @@
+package security
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name       string
+		acl        string
+		remoteAddr string
+		forwarded  string
+		wantDenied bool
+		wantErr    bool
+	}{
+		{name: "allowed network", acl: "allow:192.168.1.0/24,deny:0.0.0.0/0", remoteAddr: "192.168.1.10:4711"},
+		{name: "denied by catch-all", acl: "allow:192.168.1.0/24,deny:0.0.0.0/0", remoteAddr: "10.0.0.1:4711", wantDenied: true},
+		{name: "first match wins", acl: "deny:10.0.0.1,allow:10.0.0.0/8", remoteAddr: "10.0.0.1:4711", wantDenied: true},
+		{name: "single IP allowed", acl: "allow:10.0.0.1,deny:10.0.0.0/8", remoteAddr: "10.0.0.1:4711"},
+		{name: "no matching rule", acl: "deny:10.0.0.0/8", remoteAddr: "192.168.1.10:4711"},
+		{name: "IPv6", acl: "deny:2001:db8::/32", remoteAddr: "[2001:db8::1]:4711", wantDenied: true},
+		{name: "forwarded header from untrusted peer", acl: "allow:192.168.1.0/24,deny:0.0.0.0/0", remoteAddr: "10.0.0.1:4711", forwarded: "192.168.1.10", wantDenied: true},
+		{name: "malformed rule after a match", acl: "allow:10.0.0.0/8,deny", remoteAddr: "10.0.0.1:4711", wantErr: true},
+		{name: "unknown action", acl: "permit:10.0.0.1,deny:0.0.0.0/0", remoteAddr: "10.0.0.1:4711", wantErr: true},
+		{name: "invalid network", acl: "deny:10.0.0.0/33", remoteAddr: "10.0.0.1:4711", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+
+			err := Apply(tt.acl, r)
+			if tt.wantErr {
+				if err == nil || errors.Is(err, ErrAccessDenied) {
+					t.Errorf("Apply(%q) = %v, want an error for the malformed rule", tt.acl, err)
+				}
+				return
+			}
+			if denied := errors.Is(err, ErrAccessDenied); denied != tt.wantDenied {
+				t.Errorf("Apply(%q) from %s = %v, want denied %v", tt.acl, tt.remoteAddr, err, tt.wantDenied)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		acl     string
+		wantErr bool
+	}{
+		{acl: "allow:192.168.1.0/24,deny:0.0.0.0/0"},
+		{acl: "deny:10.0.0.1"},
+		{acl: "permit:10.0.0.1", wantErr: true},
+		{acl: "allow:10.0.0.0/33", wantErr: true},
+		{acl: "allow:example.com", wantErr: true},
+		{acl: "10.0.0.1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acl, func(t *testing.T) {
+			if err := Validate(tt.acl); (err != nil) != tt.wantErr {
+				t.Errorf("Validate(%q) = %v, want error %v", tt.acl, err, tt.wantErr)
+			}
+		})
+	}
+}
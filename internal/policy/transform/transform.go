@@ -3,59 +3,120 @@ package transform
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 )
 
+// Rule is a single parsed transformation
+type Rule struct {
+	Action string
+	Key    string
+	Value  string
+}
+
+// Parse parses a transform string
+// (e.g., "add-header:X-Forwarded-Host:example.com,remove-header:Referer").
+// An empty string has no rules; any entry that is not an action with a key
+// is an error.
+func Parse(transformStr string) ([]Rule, error) {
+	if transformStr == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(transformStr, ",")
+	rules := make([]Rule, 0, len(parts))
+
+	for _, part := range parts {
+		fields := strings.SplitN(part, ":", 3)
+		if len(fields) < 2 || fields[1] == "" {
+			return nil, fmt.Errorf("invalid transform %q: expected action:key[:value]", part)
+		}
+
+		rule := Rule{Action: strings.ToLower(fields[0]), Key: fields[1]}
+		if len(fields) == 3 {
+			rule.Value = fields[2]
+		}
+
+		switch rule.Action {
+		case "add-header", "set-header", "rewrite-path", "add-query":
+			if len(fields) != 3 {
+				return nil, errors.New("invalid " + rule.Action + " format")
+			}
+		case "remove-header":
+		default:
+			return nil, errors.New("unknown transform action: " + rule.Action)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
 // Apply applies transformation rules to a request
 func Apply(transformStr string, r *http.Request) error {
-	// Parse transform string (e.g., "add-header:X-Forwarded-Host:example.com,remove-header:Referer")
-	rules := strings.Split(transformStr, ",")
+	rules, err := Parse(transformStr)
+	if err != nil {
+		return err
+	}
+	ApplyRules(rules, r)
+	return nil
+}
 
+// ApplyRules applies parsed transformation rules to a request
+func ApplyRules(rules []Rule, r *http.Request) {
 	for _, rule := range rules {
-		parts := strings.SplitN(rule, ":", 3)
-		if len(parts) < 2 {
-			continue
-		}
-
-		action := strings.ToLower(parts[0])
-		
-		switch action {
+		switch rule.Action {
 		case "add-header":
-			if len(parts) != 3 {
-				return errors.New("invalid add-header format")
-			}
-			r.Header.Add(parts[1], parts[2])
-			
+			r.Header.Add(rule.Key, rule.Value)
+
 		case "set-header":
-			if len(parts) != 3 {
-				return errors.New("invalid set-header format")
-			}
-			r.Header.Set(parts[1], parts[2])
-			
+			r.Header.Set(rule.Key, rule.Value)
+
 		case "remove-header":
-			r.Header.Del(parts[1])
-			
+			r.Header.Del(rule.Key)
+
 		case "rewrite-path":
-			if len(parts) != 3 {
-				return errors.New("invalid rewrite-path format")
-			}
-			r.URL.Path = strings.Replace(r.URL.Path, parts[1], parts[2], 1)
-			
+			r.URL.Path = strings.Replace(r.URL.Path, rule.Key, rule.Value, 1)
+
 		case "add-query":
-			if len(parts) != 3 {
-				return errors.New("invalid add-query format")
-			}
 			q := r.URL.Query()
-			q.Add(parts[1], parts[2])
+			q.Add(rule.Key, rule.Value)
 			r.URL.RawQuery = q.Encode()
-			
+		}
+	}
+}
+
+// ParseResponse parses a transform string for use on responses, where only
+// the header actions are meaningful
+func ParseResponse(transformStr string) ([]Rule, error) {
+	rules, err := Parse(transformStr)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		switch rule.Action {
+		case "add-header", "set-header", "remove-header":
 		default:
-			return errors.New("unknown transform action: " + action)
+			return nil, errors.New("transform action not supported on responses: " + rule.Action)
 		}
 	}
+	return rules, nil
+}
 
-	return nil
+// ApplyResponseRules applies parsed header rules to a backend response
+func ApplyResponseRules(rules []Rule, resp *http.Response) {
+	for _, rule := range rules {
+		switch rule.Action {
+		case "add-header":
+			resp.Header.Add(rule.Key, rule.Value)
+		case "set-header":
+			resp.Header.Set(rule.Key, rule.Value)
+		case "remove-header":
+			resp.Header.Del(rule.Key)
+		}
+	}
 }
 
 // HeaderTransformer transforms HTTP headers
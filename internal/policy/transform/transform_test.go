@@ -0,0 +1,62 @@
+package transform
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		transform string
+		rules     int
+		wantErr   bool
+	}{
+		{transform: "", rules: 0},
+		{transform: "add-header:X-Env:prod,remove-header:Referer", rules: 2},
+		{transform: "rewrite-path:/old:/new", rules: 1},
+		{transform: "garbage", wantErr: true},
+		{transform: "remove-header:", wantErr: true},
+		{transform: "add-header:X-Env:prod,", wantErr: true},
+		{transform: "add-header:X-Env", wantErr: true},
+		{transform: "drop-header:X-Env", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.transform, func(t *testing.T) {
+			rules, err := Parse(tt.transform)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, want error %v", tt.transform, err, tt.wantErr)
+			}
+			if len(rules) != tt.rules {
+				t.Errorf("Parse(%q) = %d rules, want %d", tt.transform, len(rules), tt.rules)
+			}
+		})
+	}
+}
+
+func TestParseResponseRejectsRequestActions(t *testing.T) {
+	if _, err := ParseResponse("rewrite-path:/old:/new"); err == nil {
+		t.Error("rewrite-path accepted on responses")
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	rules, err := Parse("set-header:X-Env:prod,remove-header:Referer,rewrite-path:/v1:/v2,add-query:debug:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/v1/users", nil)
+	r.Header.Set("Referer", "https://example.com")
+	ApplyRules(rules, r)
+
+	if got := r.Header.Get("X-Env"); got != "prod" {
+		t.Errorf("X-Env = %q", got)
+	}
+	if got := r.Header.Get("Referer"); got != "" {
+		t.Errorf("Referer = %q", got)
+	}
+	if r.URL.Path != "/v2/users" || r.URL.RawQuery != "debug=1" {
+		t.Errorf("URL = %s", r.URL)
+	}
+}
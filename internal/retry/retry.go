@@ -0,0 +1,189 @@
+package retry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+)
+
+// DefaultMaxBodyBytes is the largest request body buffered for replay when
+// max_body_bytes is not set
+const DefaultMaxBodyBytes = 64 << 10
+
+// Retry conditions
+const (
+	ConnectError = "connect_error"
+	Timeout      = "timeout"
+)
+
+// retryStatuses are the response statuses that may be retried on
+var retryStatuses = map[int]bool{
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// idempotent are the methods that are safe to send more than once
+var idempotent = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// Policy is the compiled retry policy of a route
+type Policy struct {
+	MaxAttempts        int
+	RetryNonIdempotent bool
+	PerTryTimeout      time.Duration
+	MaxBodyBytes       int64
+	onConnectError     bool
+	onTimeout          bool
+	onStatus           map[int]bool
+}
+
+// New compiles a retry policy. It returns nil when the route is not
+// retried, i.e. max_attempts is below 2.
+func New(config configs.RetryConfig) (*Policy, error) {
+	if config.MaxAttempts < 0 {
+		return nil, errors.New("max_attempts must not be negative")
+	}
+	if config.PerTryTimeout < 0 {
+		return nil, errors.New("per_try_timeout must not be negative")
+	}
+	if config.MaxBodyBytes < 0 {
+		return nil, errors.New("max_body_bytes must not be negative")
+	}
+
+	p := &Policy{
+		MaxAttempts:        config.MaxAttempts,
+		RetryNonIdempotent: config.RetryNonIdempotent,
+		PerTryTimeout:      config.PerTryTimeout,
+		MaxBodyBytes:       config.MaxBodyBytes,
+		onStatus:           make(map[int]bool),
+	}
+	if p.MaxBodyBytes == 0 {
+		p.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+
+	retryOn := config.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = []string{ConnectError}
+	}
+	for _, condition := range retryOn {
+		switch condition {
+		case ConnectError:
+			p.onConnectError = true
+		case Timeout:
+			p.onTimeout = true
+		default:
+			status, err := strconv.Atoi(condition)
+			if err != nil || !retryStatuses[status] {
+				return nil, fmt.Errorf("unknown retry condition: %s", condition)
+			}
+			p.onStatus[status] = true
+		}
+	}
+
+	if p.MaxAttempts < 2 {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// Allows reports whether requests with method may be retried
+func (p *Policy) Allows(method string) bool {
+	return idempotent[method] || p.RetryNonIdempotent
+}
+
+// RetryStatus reports whether a response with status is retried
+func (p *Policy) RetryStatus(status int) bool {
+	return p.onStatus[status]
+}
+
+// Reason returns the retry condition err meets, or "" if err is not retried.
+// Errors from a cancelled client request are never retried.
+func (p *Policy) Reason(err error) string {
+	var status *StatusError
+	switch {
+	case errors.As(err, &status):
+		if p.onStatus[status.Code] {
+			return strconv.Itoa(status.Code)
+		}
+	case errors.Is(err, context.Canceled):
+	case isConnectError(err):
+		if p.onConnectError {
+			return ConnectError
+		}
+	case isTimeout(err):
+		if p.onTimeout {
+			return Timeout
+		}
+	}
+	return ""
+}
+
+// StatusError reports a backend response that is retried instead of being
+// returned to the client
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("backend responded with %d %s", e.Code, http.StatusText(e.Code))
+}
+
+// isConnectError reports whether err happened while connecting, so the
+// backend never saw the request
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isTimeout reports whether err is a timeout
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// BufferBody reads the body of r into memory so it can be sent again, and
+// sets r.GetBody to replay it. Bodies larger than limit are not buffered:
+// the part read so far is put back in front of the rest of the body and
+// false is returned.
+func BufferBody(r *http.Request, limit int64) (bool, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return true, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return false, err
+	}
+	if int64(len(body)) > limit {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return false, nil
+	}
+
+	r.Body.Close()
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	r.Body, _ = r.GetBody()
+	return true, nil
+}
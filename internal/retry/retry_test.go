@@ -0,0 +1,137 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  configs.RetryConfig
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "not retried", config: configs.RetryConfig{MaxAttempts: 1}, wantNil: true},
+		{name: "retried", config: configs.RetryConfig{MaxAttempts: 3, RetryOn: []string{"timeout", "503"}}},
+		{name: "negative attempts", config: configs.RetryConfig{MaxAttempts: -1}, wantErr: true},
+		{name: "unknown condition", config: configs.RetryConfig{MaxAttempts: 2, RetryOn: []string{"reset"}}, wantErr: true},
+		{name: "status that is not retryable", config: configs.RetryConfig{MaxAttempts: 2, RetryOn: []string{"500"}}, wantErr: true},
+		{name: "conditions checked when not retried", config: configs.RetryConfig{MaxAttempts: 1, RetryOn: []string{"reset"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (p == nil) != tt.wantNil {
+				t.Errorf("New() = %v, want nil %v", p, tt.wantNil)
+			}
+		})
+	}
+}
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestReason(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	readErr := &net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}
+
+	tests := []struct {
+		name    string
+		retryOn []string
+		err     error
+		want    string
+	}{
+		{name: "connect error by default", err: dialErr, want: ConnectError},
+		{name: "wrapped connect error", err: fmt.Errorf("proxy: %w", dialErr), want: ConnectError},
+		{name: "timeout not retried by default", err: readErr, want: ""},
+		{name: "read timeout", retryOn: []string{Timeout}, err: readErr, want: Timeout},
+		{name: "deadline", retryOn: []string{Timeout}, err: context.DeadlineExceeded, want: Timeout},
+		{name: "status", retryOn: []string{"503"}, err: &StatusError{Code: 503}, want: "503"},
+		{name: "other status", retryOn: []string{"503"}, err: &StatusError{Code: 502}, want: ""},
+		{name: "client cancelled", retryOn: []string{ConnectError, Timeout}, err: context.Canceled, want: ""},
+		{name: "other error", retryOn: []string{ConnectError, Timeout}, err: errors.New("malformed response"), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(configs.RetryConfig{MaxAttempts: 2, RetryOn: tt.retryOn})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Reason(tt.err); got != tt.want {
+				t.Errorf("Reason(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllows(t *testing.T) {
+	p, _ := New(configs.RetryConfig{MaxAttempts: 2})
+	if !p.Allows("GET") || !p.Allows("PUT") || p.Allows("POST") || p.Allows("PATCH") {
+		t.Error("only idempotent methods should be retried")
+	}
+	p, _ = New(configs.RetryConfig{MaxAttempts: 2, RetryNonIdempotent: true})
+	if !p.Allows("POST") {
+		t.Error("retry_non_idempotent should allow POST")
+	}
+}
+
+func TestBufferBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		limit      int64
+		wantReplay bool
+	}{
+		{name: "below the limit", body: "hello", limit: 10, wantReplay: true},
+		{name: "at the limit", body: "0123456789", limit: 10, wantReplay: true},
+		{name: "over the limit", body: "0123456789A", limit: 10},
+		{name: "empty", body: "", limit: 10, wantReplay: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			replay, err := BufferBody(r, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if replay != tt.wantReplay {
+				t.Fatalf("BufferBody() = %v, want %v", replay, tt.wantReplay)
+			}
+
+			// The body reads whole either way
+			if body, _ := io.ReadAll(r.Body); string(body) != tt.body {
+				t.Errorf("body %q, want %q", body, tt.body)
+			}
+			if !replay || r.GetBody == nil {
+				return
+			}
+			again, err := r.GetBody()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body, _ := io.ReadAll(again); string(body) != tt.body {
+				t.Errorf("replayed body %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+)
+
+// PathMatcher matches request paths
+type PathMatcher interface {
+	Match(path string) bool
+	String() string
+}
+
+// NewPathMatcher builds the path matcher for a rule. At most one of path,
+// path_prefix and path_regex may be set; with none set the rule matches any
+// path and the returned matcher is nil.
+func NewPathMatcher(match configs.MatchConfig) (PathMatcher, error) {
+	set := 0
+	for _, v := range []string{match.Path, match.PathPrefix, match.PathRegex} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errors.New("only one of path, path_prefix and path_regex may be set")
+	}
+
+	switch {
+	case match.Path != "" && strings.Contains(match.Path, "*"):
+		return &wildcardPath{
+			pattern: match.Path,
+			re:      regexp.MustCompile(wildcardToRegexp(match.Path)),
+		}, nil
+	case match.Path != "":
+		return exactPath(match.Path), nil
+	case match.PathPrefix != "":
+		return prefixPath(match.PathPrefix), nil
+	case match.PathRegex != "":
+		re, err := regexp.Compile("^(?:" + match.PathRegex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid path_regex: %w", err)
+		}
+		return &regexPath{pattern: match.PathRegex, re: re}, nil
+	}
+	return nil, nil
+}
+
+// exactPath matches a single path
+type exactPath string
+
+func (p exactPath) Match(path string) bool { return path == string(p) }
+
+func (p exactPath) String() string { return string(p) }
+
+// wildcardPath matches a path pattern where * matches any sequence of
+// characters, including slashes
+type wildcardPath struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+func (p *wildcardPath) Match(path string) bool { return p.re.MatchString(path) }
+
+func (p *wildcardPath) String() string { return p.pattern }
+
+// prefixPath matches a path and everything below it. The prefix matches
+// whole segments only, so /api matches /api and /api/users but not /apis,
+// unless it ends with a slash.
+type prefixPath string
+
+func (p prefixPath) Match(path string) bool {
+	return MatchPrefix(string(p), path)
+}
+
+func (p prefixPath) String() string { return string(p) + "..." }
+
+// regexPath matches paths against a regular expression that must match the
+// whole path
+type regexPath struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+func (p *regexPath) Match(path string) bool { return p.re.MatchString(path) }
+
+func (p *regexPath) String() string { return "~" + p.pattern }
+
+// MatchPrefix reports whether path is prefix or lies below it, matching
+// whole path segments
+func MatchPrefix(prefix, path string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
@@ -0,0 +1,59 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+)
+
+func TestPathMatcher(t *testing.T) {
+	tests := []struct {
+		name  string
+		match configs.MatchConfig
+		path  string
+		want  bool
+	}{
+		{name: "exact", match: configs.MatchConfig{Path: "/api"}, path: "/api", want: true},
+		{name: "exact is not a prefix", match: configs.MatchConfig{Path: "/api"}, path: "/api/users"},
+		{name: "wildcard spans segments", match: configs.MatchConfig{Path: "/api/*"}, path: "/api/v1/users", want: true},
+		{name: "wildcard needs the slash", match: configs.MatchConfig{Path: "/api/*"}, path: "/api"},
+		{name: "wildcard in the middle", match: configs.MatchConfig{Path: "/api/*/users"}, path: "/api/v1/users", want: true},
+		{name: "wildcard quotes metacharacters", match: configs.MatchConfig{Path: "/a.b/*"}, path: "/axb/c"},
+		{name: "prefix itself", match: configs.MatchConfig{PathPrefix: "/api"}, path: "/api", want: true},
+		{name: "prefix below", match: configs.MatchConfig{PathPrefix: "/api"}, path: "/api/users", want: true},
+		{name: "prefix matches whole segments", match: configs.MatchConfig{PathPrefix: "/api"}, path: "/apis"},
+		{name: "prefix with trailing slash", match: configs.MatchConfig{PathPrefix: "/api/"}, path: "/api/users", want: true},
+		{name: "regex is anchored", match: configs.MatchConfig{PathRegex: "/v[0-9]+"}, path: "/v2/users"},
+		{name: "regex", match: configs.MatchConfig{PathRegex: "/v[0-9]+/.*"}, path: "/v2/users", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher, err := NewPathMatcher(tt.match)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := matcher.Match(tt.path); got != tt.want {
+				t.Errorf("%s matching %s = %v, want %v", matcher, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathMatcherErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		match configs.MatchConfig
+	}{
+		{name: "two kinds", match: configs.MatchConfig{Path: "/api", PathPrefix: "/api"}},
+		{name: "invalid regex", match: configs.MatchConfig{PathRegex: "/v[0-9"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewPathMatcher(tt.match); err == nil {
+				t.Error("NewPathMatcher succeeded")
+			}
+		})
+	}
+}
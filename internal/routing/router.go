@@ -1,26 +1,38 @@
 package routing
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
 
 	"github.com/rixtrayker/go-loadbalancer/configs"
 	"github.com/rixtrayker/go-loadbalancer/internal/logging"
+	"github.com/rixtrayker/go-loadbalancer/internal/policy"
 	"github.com/rixtrayker/go-loadbalancer/internal/serverpool"
 )
 
-// Router handles request routing
+// Router matches requests to routing rules. Rules are evaluated by
+// descending priority; rules with the same priority keep their config order.
+// A Router is immutable once built.
 type Router struct {
 	rules  []*Rule
 	pools  map[string]*serverpool.Pool
 	logger *logging.Logger
 }
 
-// NewRouter creates a new router
+// Match is the result of routing a request
+type Match struct {
+	Rule     *Rule
+	Pool     *serverpool.Pool
+	Policies *policy.Chain
+}
+
+// NewRouter compiles the routing rules and resolves their target pools
 func NewRouter(
 	config []configs.RoutingRuleConfig,
 	pools map[string]*serverpool.Pool,
 	logger *logging.Logger,
-) *Router {
+) (*Router, error) {
 	router := &Router{
 		rules:  make([]*Rule, 0, len(config)),
 		pools:  pools,
@@ -28,41 +40,50 @@ func NewRouter(
 	}
 
 	// Create rules from config
-	for _, ruleConfig := range config {
-		rule := NewRule(ruleConfig)
+	for i, ruleConfig := range config {
+		if _, ok := pools[ruleConfig.TargetPool]; !ok {
+			return nil, fmt.Errorf("routing rule %d: target pool not found: %s", i, ruleConfig.TargetPool)
+		}
+
+		rule, err := NewRule(ruleConfig)
+		if err != nil {
+			return nil, fmt.Errorf("routing rule %d: %w", i, err)
+		}
 		router.rules = append(router.rules, rule)
 	}
 
-	return router
+	sort.SliceStable(router.rules, func(i, j int) bool {
+		return router.rules[i].Priority > router.rules[j].Priority
+	})
+
+	return router, nil
 }
 
-// Route routes a request to the appropriate backend pool
-func (r *Router) Route(req *http.Request) (*serverpool.Pool, error) {
-	// Find matching rule
+// Rules returns the rules in evaluation order
+func (r *Router) Rules() []*Rule {
+	return r.rules
+}
+
+// Match finds the first rule matching the request
+func (r *Router) Match(req *http.Request) (*Match, error) {
 	for _, rule := range r.rules {
 		if rule.Matches(req) {
-			// Get the target pool
-			pool, ok := r.pools[rule.TargetPool]
-			if !ok {
-				r.logger.Error("Target pool not found", "pool", rule.TargetPool)
-				continue
-			}
-			return pool, nil
+			return &Match{
+				Rule:     rule,
+				Pool:     r.pools[rule.TargetPool],
+				Policies: rule.Policies,
+			}, nil
 		}
 	}
 
 	return nil, ErrNoMatchingRule
 }
 
-// AddRule adds a new routing rule
-func (r *Router) AddRule(rule *Rule) {
-	r.rules = append(r.rules, rule)
-}
-
-// RemoveRule removes a routing rule
-func (r *Router) RemoveRule(index int) {
-	if index < 0 || index >= len(r.rules) {
-		return
+// Route routes a request to the appropriate backend pool
+func (r *Router) Route(req *http.Request) (*serverpool.Pool, error) {
+	match, err := r.Match(req)
+	if err != nil {
+		return nil, err
 	}
-	r.rules = append(r.rules[:index], r.rules[index+1:]...)
+	return match.Pool, nil
 }
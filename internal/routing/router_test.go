@@ -0,0 +1,103 @@
+package routing
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/logging"
+	"github.com/rixtrayker/go-loadbalancer/internal/serverpool"
+)
+
+// newTestRouter compiles rules against a single pool named web
+func newTestRouter(t *testing.T, rules []configs.RoutingRuleConfig) *Router {
+	t.Helper()
+	pool, err := serverpool.NewPool(configs.BackendPoolConfig{
+		Name:     "web",
+		Backends: []configs.BackendConfig{{URL: "http://10.0.0.1:8080"}},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range rules {
+		rules[i].TargetPool = "web"
+	}
+
+	router, err := NewRouter(rules, map[string]*serverpool.Pool{"web": pool}, logging.NewLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
+func TestRouterPrecedence(t *testing.T) {
+	rules := []configs.RoutingRuleConfig{
+		{Name: "catch-all", Match: configs.MatchConfig{Path: "/*"}},
+		{Name: "api", Match: configs.MatchConfig{Path: "/api/*"}},
+		{Name: "api-users", Priority: 10, Match: configs.MatchConfig{Path: "/api/users/*"}},
+		{Name: "api-admin", Priority: 10, Match: configs.MatchConfig{PathPrefix: "/api"}},
+		{Name: "health", Priority: 20, Match: configs.MatchConfig{Path: "/api/health"}},
+		{Name: "post", Priority: 30, Match: configs.MatchConfig{Method: "POST", Path: "/api/*"}},
+		{Name: "host", Priority: 30, Match: configs.MatchConfig{Host: "*.example.com", Path: "/api/*"}},
+		{Name: "canary", Priority: 40, Match: configs.MatchConfig{Headers: map[string]string{"X-Canary": "^true$"}}},
+	}
+	router := newTestRouter(t, rules)
+
+	tests := []struct {
+		name    string
+		method  string
+		host    string
+		path    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "higher priority wildcard wins", path: "/api/users/1", want: "api-users"},
+		{name: "same priority in config order", path: "/api/orders", want: "api-admin"},
+		{name: "exact path above wildcards", path: "/api/health", want: "health"},
+		{name: "method", method: "POST", path: "/api/orders", want: "post"},
+		{name: "host wildcard ignores the port", host: "shop.example.com:8080", path: "/api/orders", want: "host"},
+		{name: "host wildcard needs a subdomain", host: "example.com", path: "/api/orders", want: "api-admin"},
+		{name: "header", path: "/", headers: map[string]string{"X-Canary": "true"}, want: "canary"},
+		{name: "header must match", path: "/", headers: map[string]string{"X-Canary": "yes"}, want: "catch-all"},
+		{name: "lowest priority catch-all", path: "/static/app.js", want: "catch-all"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			r := httptest.NewRequest(method, tt.path, nil)
+			if tt.host != "" {
+				r.Host = tt.host
+			}
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+
+			match, err := router.Match(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := match.Rule.Name; got != tt.want {
+				t.Errorf("matched %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterNoMatch(t *testing.T) {
+	router := newTestRouter(t, []configs.RoutingRuleConfig{{Match: configs.MatchConfig{PathPrefix: "/api"}}})
+	if _, err := router.Match(httptest.NewRequest("GET", "/web", nil)); !errors.Is(err, ErrNoMatchingRule) {
+		t.Errorf("Match() = %v, want %v", err, ErrNoMatchingRule)
+	}
+}
+
+func TestRouterUnknownPool(t *testing.T) {
+	rules := []configs.RoutingRuleConfig{{TargetPool: "api"}}
+	if _, err := NewRouter(rules, map[string]*serverpool.Pool{}, logging.NewLogger()); err == nil {
+		t.Error("NewRouter accepted a rule for an unknown pool")
+	}
+}
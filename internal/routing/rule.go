@@ -1,62 +1,88 @@
 package routing
 
 import (
+	"fmt"
+	"net"
 	"net/http"
 	"regexp"
+	"strings"
 
 	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/policy"
+	"github.com/rixtrayker/go-loadbalancer/internal/retry"
 )
 
-// Rule represents a routing rule
+// Rule represents a compiled routing rule
 type Rule struct {
+	Name        string
+	Priority    int
 	HostPattern *regexp.Regexp
-	PathPattern *regexp.Regexp
+	Path        PathMatcher
 	Method      string
 	HeaderRules map[string]*regexp.Regexp
 	TargetPool  string
-	Policies    []configs.PolicyConfig
+	Policies    *policy.Chain
+	Retry       *retry.Policy
 }
 
-// NewRule creates a new routing rule from config
-func NewRule(config configs.RoutingRuleConfig) *Rule {
+// NewRule compiles a routing rule and its policy chain from config
+func NewRule(config configs.RoutingRuleConfig) (*Rule, error) {
 	rule := &Rule{
+		Name:       config.Name,
+		Priority:   config.Priority,
 		Method:     config.Match.Method,
 		TargetPool: config.TargetPool,
-		Policies:   config.Policies,
 	}
 
 	// Compile host pattern
 	if config.Match.Host != "" {
-		pattern := wildcardToRegexp(config.Match.Host)
-		rule.HostPattern = regexp.MustCompile(pattern)
+		rule.HostPattern = regexp.MustCompile("(?i)" + wildcardToRegexp(config.Match.Host))
 	}
 
-	// Compile path pattern
-	if config.Match.Path != "" {
-		pattern := wildcardToRegexp(config.Match.Path)
-		rule.PathPattern = regexp.MustCompile(pattern)
+	// Compile path matcher
+	path, err := NewPathMatcher(config.Match)
+	if err != nil {
+		return nil, err
 	}
+	rule.Path = path
 
 	// Compile header patterns
 	if len(config.Match.Headers) > 0 {
-		rule.HeaderRules = make(map[string]*regexp.Regexp)
-		for k, v := range config.Match.Headers {
-			rule.HeaderRules[k] = regexp.MustCompile(v)
+		rule.HeaderRules = make(map[string]*regexp.Regexp, len(config.Match.Headers))
+		for name, pattern := range config.Match.Headers {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern for header %s: %w", name, err)
+			}
+			rule.HeaderRules[name] = re
 		}
 	}
 
-	return rule
+	// Build the policy chain
+	chain, err := policy.NewChain(config.Policies)
+	if err != nil {
+		return nil, err
+	}
+	rule.Policies = chain
+
+	// Compile the retry policy, nil when the rule is not retried
+	rule.Retry, err = retry.New(config.Retry)
+	if err != nil {
+		return nil, fmt.Errorf("retry: %w", err)
+	}
+
+	return rule, nil
 }
 
 // Matches checks if a request matches this rule
 func (r *Rule) Matches(req *http.Request) bool {
-	// Check host
-	if r.HostPattern != nil && !r.HostPattern.MatchString(req.Host) {
+	// Check host, ignoring the port
+	if r.HostPattern != nil && !r.HostPattern.MatchString(hostname(req.Host)) {
 		return false
 	}
 
 	// Check path
-	if r.PathPattern != nil && !r.PathPattern.MatchString(req.URL.Path) {
+	if r.Path != nil && !r.Path.Match(req.URL.Path) {
 		return false
 	}
 
@@ -66,20 +92,37 @@ func (r *Rule) Matches(req *http.Request) bool {
 	}
 
 	// Check headers
-	if r.HeaderRules != nil {
-		for k, v := range r.HeaderRules {
-			headerVal := req.Header.Get(k)
-			if headerVal == "" || !v.MatchString(headerVal) {
-				return false
-			}
+	for name, pattern := range r.HeaderRules {
+		value := req.Header.Get(name)
+		if value == "" || !pattern.MatchString(value) {
+			return false
 		}
 	}
 
 	return true
 }
 
-// wildcardToRegexp converts a wildcard pattern to a regexp pattern
+// String identifies the rule in logs
+func (r *Rule) String() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	if r.Path != nil {
+		return r.Path.String()
+	}
+	return "*"
+}
+
+// hostname strips the port from a Host header
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// wildcardToRegexp converts a wildcard pattern, where * matches any
+// sequence of characters, to an anchored regexp pattern
 func wildcardToRegexp(pattern string) string {
-	// Replace * with .*
-	return "^" + regexp.QuoteMeta(pattern) + "$"
+	return "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
 }
@@ -0,0 +1,75 @@
+package algorithms
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// newBackends creates n backends with weights 1, 2, 3, ...
+func newBackends(t testing.TB, n int) []*backend.Backend {
+	t.Helper()
+	backends := make([]*backend.Backend, n)
+	for i := range backends {
+		b, err := backend.NewBackend(fmt.Sprintf("http://10.0.0.%d:8080", i+1), i+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backends[i] = b
+	}
+	return backends
+}
+
+// hotPathAlgorithms are the algorithms whose backend selection must not
+// allocate
+var hotPathAlgorithms = []string{"round_robin", "least_conn", "weighted", "p2c", "least_latency", "weighted_least_conn", "weighted_random"}
+
+func TestNextBackendDoesNotAllocate(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, name := range hotPathAlgorithms {
+		t.Run(name, func(t *testing.T) {
+			backends := newBackends(t, 8)
+			algorithm, err := New(name, backends, configs.Args{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Selection keeps working from the snapshot after a health change
+			backends[3].SetHealth(false)
+			algorithm.HealthChanged(backends[3], false)
+
+			allocs := testing.AllocsPerRun(1000, func() {
+				if b := algorithm.NextBackend(r); b == nil || b == backends[3] {
+					t.Fatalf("selected %v", b)
+				}
+			})
+			if allocs != 0 {
+				t.Errorf("NextBackend allocates %.1f times per call", allocs)
+			}
+		})
+	}
+}
+
+func BenchmarkNextBackend(b *testing.B) {
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, name := range hotPathAlgorithms {
+		for _, n := range []int{4, 64} {
+			b.Run(fmt.Sprintf("%s/%d", name, n), func(b *testing.B) {
+				algorithm, err := New(name, newBackends(b, n), configs.Args{})
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						algorithm.NextBackend(r)
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package algorithms
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// DefaultLoadFactor is how far above the average load a backend may go
+// under bounded-load consistent hashing
+const DefaultLoadFactor = 1.25
+
+// BoundedConsistentHash is consistent hashing with bounded loads. Keys map
+// to backends on a hash ring as with ConsistentHash, but a backend whose
+// active connections would exceed LoadFactor times the average is passed
+// over, and the key spills to the next backend on the ring.
+type BoundedConsistentHash struct {
+	Base
+	key        hashKey
+	replicas   int
+	loadFactor float64
+	members    *members
+	ring       atomic.Pointer[hashRing]
+}
+
+// NewBoundedConsistentHash creates a bounded-load consistent hash algorithm
+// instance. args takes the hash key arguments of consistent_hash, replicas
+// and load_factor.
+func NewBoundedConsistentHash(backends []*backend.Backend, args configs.Args) (*BoundedConsistentHash, error) {
+	key, err := newHashKey(args)
+	if err != nil {
+		return nil, err
+	}
+
+	replicas, err := args.Int("replicas", DefaultRingReplicas)
+	if err != nil {
+		return nil, err
+	}
+	if replicas < 1 {
+		return nil, fmt.Errorf("replicas must be at least 1")
+	}
+
+	loadFactor, err := args.Float("load_factor", DefaultLoadFactor)
+	if err != nil {
+		return nil, err
+	}
+	if loadFactor < 1 {
+		return nil, fmt.Errorf("load_factor must be at least 1")
+	}
+
+	bh := &BoundedConsistentHash{
+		key:        key,
+		replicas:   replicas,
+		loadFactor: loadFactor,
+	}
+	bh.members = newMembers(backends, bh.build)
+	bh.build(bh.members.backends())
+	return bh, nil
+}
+
+// BackendAdded places a backend on the ring
+func (bh *BoundedConsistentHash) BackendAdded(b *backend.Backend) {
+	bh.members.add(b)
+}
+
+// BackendRemoved takes a backend off the ring
+func (bh *BoundedConsistentHash) BackendRemoved(b *backend.Backend) {
+	bh.members.remove(b)
+}
+
+// build creates the ring for backends
+func (bh *BoundedConsistentHash) build(backends []*backend.Backend) {
+	bh.ring.Store(newHashRing(backends, bh.replicas))
+}
+
+// NextBackend selects the first backend on the ring from the request key
+// that is below the load bound
+func (bh *BoundedConsistentHash) NextBackend(r *http.Request) *backend.Backend {
+	ring := bh.ring.Load()
+	if len(ring.backends) == 0 {
+		return nil
+	}
+
+	// The bound counts the request being placed, so that an idle pool
+	// still admits it
+	var load, available int
+	for _, b := range ring.backends {
+		if b.IsAvailable() {
+			load += b.GetActiveConnections()
+			available++
+		}
+	}
+	if available == 0 {
+		return nil
+	}
+	bound := int(math.Ceil(bh.loadFactor * float64(load+1) / float64(available)))
+
+	h := hashString(bh.key.value(r))
+	b := ring.lookupFunc(h, func(b *backend.Backend) bool {
+		return b.GetActiveConnections() < bound
+	})
+	if b == nil {
+		// Loads changed while walking the ring
+		b = ring.lookup(h)
+	}
+	return b
+}
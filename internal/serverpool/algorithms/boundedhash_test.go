@@ -0,0 +1,109 @@
+package algorithms
+
+import (
+	"testing"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+)
+
+func TestBoundedConsistentHashArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    configs.Args
+		wantErr bool
+	}{
+		{name: "defaults", args: configs.Args{}},
+		{name: "load factor", args: configs.Args{"load_factor": 1.5}},
+		{name: "load factor below 1", args: configs.Args{"load_factor": 0.9}, wantErr: true},
+		{name: "no replicas", args: configs.Args{"replicas": 0}, wantErr: true},
+		{name: "query without name", args: configs.Args{"key": KeyQuery}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewBoundedConsistentHash(newBackends(t, 4), tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewBoundedConsistentHash() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBoundedConsistentHashMatchesRingWhenIdle(t *testing.T) {
+	backends := newBackends(t, 5)
+	args := keyArgs(MethodRing)
+	ch, err := NewConsistentHash(backends, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bh, err := NewBoundedConsistentHash(backends, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := placements(t, ch, 500)
+	got := placements(t, bh, 500)
+	for key, b := range want {
+		if got[key] != b {
+			t.Fatalf("%s sent to %s, want %s", key, got[key].URL, b.URL)
+		}
+	}
+}
+
+func TestBoundedConsistentHashSpillsOverloaded(t *testing.T) {
+	backends := newBackends(t, 4)
+	bh, err := NewBoundedConsistentHash(backends, keyArgs(MethodRing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := bh.NextBackend(keyRequest("hot"))
+
+	// With 2 active connections on 4 backends, the bound for the next
+	// request is ceil(1.25 * 3 / 4) = 1
+	home.IncrementConnections()
+	home.IncrementConnections()
+	defer home.DecrementConnections()
+	defer home.DecrementConnections()
+
+	b := bh.NextBackend(keyRequest("hot"))
+	if b == home {
+		t.Fatal("key stayed on its backend above the load bound")
+	}
+	if b.GetActiveConnections() >= 1 {
+		t.Errorf("key spilled to %s with %d active connections, above the bound", b.URL, b.GetActiveConnections())
+	}
+
+	// Keys of the other backends stay where they are
+	ch, err := NewConsistentHash(backends, keyArgs(MethodRing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range placements(t, ch, 200) {
+		if want != home {
+			if got := bh.NextBackend(keyRequest(key)); got != want {
+				t.Fatalf("%s moved from %s to %s", key, want.URL, got.URL)
+			}
+		}
+	}
+}
+
+func TestBoundedConsistentHashSkipsUnavailable(t *testing.T) {
+	backends := newBackends(t, 3)
+	bh, err := NewBoundedConsistentHash(backends, keyArgs(MethodRing))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	home := bh.NextBackend(keyRequest("key"))
+	home.SetHealth(false)
+	if b := bh.NextBackend(keyRequest("key")); b == nil || b == home {
+		t.Errorf("selected %v instead of another available backend", b)
+	}
+
+	for _, b := range backends {
+		b.SetHealth(false)
+	}
+	if b := bh.NextBackend(keyRequest("key")); b != nil {
+		t.Errorf("selected %s without available backends", b.URL)
+	}
+}
@@ -0,0 +1,66 @@
+package algorithms
+
+import (
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// hashKeyParams are the arguments that select the hash key
+var hashKeyParams = Schema{
+	{Name: "key", Type: TypeString, Description: "Request attribute to hash: ip, header, cookie, query or path"},
+	{Name: "name", Type: TypeString, Description: "Name of the header, cookie or query parameter to hash"},
+}
+
+func init() {
+	Register("round_robin", nil, func(backends []*backend.Backend, args configs.Args) (Algorithm, error) {
+		return NewRoundRobin(backends), nil
+	})
+	Register("least_conn", nil, func(backends []*backend.Backend, args configs.Args) (Algorithm, error) {
+		return NewLeastConn(backends), nil
+	})
+	Register("weighted", nil, func(backends []*backend.Backend, args configs.Args) (Algorithm, error) {
+		return NewWeighted(backends), nil
+	})
+	Register("p2c", nil, func(backends []*backend.Backend, args configs.Args) (Algorithm, error) {
+		return NewP2C(backends), nil
+	})
+	Register("weighted_least_conn", nil, func(backends []*backend.Backend, args configs.Args) (Algorithm, error) {
+		return NewWeightedLeastConn(backends), nil
+	})
+	Register("weighted_random", nil, func(backends []*backend.Backend, args configs.Args) (Algorithm, error) {
+		return NewWeightedRandom(backends), nil
+	})
+
+	Register("consistent_hash", append(Schema{
+		{Name: "method", Type: TypeString, Description: "Consistent hashing method: ring or maglev"},
+		{Name: "replicas", Type: TypeInt, Description: "Ring points per unit of weight"},
+		{Name: "table_size", Type: TypeInt, Description: "Size of the Maglev lookup table, a prime"},
+	}, hashKeyParams...), func(backends []*backend.Backend, args configs.Args) (Algorithm, error) {
+		ch, err := NewConsistentHash(backends, args)
+		if err != nil {
+			return nil, err
+		}
+		return ch, nil
+	})
+
+	Register("consistent_hash_bounded", append(Schema{
+		{Name: "replicas", Type: TypeInt, Description: "Ring points per unit of weight"},
+		{Name: "load_factor", Type: TypeFloat, Description: "How far above the average load a backend may go"},
+	}, hashKeyParams...), func(backends []*backend.Backend, args configs.Args) (Algorithm, error) {
+		bh, err := NewBoundedConsistentHash(backends, args)
+		if err != nil {
+			return nil, err
+		}
+		return bh, nil
+	})
+
+	Register("least_latency", Schema{
+		{Name: "decay", Type: TypeDuration, Description: "Time constant of the latency average"},
+	}, func(backends []*backend.Backend, args configs.Args) (Algorithm, error) {
+		ll, err := NewLeastLatency(backends, args)
+		if err != nil {
+			return nil, err
+		}
+		return ll, nil
+	})
+}
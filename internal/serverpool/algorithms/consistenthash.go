@@ -0,0 +1,280 @@
+package algorithms
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+const (
+	// DefaultRingReplicas is the number of points each unit of weight gets
+	// on the hash ring
+	DefaultRingReplicas = 160
+	// DefaultMaglevTableSize is the size of the Maglev lookup table. It
+	// must be a prime well above the number of backends.
+	DefaultMaglevTableSize = 65537
+)
+
+// Consistent hashing methods
+const (
+	MethodRing   = "ring"
+	MethodMaglev = "maglev"
+)
+
+// ConsistentHash sends requests with the same key to the same backend.
+// When a backend is added, removed or becomes unavailable, only the keys
+// that mapped to it move elsewhere.
+type ConsistentHash struct {
+	Base
+	key       hashKey
+	replicas  int
+	tableSize int
+	members   *members
+	ring      atomic.Pointer[hashRing]
+	maglev    atomic.Pointer[maglevTable]
+}
+
+// NewConsistentHash creates a consistent hash algorithm instance. args
+// selects the hash key (key, name) and the method: ring (with replicas) or
+// maglev (with table_size).
+func NewConsistentHash(backends []*backend.Backend, args configs.Args) (*ConsistentHash, error) {
+	key, err := newHashKey(args)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := &ConsistentHash{
+		key: key,
+	}
+
+	method, err := args.String("method", MethodRing)
+	if err != nil {
+		return nil, err
+	}
+	switch method {
+	case MethodRing:
+		replicas, err := args.Int("replicas", DefaultRingReplicas)
+		if err != nil {
+			return nil, err
+		}
+		if replicas < 1 {
+			return nil, fmt.Errorf("replicas must be at least 1")
+		}
+		ch.replicas = replicas
+
+	case MethodMaglev:
+		size, err := args.Int("table_size", DefaultMaglevTableSize)
+		if err != nil {
+			return nil, err
+		}
+		if !isPrime(size) {
+			return nil, fmt.Errorf("table_size must be a prime number")
+		}
+		if size < len(backends) {
+			return nil, fmt.Errorf("table_size must not be smaller than the number of backends")
+		}
+		ch.tableSize = size
+
+	default:
+		return nil, fmt.Errorf("unknown consistent hash method: %s", method)
+	}
+
+	ch.members = newMembers(backends, ch.build)
+	ch.build(ch.members.backends())
+	return ch, nil
+}
+
+// NextBackend selects the backend the request key hashes to
+func (ch *ConsistentHash) NextBackend(r *http.Request) *backend.Backend {
+	if len(ch.members.backends()) == 0 {
+		return nil
+	}
+
+	h := hashString(ch.key.value(r))
+	if ring := ch.ring.Load(); ring != nil {
+		return ring.lookup(h)
+	}
+	return ch.maglev.Load().lookup(h)
+}
+
+// BackendAdded places a backend on the ring or in the Maglev table
+func (ch *ConsistentHash) BackendAdded(b *backend.Backend) {
+	ch.members.add(b)
+}
+
+// BackendRemoved takes a backend off the ring or out of the Maglev table
+func (ch *ConsistentHash) BackendRemoved(b *backend.Backend) {
+	ch.members.remove(b)
+}
+
+// HealthChanged rebuilds the Maglev table, which only gives entries to
+// available backends. The ring stays as it is: lookups walk past the
+// backends that are unavailable.
+func (ch *ConsistentHash) HealthChanged(b *backend.Backend, healthy bool) {
+	if ch.replicas == 0 {
+		ch.members.healthChanged()
+	}
+}
+
+// build creates the ring or Maglev table for backends
+func (ch *ConsistentHash) build(backends []*backend.Backend) {
+	if ch.replicas > 0 {
+		ch.ring.Store(newHashRing(backends, ch.replicas))
+		return
+	}
+	ch.maglev.Store(newMaglevTable(backends, ch.tableSize))
+}
+
+// hashRing places every backend at many points of a hash ring. A key maps
+// to the first point at or after its hash.
+type hashRing struct {
+	backends []*backend.Backend
+	points   []ringPoint
+}
+
+// ringPoint is a point on the ring owned by backends[backend]
+type ringPoint struct {
+	hash    uint64
+	backend int
+}
+
+// newHashRing builds a ring with replicas points per unit of weight
+func newHashRing(backends []*backend.Backend, replicas int) *hashRing {
+	ring := &hashRing{backends: backends}
+	for i, b := range backends {
+		n := replicas * weightOf(b)
+		for j := 0; j < n; j++ {
+			ring.points = append(ring.points, ringPoint{
+				hash:    hashString(b.URL.String() + "#" + strconv.Itoa(j)),
+				backend: i,
+			})
+		}
+	}
+
+	sort.Slice(ring.points, func(i, j int) bool {
+		return ring.points[i].hash < ring.points[j].hash
+	})
+	return ring
+}
+
+// lookup walks the ring from h to the first available backend
+func (ring *hashRing) lookup(h uint64) *backend.Backend {
+	return ring.lookupFunc(h, nil)
+}
+
+// lookupFunc walks the ring from h to the first available backend that
+// accept, if set, takes
+func (ring *hashRing) lookupFunc(h uint64, accept func(*backend.Backend) bool) *backend.Backend {
+	n := len(ring.points)
+	start := sort.Search(n, func(i int) bool {
+		return ring.points[i].hash >= h
+	})
+
+	for i := 0; i < n; i++ {
+		b := ring.backends[ring.points[(start+i)%n].backend]
+		if b.IsAvailable() && (accept == nil || accept(b)) {
+			return b
+		}
+	}
+	return nil
+}
+
+// maglevTable implements Maglev hashing: a lookup table in which every
+// available backend owns an almost equal share of entries. Tables are
+// immutable and replaced when availability changes.
+type maglevTable struct {
+	backends []*backend.Backend
+	entries  []int
+}
+
+// newMaglevTable builds the table of size entries for the backends that are
+// available: they take turns claiming the next free entry of their
+// permutation, one turn per unit of weight
+func newMaglevTable(backends []*backend.Backend, size int) *maglevTable {
+	m := &maglevTable{
+		backends: backends,
+		entries:  make([]int, size),
+	}
+	for i := range m.entries {
+		m.entries[i] = -1
+	}
+
+	n := uint64(size)
+	offsets := make([]uint64, len(backends))
+	skips := make([]uint64, len(backends))
+	weights := make([]int, len(backends))
+	anyAvailable := false
+	for i, b := range backends {
+		name := b.URL.String()
+		offsets[i] = hashString(name) % n
+		skips[i] = hashString(name+"#skip")%(n-1) + 1
+		if b.IsAvailable() {
+			weights[i] = weightOf(b)
+			anyAvailable = true
+		}
+	}
+	if !anyAvailable {
+		return m
+	}
+
+	next := make([]uint64, len(backends))
+	var filled uint64
+	for filled < n {
+		for i := range backends {
+			for turn := 0; turn < weights[i] && filled < n; turn++ {
+				entry := (offsets[i] + next[i]*skips[i]) % n
+				for m.entries[entry] >= 0 {
+					next[i]++
+					entry = (offsets[i] + next[i]*skips[i]) % n
+				}
+				m.entries[entry] = i
+				next[i]++
+				filled++
+			}
+		}
+	}
+	return m
+}
+
+// lookup returns the backend owning the entry of h. Until the table is
+// rebuilt, the entries of a backend that became unavailable pass on to the
+// owner of the next entry that is available.
+func (m *maglevTable) lookup(h uint64) *backend.Backend {
+	size := uint64(len(m.entries))
+	for i := uint64(0); i < size; i++ {
+		owner := m.entries[(h+i)%size]
+		if owner < 0 {
+			return nil
+		}
+		if b := m.backends[owner]; b.IsAvailable() {
+			return b
+		}
+	}
+	return nil
+}
+
+// weightOf returns the weight of a backend, treating unset weights as 1
+func weightOf(b *backend.Backend) int {
+	if w := b.GetWeight(); w > 0 {
+		return w
+	}
+	return 1
+}
+
+// isPrime reports whether n is a prime number
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for d := 2; d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
+}
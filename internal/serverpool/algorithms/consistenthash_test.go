@@ -0,0 +1,232 @@
+package algorithms
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// keyRequest returns a request whose X-Key header is key
+func keyRequest(key string) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Key", key)
+	return r
+}
+
+// keyArgs hashes on the X-Key header with method
+func keyArgs(method string) configs.Args {
+	return configs.Args{"key": KeyHeader, "name": "X-Key", "method": method}
+}
+
+// placements maps n keys to the backend each of them is sent to
+func placements(t *testing.T, algorithm Algorithm, n int) map[string]*backend.Backend {
+	t.Helper()
+	placed := make(map[string]*backend.Backend, n)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		b := algorithm.NextBackend(keyRequest(key))
+		if b == nil {
+			t.Fatalf("no backend selected for %s", key)
+		}
+		placed[key] = b
+	}
+	return placed
+}
+
+func TestConsistentHashArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    configs.Args
+		wantErr bool
+	}{
+		{name: "defaults", args: configs.Args{}},
+		{name: "maglev", args: configs.Args{"method": MethodMaglev, "table_size": 101}},
+		{name: "unknown method", args: configs.Args{"method": "jump"}, wantErr: true},
+		{name: "no replicas", args: configs.Args{"replicas": 0}, wantErr: true},
+		{name: "table size not prime", args: configs.Args{"method": MethodMaglev, "table_size": 100}, wantErr: true},
+		{name: "table size below backends", args: configs.Args{"method": MethodMaglev, "table_size": 3}, wantErr: true},
+		{name: "header without name", args: configs.Args{"key": KeyHeader}, wantErr: true},
+		{name: "unknown key", args: configs.Args{"key": "body"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewConsistentHash(newBackends(t, 4), tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewConsistentHash() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConsistentHashKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    configs.Args
+		request func(value string) *http.Request
+	}{
+		{
+			name: "header",
+			args: configs.Args{"key": KeyHeader, "name": "X-User"},
+			request: func(value string) *http.Request {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.Header.Set("X-User", value)
+				return r
+			},
+		},
+		{
+			name: "cookie",
+			args: configs.Args{"key": KeyCookie, "name": "session"},
+			request: func(value string) *http.Request {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.AddCookie(&http.Cookie{Name: "session", Value: value})
+				return r
+			},
+		},
+		{
+			name: "query",
+			args: configs.Args{"key": KeyQuery, "name": "user"},
+			request: func(value string) *http.Request {
+				return httptest.NewRequest("GET", "/?user="+value, nil)
+			},
+		},
+		{
+			name: "path",
+			args: configs.Args{"key": KeyPath},
+			request: func(value string) *http.Request {
+				return httptest.NewRequest("GET", "/"+value, nil)
+			},
+		},
+		{
+			name: "ip",
+			args: configs.Args{},
+			request: func(value string) *http.Request {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.RemoteAddr = "192.0.2." + value[len(value)-1:] + ":1234"
+				return r
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, err := NewConsistentHash(newBackends(t, 8), tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The same key always lands on the same backend, and different
+			// keys spread over more than one
+			seen := make(map[*backend.Backend]bool)
+			for i := 0; i < 10; i++ {
+				value := fmt.Sprintf("user%d", i)
+				first := ch.NextBackend(tt.request(value))
+				for j := 0; j < 3; j++ {
+					if b := ch.NextBackend(tt.request(value)); b != first {
+						t.Fatalf("key %s moved from %s to %s", value, first.URL, b.URL)
+					}
+				}
+				seen[first] = true
+			}
+			if len(seen) < 2 {
+				t.Errorf("10 keys all landed on one backend")
+			}
+		})
+	}
+}
+
+func TestConsistentHashMovesOnlyAffectedKeys(t *testing.T) {
+	for _, method := range []string{MethodRing, MethodMaglev} {
+		t.Run(method, func(t *testing.T) {
+			backends := newBackends(t, 5)
+			ch, err := NewConsistentHash(backends, keyArgs(method))
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := placements(t, ch, 1000)
+
+			// Keys of an unavailable backend move; all others stay
+			down := backends[2]
+			down.SetHealth(false)
+			ch.HealthChanged(down, false)
+			after := placements(t, ch, 1000)
+			for key, b := range before {
+				switch {
+				case after[key] == down:
+					t.Fatalf("%s still sent to the unavailable backend", key)
+				case b != down && after[key] != b:
+					t.Fatalf("%s moved from %s to %s", key, b.URL, after[key].URL)
+				}
+			}
+
+			// They return once the backend recovers
+			down.SetHealth(true)
+			ch.HealthChanged(down, true)
+			recovered := placements(t, ch, 1000)
+			for key, b := range before {
+				if recovered[key] != b {
+					t.Fatalf("%s moved from %s to %s after recovery", key, b.URL, recovered[key].URL)
+				}
+			}
+		})
+	}
+}
+
+func TestConsistentHashMembershipChanges(t *testing.T) {
+	for _, method := range []string{MethodRing, MethodMaglev} {
+		t.Run(method, func(t *testing.T) {
+			backends := newBackends(t, 5)
+			ch, err := NewConsistentHash(backends[:4], keyArgs(method))
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := placements(t, ch, 1000)
+
+			// An added backend takes about its share of the keys
+			ch.BackendAdded(backends[4])
+			after := placements(t, ch, 1000)
+			moved := 0
+			for key, b := range before {
+				if after[key] != b {
+					if after[key] != backends[4] {
+						t.Fatalf("%s moved from %s to %s", key, b.URL, after[key].URL)
+					}
+					moved++
+				}
+			}
+			// backends[4] has weight 5 of a total of 15
+			if moved < 200 || moved > 450 {
+				t.Errorf("%d of 1000 keys moved to the new backend, expected about 333", moved)
+			}
+
+			ch.BackendRemoved(backends[4])
+			restored := placements(t, ch, 1000)
+			for key, b := range before {
+				if restored[key] != b {
+					t.Fatalf("%s moved from %s to %s after removal", key, b.URL, restored[key].URL)
+				}
+			}
+		})
+	}
+}
+
+func TestConsistentHashNoBackends(t *testing.T) {
+	for _, method := range []string{MethodRing, MethodMaglev} {
+		backends := newBackends(t, 2)
+		ch, err := NewConsistentHash(backends, keyArgs(method))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range backends {
+			b.SetHealth(false)
+			ch.HealthChanged(b, false)
+		}
+		if b := ch.NextBackend(keyRequest("key")); b != nil {
+			t.Errorf("%s: selected %s without available backends", method, b.URL)
+		}
+	}
+}
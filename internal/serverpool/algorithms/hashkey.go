@@ -0,0 +1,98 @@
+package algorithms
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+)
+
+// Hash key sources
+const (
+	KeyIP     = "ip"
+	KeyHeader = "header"
+	KeyCookie = "cookie"
+	KeyQuery  = "query"
+	KeyPath   = "path"
+)
+
+// hashKey extracts the value a request is hashed on
+type hashKey struct {
+	source string
+	name   string
+}
+
+// newHashKey reads the key and name arguments. The key defaults to the
+// client IP; header, cookie and query keys need a name.
+func newHashKey(args configs.Args) (hashKey, error) {
+	source, err := args.String("key", KeyIP)
+	if err != nil {
+		return hashKey{}, err
+	}
+	name, err := args.String("name", "")
+	if err != nil {
+		return hashKey{}, err
+	}
+
+	switch source {
+	case KeyIP, KeyPath:
+	case KeyHeader, KeyCookie, KeyQuery:
+		if name == "" {
+			return hashKey{}, fmt.Errorf("hash key %s requires a name", source)
+		}
+	default:
+		return hashKey{}, fmt.Errorf("unknown hash key: %s", source)
+	}
+	return hashKey{source: source, name: name}, nil
+}
+
+// value returns the key of a request. Requests without the configured
+// header, cookie or query parameter fall back to the client IP.
+func (k hashKey) value(r *http.Request) string {
+	switch k.source {
+	case KeyHeader:
+		if v := r.Header.Get(k.name); v != "" {
+			return v
+		}
+	case KeyCookie:
+		if c, err := r.Cookie(k.name); err == nil && c.Value != "" {
+			return c.Value
+		}
+	case KeyQuery:
+		if v := r.URL.Query().Get(k.name); v != "" {
+			return v
+		}
+	case KeyPath:
+		return r.URL.Path
+	}
+	return clientIP(r)
+}
+
+// clientIP returns the IP address of the client connection
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// hashString hashes s with 64-bit FNV-1a, finished with a mixing step so
+// that similar keys spread evenly
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return mix(h.Sum64())
+}
+
+// mix is the splitmix64 finalizer
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
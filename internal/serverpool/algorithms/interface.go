@@ -2,12 +2,39 @@ package algorithms
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/rixtrayker/go-loadbalancer/internal/backend"
 )
 
-// Algorithm defines the interface for load balancing algorithms
+// Algorithm defines the interface for load balancing algorithms. The pool
+// calls the lifecycle hooks when backends join or leave it and when they
+// become available or unavailable. Algorithms that don't need a hook embed
+// Base.
 type Algorithm interface {
 	// NextBackend selects the next backend for a request
 	NextBackend(r *http.Request) *backend.Backend
+	// BackendAdded is called when a backend joins the pool
+	BackendAdded(b *backend.Backend)
+	// BackendRemoved is called when a backend leaves the pool
+	BackendRemoved(b *backend.Backend)
+	// HealthChanged is called when a backend becomes available or
+	// unavailable: a health check marks it healthy or unhealthy, outlier
+	// detection ejects it or lets it return, or its circuit opens or
+	// leaves the open state. healthy reports whether it is available now.
+	HealthChanged(b *backend.Backend, healthy bool)
+}
+
+// Base implements the lifecycle hooks of Algorithm as no-ops
+type Base struct{}
+
+func (Base) BackendAdded(b *backend.Backend)                {}
+func (Base) BackendRemoved(b *backend.Backend)              {}
+func (Base) HealthChanged(b *backend.Backend, healthy bool) {}
+
+// LatencyObserver is implemented by algorithms that take the response times
+// of backends into account
+type LatencyObserver interface {
+	// ObserveLatency records the time a backend took to respond
+	ObserveLatency(b *backend.Backend, latency time.Duration)
 }
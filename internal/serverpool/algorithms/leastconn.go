@@ -8,45 +8,50 @@ import (
 
 // LeastConn implements the least connections load balancing algorithm
 type LeastConn struct {
-	backends []*backend.Backend
+	Base
+	members *members
 }
 
 // NewLeastConn creates a new least connections algorithm instance
 func NewLeastConn(backends []*backend.Backend) *LeastConn {
 	return &LeastConn{
-		backends: backends,
+		members: newMembers(backends, nil),
 	}
 }
 
 // NextBackend selects the backend with the least active connections
 func (lc *LeastConn) NextBackend(r *http.Request) *backend.Backend {
-	if len(lc.backends) == 0 {
-		return nil
-	}
-
-	// Get only healthy backends
-	healthyBackends := make([]*backend.Backend, 0, len(lc.backends))
-	for _, b := range lc.backends {
-		if b.IsHealthy() {
-			healthyBackends = append(healthyBackends, b)
-		}
-	}
-
-	if len(healthyBackends) == 0 {
-		return nil
-	}
-
-	// Find the backend with the least connections
+	// Find the available backend with the least connections. Backends in
+	// slow start count as more loaded, in proportion to how far they have
+	// warmed up.
 	var selected *backend.Backend
-	minConn := -1
+	minLoad := -1.0
 
-	for _, b := range healthyBackends {
-		conns := b.GetActiveConnections()
-		if minConn == -1 || conns < minConn {
-			minConn = conns
+	for _, b := range lc.members.availableBackends() {
+		if !b.IsAvailable() {
+			continue
+		}
+		load := float64(b.GetActiveConnections()+1) / b.SlowStartFactor()
+		if minLoad < 0 || load < minLoad {
+			minLoad = load
 			selected = b
 		}
 	}
 
 	return selected
 }
+
+// BackendAdded adds a backend to the candidates
+func (lc *LeastConn) BackendAdded(b *backend.Backend) {
+	lc.members.add(b)
+}
+
+// BackendRemoved removes a backend from the candidates
+func (lc *LeastConn) BackendRemoved(b *backend.Backend) {
+	lc.members.remove(b)
+}
+
+// HealthChanged takes a backend in or out of the candidates
+func (lc *LeastConn) HealthChanged(b *backend.Backend, healthy bool) {
+	lc.members.healthChanged()
+}
@@ -0,0 +1,153 @@
+package algorithms
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// DefaultDecay is the time constant of the latency average of least_latency
+const DefaultDecay = 10 * time.Second
+
+// LeastLatency implements the peak EWMA algorithm. Each backend's score is
+// an exponentially weighted moving average of its response times,
+// multiplied by its active requests plus one; the backend with the lowest
+// score wins. The average jumps to any response time above it, so a backend
+// that slows down is avoided at once, and decays back as it recovers.
+type LeastLatency struct {
+	Base
+	decay   time.Duration
+	members *members
+	state   atomic.Pointer[latencyState]
+}
+
+// latencyState is the averages of the backends of a LeastLatency
+type latencyState struct {
+	stats map[*backend.Backend]*peakEWMA
+}
+
+// peakEWMA is the decaying latency average of a backend
+type peakEWMA struct {
+	mutex   sync.Mutex
+	average float64
+	updated time.Time
+}
+
+// NewLeastLatency creates a new least latency algorithm instance. The decay
+// argument sets how quickly old response times are forgotten.
+func NewLeastLatency(backends []*backend.Backend, args configs.Args) (*LeastLatency, error) {
+	decay, err := args.Duration("decay", DefaultDecay)
+	if err != nil {
+		return nil, err
+	}
+	if decay <= 0 {
+		return nil, fmt.Errorf("decay must be positive")
+	}
+
+	ll := &LeastLatency{
+		decay: decay,
+	}
+	ll.members = newMembers(backends, ll.build)
+	ll.build(ll.members.backends())
+	return ll, nil
+}
+
+// BackendAdded starts tracking the latency of a backend
+func (ll *LeastLatency) BackendAdded(b *backend.Backend) {
+	ll.members.add(b)
+}
+
+// BackendRemoved stops tracking the latency of a backend
+func (ll *LeastLatency) BackendRemoved(b *backend.Backend) {
+	ll.members.remove(b)
+}
+
+// HealthChanged takes a backend in or out of the candidates
+func (ll *LeastLatency) HealthChanged(b *backend.Backend, healthy bool) {
+	ll.members.healthChanged()
+}
+
+// build creates the state for backends, keeping the averages of backends
+// that were already tracked
+func (ll *LeastLatency) build(backends []*backend.Backend) {
+	var previous map[*backend.Backend]*peakEWMA
+	if state := ll.state.Load(); state != nil {
+		previous = state.stats
+	}
+
+	stats := make(map[*backend.Backend]*peakEWMA, len(backends))
+	for _, b := range backends {
+		if s, ok := previous[b]; ok {
+			stats[b] = s
+		} else {
+			stats[b] = &peakEWMA{}
+		}
+	}
+	ll.state.Store(&latencyState{stats: stats})
+}
+
+// NextBackend selects the available backend with the lowest score
+func (ll *LeastLatency) NextBackend(r *http.Request) *backend.Backend {
+	now := time.Now()
+	state := ll.state.Load()
+
+	var selected *backend.Backend
+	best := math.Inf(1)
+	for _, b := range ll.members.availableBackends() {
+		stats, ok := state.stats[b]
+		if !ok || !b.IsAvailable() {
+			continue
+		}
+		if score := ll.score(stats, b, now); score < best {
+			best = score
+			selected = b
+		}
+	}
+	return selected
+}
+
+// ObserveLatency folds a response time into the backend's average
+func (ll *LeastLatency) ObserveLatency(b *backend.Backend, latency time.Duration) {
+	stats, ok := ll.state.Load().stats[b]
+	if !ok {
+		return
+	}
+
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	now := time.Now()
+	rtt := float64(latency)
+	if rtt > stats.average {
+		stats.average = rtt
+	} else {
+		w := math.Exp(-float64(now.Sub(stats.updated)) / float64(ll.decay))
+		stats.average = stats.average*w + rtt*(1-w)
+	}
+	stats.updated = now
+}
+
+// score returns the expected cost of sending a request to b. Backends
+// without any response time yet score zero when idle so they get tried.
+func (ll *LeastLatency) score(stats *peakEWMA, b *backend.Backend, now time.Time) float64 {
+	stats.mutex.Lock()
+	average := stats.average
+	if average > 0 {
+		// Decay towards zero while no responses arrive, so a backend that
+		// was slow once gets tried again
+		average *= math.Exp(-float64(now.Sub(stats.updated)) / float64(ll.decay))
+	}
+	stats.mutex.Unlock()
+
+	active := b.GetActiveConnections()
+	if average == 0 && active > 0 {
+		return math.MaxFloat64
+	}
+	return average * float64(active+1)
+}
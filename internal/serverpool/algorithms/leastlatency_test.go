@@ -0,0 +1,92 @@
+package algorithms
+
+import (
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+)
+
+func TestPeakEWMA(t *testing.T) {
+	backends := weightedBackends(t, 1)
+	ll, err := NewLeastLatency(backends, configs.Args{"decay": "10s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := ll.state.Load().stats[backends[0]]
+	average := func() time.Duration {
+		stats.mutex.Lock()
+		defer stats.mutex.Unlock()
+		return time.Duration(stats.average)
+	}
+
+	ll.ObserveLatency(backends[0], 10*time.Millisecond)
+	if got := average(); got != 10*time.Millisecond {
+		t.Fatalf("first average %v, want 10ms", got)
+	}
+
+	// A spike is taken at once
+	ll.ObserveLatency(backends[0], 100*time.Millisecond)
+	if got := average(); got != 100*time.Millisecond {
+		t.Fatalf("average after a spike %v, want 100ms", got)
+	}
+
+	// A fast response one decay later weighs in by 1 - 1/e
+	stats.mutex.Lock()
+	stats.updated = stats.updated.Add(-10 * time.Second)
+	stats.mutex.Unlock()
+	ll.ObserveLatency(backends[0], 10*time.Millisecond)
+	want := 100*math.Exp(-1) + 10*(1-math.Exp(-1))
+	if got := float64(average()) / float64(time.Millisecond); math.Abs(got-want) > 0.5 {
+		t.Errorf("average after recovery %.1fms, want %.1fms", got, want)
+	}
+
+	// Without responses the score decays towards zero
+	stats.mutex.Lock()
+	updated := stats.updated
+	stats.mutex.Unlock()
+	score := ll.score(stats, backends[0], updated)
+	later := ll.score(stats, backends[0], updated.Add(10*time.Second))
+	if math.Abs(later-score*math.Exp(-1)) > score*0.01 {
+		t.Errorf("score %.0f one decay later, want %.0f", later, score*math.Exp(-1))
+	}
+}
+
+func TestLeastLatencyAvoidsSlowBackend(t *testing.T) {
+	backends := weightedBackends(t, 1, 1)
+	ll, err := NewLeastLatency(backends, configs.Args{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+
+	// Backends without responses yet are tried first
+	ll.ObserveLatency(backends[0], 10*time.Millisecond)
+	if b := ll.NextBackend(r); b != backends[1] {
+		t.Fatalf("selected %s, want the backend without responses", b.URL)
+	}
+
+	ll.ObserveLatency(backends[1], 100*time.Millisecond)
+	for i := 0; i < 10; i++ {
+		if b := ll.NextBackend(r); b != backends[0] {
+			t.Fatalf("pick %d selected the slow backend", i)
+		}
+	}
+
+	// Enough requests in flight outweigh the latency: 10ms * 11 > 100ms
+	for i := 0; i < 10; i++ {
+		backends[0].IncrementConnections()
+	}
+	if b := ll.NextBackend(r); b != backends[1] {
+		t.Errorf("selected %s, want the idle slow backend", b.URL)
+	}
+
+	// Once it is unavailable, the slow backend is not selected at all
+	backends[1].SetHealth(false)
+	ll.HealthChanged(backends[1], false)
+	if b := ll.NextBackend(r); b != backends[0] {
+		t.Errorf("selected %v, want the only available backend", b)
+	}
+}
@@ -0,0 +1,102 @@
+package algorithms
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// members is the list of backends an algorithm balances, kept up to date by
+// its lifecycle hooks, along with a snapshot of the ones that are available.
+// Changes replace the lists rather than modify them, so NextBackend reads
+// them without locking or allocating.
+type members struct {
+	mutex     sync.Mutex
+	list      atomic.Pointer[[]*backend.Backend]
+	available atomic.Pointer[[]*backend.Backend]
+	onChange  func([]*backend.Backend)
+}
+
+// newMembers creates the member list. onChange, if set, is called with the
+// list on every change of the members or their availability, before
+// NextBackend sees it.
+func newMembers(backends []*backend.Backend, onChange func([]*backend.Backend)) *members {
+	m := &members{onChange: onChange}
+	list := append([]*backend.Backend(nil), backends...)
+	m.list.Store(&list)
+	m.storeAvailable(list)
+	return m
+}
+
+// backends returns the current members. The slice must not be modified.
+func (m *members) backends() []*backend.Backend {
+	return *m.list.Load()
+}
+
+// availableBackends returns the members that were available when the
+// snapshot was taken. The pool reports changes through HealthChanged right
+// after they happen, so callers still check IsAvailable to skip the ones
+// that changed in between. The slice must not be modified.
+func (m *members) availableBackends() []*backend.Backend {
+	return *m.available.Load()
+}
+
+// add makes b a member
+func (m *members) add(b *backend.Backend) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	current := m.backends()
+	for _, member := range current {
+		if member == b {
+			return
+		}
+	}
+	list := make([]*backend.Backend, 0, len(current)+1)
+	list = append(list, current...)
+	m.store(append(list, b))
+}
+
+// remove removes b from the members
+func (m *members) remove(b *backend.Backend) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	current := m.backends()
+	list := make([]*backend.Backend, 0, len(current))
+	for _, member := range current {
+		if member != b {
+			list = append(list, member)
+		}
+	}
+	if len(list) != len(current) {
+		m.store(list)
+	}
+}
+
+// healthChanged takes a new snapshot of the available members
+func (m *members) healthChanged() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.store(m.backends())
+}
+
+func (m *members) store(list []*backend.Backend) {
+	if m.onChange != nil {
+		m.onChange(list)
+	}
+	m.list.Store(&list)
+	m.storeAvailable(list)
+}
+
+// storeAvailable replaces the snapshot with the available backends of list
+func (m *members) storeAvailable(list []*backend.Backend) {
+	available := make([]*backend.Backend, 0, len(list))
+	for _, b := range list {
+		if b.IsAvailable() {
+			available = append(available, b)
+		}
+	}
+	m.available.Store(&available)
+}
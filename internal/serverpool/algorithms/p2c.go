@@ -0,0 +1,80 @@
+package algorithms
+
+import (
+	"math/rand/v2"
+	"net/http"
+
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// P2C implements the power of two choices algorithm: it picks two random
+// available backends and keeps the one with fewer active requests. It comes
+// close to least connections without scanning every backend's load.
+type P2C struct {
+	Base
+	members *members
+}
+
+// NewP2C creates a new power of two choices algorithm instance
+func NewP2C(backends []*backend.Backend) *P2C {
+	return &P2C{
+		members: newMembers(backends, nil),
+	}
+}
+
+// NextBackend selects the less loaded of two random available backends
+func (p *P2C) NextBackend(r *http.Request) *backend.Backend {
+	backends := p.members.availableBackends()
+	switch len(backends) {
+	case 0:
+		return nil
+	case 1:
+		if backends[0].IsAvailable() {
+			return backends[0]
+		}
+		return nil
+	}
+
+	// Two distinct random picks of available backends
+	i := rand.IntN(len(backends))
+	j := rand.IntN(len(backends) - 1)
+	if j >= i {
+		j++
+	}
+
+	// A pick that is ejected or has an open circuit loses, and when both
+	// are, the next available backend after the first takes the request
+	a, b := backends[i], backends[j]
+	switch aOK, bOK := a.IsAvailable(), b.IsAvailable(); {
+	case aOK && bOK:
+		if b.GetActiveConnections() < a.GetActiveConnections() {
+			return b
+		}
+		return a
+	case aOK:
+		return a
+	case bOK:
+		return b
+	}
+	for k := 1; k < len(backends); k++ {
+		if c := backends[(i+k)%len(backends)]; c.IsAvailable() {
+			return c
+		}
+	}
+	return nil
+}
+
+// BackendAdded adds a backend to the candidates
+func (p *P2C) BackendAdded(b *backend.Backend) {
+	p.members.add(b)
+}
+
+// BackendRemoved removes a backend from the candidates
+func (p *P2C) BackendRemoved(b *backend.Backend) {
+	p.members.remove(b)
+}
+
+// HealthChanged takes a backend in or out of the candidates
+func (p *P2C) HealthChanged(b *backend.Backend, healthy bool) {
+	p.members.healthChanged()
+}
@@ -0,0 +1,66 @@
+package algorithms
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestP2CTwoBackends(t *testing.T) {
+	backends := weightedBackends(t, 1, 1)
+	p := NewP2C(backends)
+	r := httptest.NewRequest("GET", "/", nil)
+
+	// With two backends both are always sampled, so the less loaded wins
+	backends[0].IncrementConnections()
+	for i := 0; i < 100; i++ {
+		if b := p.NextBackend(r); b != backends[1] {
+			t.Fatalf("pick %d selected %s, want the idle backend", i, b.URL)
+		}
+	}
+
+	backends[1].IncrementConnections()
+	backends[1].IncrementConnections()
+	for i := 0; i < 100; i++ {
+		if b := p.NextBackend(r); b != backends[0] {
+			t.Fatalf("pick %d selected %s, want the less loaded backend", i, b.URL)
+		}
+	}
+}
+
+func TestP2CLoadedBackendLoses(t *testing.T) {
+	backends := weightedBackends(t, 1, 1, 1)
+	p := NewP2C(backends)
+	for i := 0; i < 5; i++ {
+		backends[1].IncrementConnections()
+	}
+	for i := 0; i < 10; i++ {
+		backends[2].IncrementConnections()
+	}
+
+	// The most loaded backend loses every sample it is in, and the idle
+	// one wins every sample it is in: two of the three pairs
+	counts := pickCounts(t, p, 3000)
+	if counts[backends[2]] != 0 {
+		t.Errorf("most loaded backend got %d picks", counts[backends[2]])
+	}
+	expectCounts(t, backends, counts, []int{2000, 1000, 0}, 150)
+}
+
+func TestP2CSkipsUnavailable(t *testing.T) {
+	backends := weightedBackends(t, 1, 1, 1)
+	p := NewP2C(backends)
+	backends[0].IncrementConnections()
+
+	// Ejection takes a backend out without a health change, so it can
+	// still be sampled but never wins
+	backends[1].Eject(time.Hour, time.Hour)
+	counts := pickCounts(t, p, 300)
+	if counts[backends[1]] != 0 {
+		t.Errorf("ejected backend got %d picks", counts[backends[1]])
+	}
+
+	backends[0].Eject(time.Hour, time.Hour)
+	counts = pickCounts(t, p, 300)
+	expectCounts(t, backends, counts, []int{0, 0, 300}, 0)
+}
@@ -0,0 +1,160 @@
+package algorithms
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// Factory creates an algorithm for the backends of a pool from the pool's
+// algorithm_args. Config validation calls it without backends to check the
+// arguments.
+type Factory func(backends []*backend.Backend, args configs.Args) (Algorithm, error)
+
+// Argument types of a Param
+const (
+	TypeString   = "string"
+	TypeInt      = "int"
+	TypeFloat    = "float"
+	TypeBool     = "bool"
+	TypeDuration = "duration"
+)
+
+// Param declares an argument an algorithm accepts
+type Param struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// Schema declares the arguments of an algorithm. Arguments it does not
+// declare are rejected.
+type Schema []Param
+
+// check returns an error if args holds an undeclared argument or a value
+// of the wrong type
+func (s Schema) check(args configs.Args) error {
+	declared := make(map[string]Param, len(s))
+	for _, p := range s {
+		declared[p.Name] = p
+	}
+
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		p, ok := declared[key]
+		if !ok {
+			return fmt.Errorf("unknown argument %q", key)
+		}
+
+		var err error
+		switch p.Type {
+		case TypeString:
+			_, err = args.String(key, "")
+		case TypeInt:
+			_, err = args.Int(key, 0)
+		case TypeFloat:
+			_, err = args.Float(key, 0)
+		case TypeBool:
+			_, err = args.Bool(key, false)
+		case TypeDuration:
+			_, err = args.Duration(key, 0)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registration is a registered algorithm
+type registration struct {
+	schema  Schema
+	factory Factory
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]registration)
+)
+
+// Register makes an algorithm available under the given name. It panics if
+// the name is empty, the factory is nil, a parameter has an unknown type or
+// the name is already taken.
+func Register(name string, schema Schema, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" {
+		panic("algorithms: Register with empty name")
+	}
+	if factory == nil {
+		panic("algorithms: Register factory is nil for " + name)
+	}
+	for _, p := range schema {
+		switch p.Type {
+		case TypeString, TypeInt, TypeFloat, TypeBool, TypeDuration:
+		default:
+			panic("algorithms: Register parameter " + p.Name + " of " + name + " has unknown type " + p.Type)
+		}
+	}
+	if _, dup := registry[name]; dup {
+		panic("algorithms: Register called twice for " + name)
+	}
+	registry[name] = registration{schema: schema, factory: factory}
+}
+
+// New creates the named algorithm for backends with the given arguments
+func New(name string, backends []*backend.Backend, args configs.Args) (Algorithm, error) {
+	registryMu.RLock()
+	reg, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown load balancing algorithm: %s", name)
+	}
+	if err := reg.schema.check(args); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	algorithm, err := reg.factory(backends, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return algorithm, nil
+}
+
+// Validate returns an error if name is not a registered algorithm or args
+// are not valid for it
+func Validate(name string, args configs.Args) error {
+	_, err := New(name, nil, args)
+	return err
+}
+
+// SchemaOf returns the schema of the named algorithm
+func SchemaOf(name string) (Schema, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	reg, ok := registry[name]
+	return reg.schema, ok
+}
+
+// Names returns the names of all registered algorithms in sorted order
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,123 @@
+package algorithms
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// first selects the first available backend, and only exists to be
+// registered by the tests
+type first struct {
+	Base
+	backends []*backend.Backend
+}
+
+func (f *first) NextBackend(r *http.Request) *backend.Backend {
+	for _, b := range f.backends {
+		if b.IsAvailable() {
+			return b
+		}
+	}
+	return nil
+}
+
+func newFirst(backends []*backend.Backend, args configs.Args) (Algorithm, error) {
+	return &first{backends: backends}, nil
+}
+
+func init() {
+	Register("test_first", Schema{
+		{Name: "label", Type: TypeString},
+		{Name: "limit", Type: TypeInt},
+		{Name: "ratio", Type: TypeFloat},
+		{Name: "strict", Type: TypeBool},
+		{Name: "window", Type: TypeDuration},
+	}, newFirst)
+}
+
+func TestRegisterPanics(t *testing.T) {
+	tests := []struct {
+		name    string
+		alg     string
+		schema  Schema
+		factory Factory
+		want    string
+	}{
+		{name: "empty name", factory: newFirst, want: "empty name"},
+		{name: "nil factory", alg: "test_nil", want: "factory is nil"},
+		{name: "unknown parameter type", alg: "test_bad_param", schema: Schema{{Name: "n", Type: "uint"}}, factory: newFirst, want: "unknown type"},
+		{name: "duplicate name", alg: "round_robin", factory: newFirst, want: "twice"},
+		{name: "duplicate of a third-party name", alg: "test_first", factory: newFirst, want: "twice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatal("Register did not panic")
+				}
+				if msg, _ := r.(string); !strings.Contains(msg, tt.want) {
+					t.Errorf("panic %v, want it to mention %q", r, tt.want)
+				}
+			}()
+			Register(tt.alg, tt.schema, tt.factory)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		alg     string
+		args    configs.Args
+		wantErr string
+	}{
+		{name: "built-in", alg: "round_robin", args: configs.Args{}},
+		{name: "registered", alg: "test_first", args: configs.Args{"label": "a", "limit": 3, "ratio": 0.5, "strict": true, "window": "10s"}},
+		{name: "unknown algorithm", alg: "fastest", wantErr: "unknown load balancing algorithm: fastest"},
+		{name: "unknown argument", alg: "test_first", args: configs.Args{"lable": "a"}, wantErr: `unknown argument "lable"`},
+		{name: "argument of a built-in", alg: "round_robin", args: configs.Args{"replicas": 10}, wantErr: "unknown argument"},
+		{name: "string for int", alg: "test_first", args: configs.Args{"limit": "three"}, wantErr: "limit"},
+		{name: "int for bool", alg: "test_first", args: configs.Args{"strict": 1}, wantErr: "strict"},
+		{name: "invalid duration", alg: "test_first", args: configs.Args{"window": "soon"}, wantErr: "window"},
+		{name: "factory error", alg: "consistent_hash", args: configs.Args{"method": "jump"}, wantErr: "consistent_hash: unknown consistent hash method"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.alg, tt.args)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNamesAndSchema(t *testing.T) {
+	names := Names()
+	for _, want := range []string{"round_robin", "test_first"} {
+		found := false
+		for _, name := range names {
+			found = found || name == want
+		}
+		if !found {
+			t.Errorf("Names() = %v, missing %s", names, want)
+		}
+	}
+
+	schema, ok := SchemaOf("test_first")
+	if !ok || len(schema) != 5 {
+		t.Errorf("SchemaOf() = %v, %v", schema, ok)
+	}
+	if _, ok := SchemaOf("fastest"); ok {
+		t.Error("SchemaOf() found an unknown algorithm")
+	}
+}
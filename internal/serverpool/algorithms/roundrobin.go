@@ -9,37 +9,58 @@ import (
 
 // RoundRobin implements the round-robin load balancing algorithm
 type RoundRobin struct {
-	backends []*backend.Backend
-	current  uint32
+	Base
+	members *members
+	current uint32
 }
 
 // NewRoundRobin creates a new round-robin algorithm instance
 func NewRoundRobin(backends []*backend.Backend) *RoundRobin {
 	return &RoundRobin{
-		backends: backends,
-		current:  0,
+		members: newMembers(backends, nil),
+		current: 0,
 	}
 }
 
 // NextBackend selects the next backend in a round-robin fashion
 func (rr *RoundRobin) NextBackend(r *http.Request) *backend.Backend {
-	if len(rr.backends) == 0 {
+	backends := rr.members.availableBackends()
+	n := len(backends)
+	if n == 0 {
 		return nil
 	}
 
-	// Get only healthy backends
-	healthyBackends := make([]*backend.Backend, 0, len(rr.backends))
-	for _, b := range rr.backends {
-		if b.IsHealthy() {
-			healthyBackends = append(healthyBackends, b)
+	// Get the next index in a thread-safe way. Backends that are ejected or
+	// have an open circuit pass their turn to the next backend, and so do
+	// backends in slow start until they have warmed up.
+	idx := int(atomic.AddUint32(&rr.current, 1)-1) % n
+	var fallback *backend.Backend
+	for i := 0; i < n; i++ {
+		b := backends[(idx+i)%n]
+		if !b.IsAvailable() {
+			continue
+		}
+		if admitWarming(b) {
+			return b
+		}
+		if fallback == nil {
+			fallback = b
 		}
 	}
+	return fallback
+}
 
-	if len(healthyBackends) == 0 {
-		return nil
-	}
+// BackendAdded adds a backend to the rotation
+func (rr *RoundRobin) BackendAdded(b *backend.Backend) {
+	rr.members.add(b)
+}
+
+// BackendRemoved removes a backend from the rotation
+func (rr *RoundRobin) BackendRemoved(b *backend.Backend) {
+	rr.members.remove(b)
+}
 
-	// Get the next index in a thread-safe way
-	idx := int(atomic.AddUint32(&rr.current, 1) - 1) % len(healthyBackends)
-	return healthyBackends[idx]
+// HealthChanged takes a backend in or out of the rotation
+func (rr *RoundRobin) HealthChanged(b *backend.Backend, healthy bool) {
+	rr.members.healthChanged()
 }
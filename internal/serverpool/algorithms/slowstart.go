@@ -0,0 +1,15 @@
+package algorithms
+
+import (
+	"math/rand/v2"
+
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// admitWarming reports whether a backend an algorithm picked takes the
+// request. A backend in slow start turns down picks at random, so it gets
+// only its current share of them.
+func admitWarming(b *backend.Backend) bool {
+	factor := b.SlowStartFactor()
+	return factor >= 1 || rand.Float64() < factor
+}
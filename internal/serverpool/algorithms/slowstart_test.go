@@ -0,0 +1,64 @@
+package algorithms
+
+import (
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+)
+
+func TestRoundRobinSlowStart(t *testing.T) {
+	backends := weightedBackends(t, 1, 1)
+	backends[1].ConfigureSlowStart(configs.SlowStartConfig{Window: time.Hour, MinWeightPercent: 10})
+	backends[1].StartSlowStart()
+
+	// A backend that just started warming up gets about a tenth of its
+	// turns
+	n := 10000
+	counts := pickCounts(t, NewRoundRobin(backends), n)
+	share := float64(counts[backends[1]]) / float64(n)
+	if expected := 0.1 / 2; math.Abs(share-expected) > 0.015 {
+		t.Errorf("warming backend got %.3f of the picks, expected %.3f", share, expected)
+	}
+}
+
+func TestLeastConnSlowStart(t *testing.T) {
+	backends := weightedBackends(t, 1, 1)
+	backends[1].ConfigureSlowStart(configs.SlowStartConfig{Window: time.Hour, MinWeightPercent: 10})
+	backends[1].StartSlowStart()
+	lc, err := New("least_conn", backends, configs.Args{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The warming backend counts as ten times as loaded, so it only gets a
+	// request once the other has about ten active ones
+	r := httptest.NewRequest("GET", "/", nil)
+	for i := 0; i < 9; i++ {
+		if b := lc.NextBackend(r); b != backends[0] {
+			t.Fatalf("with %d active connections selected %s", i, b.URL)
+		}
+		backends[0].IncrementConnections()
+	}
+	backends[0].IncrementConnections()
+	if b := lc.NextBackend(r); b != backends[1] {
+		t.Errorf("with 10 active connections selected %s", b.URL)
+	}
+}
+
+func TestSlowStartAlone(t *testing.T) {
+	backends := weightedBackends(t, 1)
+	backends[0].ConfigureSlowStart(configs.SlowStartConfig{Window: time.Hour})
+	backends[0].StartSlowStart()
+
+	// A warming backend still takes every request when it is the only one
+	counts := pickCounts(t, NewRoundRobin(backends), 100)
+	if counts[backends[0]] != 100 {
+		t.Errorf("only backend got %d of 100 picks", counts[backends[0]])
+	}
+	if math.Abs(backends[0].SlowStartFactor()-0.1) > 0.01 {
+		t.Errorf("factor %.3f, want 0.1", backends[0].SlowStartFactor())
+	}
+}
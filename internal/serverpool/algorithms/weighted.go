@@ -7,106 +7,114 @@ import (
 	"github.com/rixtrayker/go-loadbalancer/internal/backend"
 )
 
-// Weighted implements the weighted round-robin load balancing algorithm
+// Weighted implements smooth weighted round robin, as in nginx. On every
+// pick each available backend's current weight grows by its effective
+// weight, the backend with the highest current weight is selected, and its
+// current weight drops by the total of the effective weights. Every backend
+// gets its share of a rotation, spread out rather than in bursts: weights
+// 5, 1 and 1 give a, a, b, a, c, a, a.
+//
+// The effective weight is the backend's weight, read on every pick so that
+// weight changes apply at once, scaled down while the backend is in slow
+// start. Unset weights count as 1. Backends that are unhealthy, ejected or
+// have an open circuit sit out and the others share their traffic.
 type Weighted struct {
-	backends []*backend.Backend
-	current  int
-	weights  []int
-	gcd      int
-	maxW     int
-	cw       int
+	Base
 	mutex    sync.Mutex
+	backends []*backend.Backend
+	peers    []*weightedPeer
 }
 
-// NewWeighted creates a new weighted round-robin algorithm instance
-func NewWeighted(backends []*backend.Backend) *Weighted {
-	weights := make([]int, len(backends))
-	maxW := 0
-
-	for i, b := range backends {
-		weights[i] = b.Weight
-		if b.Weight > maxW {
-			maxW = b.Weight
-		}
-	}
+// weightedPeer is an available backend in the rotation and its current weight
+type weightedPeer struct {
+	backend *backend.Backend
+	current float64
+}
 
-	return &Weighted{
-		backends: backends,
-		weights:  weights,
-		maxW:     maxW,
-		gcd:      gcdOfArray(weights),
-	}
+// NewWeighted creates a new smooth weighted round-robin algorithm instance
+func NewWeighted(backends []*backend.Backend) *Weighted {
+	w := &Weighted{}
+	w.reset(append([]*backend.Backend(nil), backends...))
+	return w
 }
 
-// NextBackend selects the next backend using weighted round-robin
-func (w *Weighted) NextBackend(r *http.Request) *backend.Backend {
+// BackendAdded adds a backend to the rotation
+func (w *Weighted) BackendAdded(b *backend.Backend) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
-	if len(w.backends) == 0 {
-		return nil
+	for _, existing := range w.backends {
+		if existing == b {
+			return
+		}
 	}
+	w.reset(append(append([]*backend.Backend(nil), w.backends...), b))
+}
 
-	// Get only healthy backends
-	healthyBackends := make([]*backend.Backend, 0, len(w.backends))
-	healthyWeights := make([]int, 0, len(w.backends))
+// BackendRemoved removes a backend from the rotation
+func (w *Weighted) BackendRemoved(b *backend.Backend) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
 
-	for i, b := range w.backends {
-		if b.IsHealthy() {
-			healthyBackends = append(healthyBackends, b)
-			healthyWeights = append(healthyWeights, w.weights[i])
+	backends := make([]*backend.Backend, 0, len(w.backends))
+	for _, existing := range w.backends {
+		if existing != b {
+			backends = append(backends, existing)
 		}
 	}
+	w.reset(backends)
+}
 
-	if len(healthyBackends) == 0 {
-		return nil
-	}
+// HealthChanged takes a backend in or out of the rotation
+func (w *Weighted) HealthChanged(b *backend.Backend, healthy bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.reset(w.backends)
+}
 
-	// If only one backend, return it
-	if len(healthyBackends) == 1 {
-		return healthyBackends[0]
+// reset rebuilds the rotation from the available backends of backends.
+// Backends that stay in the rotation keep their current weight; backends
+// that join it start at zero. The caller must hold w.mutex unless w is not
+// shared yet.
+func (w *Weighted) reset(backends []*backend.Backend) {
+	current := make(map[*backend.Backend]float64, len(w.peers))
+	for _, p := range w.peers {
+		current[p.backend] = p.current
 	}
 
-	// Weighted round-robin algorithm
-	for {
-		w.current = (w.current + 1) % len(healthyBackends)
-		if w.current == 0 {
-			w.cw = w.cw - w.gcd
-			if w.cw <= 0 {
-				w.cw = w.maxW
-				if w.cw == 0 {
-					return healthyBackends[0]
-				}
-			}
-		}
-
-		if healthyWeights[w.current] >= w.cw {
-			return healthyBackends[w.current]
+	peers := make([]*weightedPeer, 0, len(backends))
+	for _, b := range backends {
+		if b.IsAvailable() {
+			peers = append(peers, &weightedPeer{backend: b, current: current[b]})
 		}
 	}
-}
 
-// gcd calculates the greatest common divisor of two integers
-func gcd(a, b int) int {
-	for b != 0 {
-		a, b = b, a%b
-	}
-	return a
+	w.backends = backends
+	w.peers = peers
 }
 
-// gcdOfArray calculates the greatest common divisor of an array of integers
-func gcdOfArray(arr []int) int {
-	if len(arr) == 0 {
-		return 1
-	}
-	result := arr[0]
-	for i := 1; i < len(arr); i++ {
-		if arr[i] != 0 {
-			result = gcd(result, arr[i])
+// NextBackend selects the next backend using smooth weighted round robin
+func (w *Weighted) NextBackend(r *http.Request) *backend.Backend {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var best *weightedPeer
+	total := 0.0
+	for _, p := range w.peers {
+		if !p.backend.IsAvailable() {
+			continue
+		}
+		weight := float64(weightOf(p.backend)) * p.backend.SlowStartFactor()
+		p.current += weight
+		total += weight
+		if best == nil || p.current > best.current {
+			best = p
 		}
 	}
-	if result == 0 {
-		return 1
+
+	if best == nil {
+		return nil
 	}
-	return result
+	best.current -= total
+	return best.backend
 }
@@ -0,0 +1,272 @@
+package algorithms
+
+import (
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// weightedBackends creates a backend for each weight
+func weightedBackends(t *testing.T, weights ...int) []*backend.Backend {
+	t.Helper()
+	backends := make([]*backend.Backend, len(weights))
+	for i, weight := range weights {
+		b, err := backend.NewBackend(fmt.Sprintf("http://10.0.1.%d:8080", i+1), weight)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backends[i] = b
+	}
+	return backends
+}
+
+// pickCounts makes n picks and counts them per backend
+func pickCounts(t *testing.T, algorithm Algorithm, n int) map[*backend.Backend]int {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/", nil)
+	counts := make(map[*backend.Backend]int)
+	for i := 0; i < n; i++ {
+		b := algorithm.NextBackend(r)
+		if b == nil {
+			t.Fatalf("pick %d: no backend selected", i)
+		}
+		counts[b]++
+	}
+	return counts
+}
+
+// expectCounts checks that every backend got the expected number of picks,
+// give or take tolerance
+func expectCounts(t *testing.T, backends []*backend.Backend, counts map[*backend.Backend]int, expected []int, tolerance int) {
+	t.Helper()
+	for i, b := range backends {
+		if diff := counts[b] - expected[i]; diff < -tolerance || diff > tolerance {
+			t.Errorf("backend %d (weight %d) got %d picks, expected %d", i, b.GetWeight(), counts[b], expected[i])
+		}
+	}
+}
+
+func TestWeightedSmoothSequence(t *testing.T) {
+	backends := weightedBackends(t, 5, 1, 1)
+	w := NewWeighted(backends)
+	r := httptest.NewRequest("GET", "/", nil)
+
+	a, b, c := backends[0], backends[1], backends[2]
+	expected := []*backend.Backend{a, a, b, a, c, a, a}
+	for round := 0; round < 3; round++ {
+		for i, want := range expected {
+			if got := w.NextBackend(r); got != want {
+				t.Fatalf("round %d, pick %d: got %s, expected %s", round, i, got.URL, want.URL)
+			}
+		}
+	}
+}
+
+func TestWeightedDistribution(t *testing.T) {
+	tests := []struct {
+		weights []int
+	}{
+		{weights: []int{1, 1, 1}},
+		{weights: []int{1, 2, 3}},
+		{weights: []int{10, 1}},
+		{weights: []int{4, 6, 9, 2}},
+		{weights: []int{100, 1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.weights), func(t *testing.T) {
+			backends := weightedBackends(t, tt.weights...)
+			total := 0
+			for _, weight := range tt.weights {
+				total += weight
+			}
+
+			// Whole rotations give every backend exactly its weight
+			rotations := 50
+			counts := pickCounts(t, NewWeighted(backends), rotations*total)
+			expected := make([]int, len(tt.weights))
+			for i, weight := range tt.weights {
+				expected[i] = rotations * weight
+			}
+			expectCounts(t, backends, counts, expected, 0)
+		})
+	}
+}
+
+func TestWeightedZeroWeightCountsAsOne(t *testing.T) {
+	backends := weightedBackends(t, 0, 0, 2)
+	counts := pickCounts(t, NewWeighted(backends), 400)
+	expectCounts(t, backends, counts, []int{100, 100, 200}, 0)
+}
+
+func TestWeightedHealthChanges(t *testing.T) {
+	backends := weightedBackends(t, 1, 2, 3)
+	w := NewWeighted(backends)
+
+	// Picks of an unhealthy backend go to the others by their weights
+	backends[2].SetHealth(false)
+	w.HealthChanged(backends[2], false)
+	counts := pickCounts(t, w, 300)
+	expectCounts(t, backends, counts, []int{100, 200, 0}, 0)
+
+	// A recovered backend gets its share again
+	backends[2].SetHealth(true)
+	w.HealthChanged(backends[2], true)
+	counts = pickCounts(t, w, 600)
+	expectCounts(t, backends, counts, []int{100, 200, 300}, 1)
+
+	// Without any healthy backend nothing is selected
+	for _, b := range backends {
+		b.SetHealth(false)
+		w.HealthChanged(b, false)
+	}
+	if b := w.NextBackend(httptest.NewRequest("GET", "/", nil)); b != nil {
+		t.Errorf("selected %s without healthy backends", b.URL)
+	}
+}
+
+func TestWeightedSkipsUnavailable(t *testing.T) {
+	backends := weightedBackends(t, 1, 1, 2)
+	w := NewWeighted(backends)
+
+	// Ejection takes a backend out without a health change
+	backends[2].Eject(time.Hour, time.Hour)
+	counts := pickCounts(t, w, 200)
+	expectCounts(t, backends, counts, []int{100, 100, 0}, 0)
+}
+
+func TestWeightedWeightUpdates(t *testing.T) {
+	backends := weightedBackends(t, 1, 1)
+	w := NewWeighted(backends)
+	pickCounts(t, w, 3)
+
+	// New weights apply from the next pick, without a hook
+	backends[0].SetWeight(3)
+	counts := pickCounts(t, w, 400)
+	expectCounts(t, backends, counts, []int{300, 100}, 1)
+
+	// A reload reports a reweighted backend as removed and added
+	backends[1].SetWeight(7)
+	w.BackendRemoved(backends[1])
+	w.BackendAdded(backends[1])
+	counts = pickCounts(t, w, 1000)
+	expectCounts(t, backends, counts, []int{300, 700}, 1)
+}
+
+func TestWeightedMembershipChanges(t *testing.T) {
+	backends := weightedBackends(t, 1, 2, 3)
+	w := NewWeighted(backends[:2])
+	pickCounts(t, w, 5)
+
+	w.BackendAdded(backends[2])
+	counts := pickCounts(t, w, 600)
+	expectCounts(t, backends, counts, []int{100, 200, 300}, 1)
+
+	w.BackendRemoved(backends[0])
+	counts = pickCounts(t, w, 500)
+	expectCounts(t, backends, counts, []int{0, 200, 300}, 1)
+}
+
+func TestWeightedSlowStart(t *testing.T) {
+	backends := weightedBackends(t, 1, 1)
+	backends[1].ConfigureSlowStart(configs.SlowStartConfig{Window: time.Hour, MinWeightPercent: 10})
+	backends[1].StartSlowStart()
+
+	// A backend that just started warming up gets about a tenth of its
+	// weight
+	n := 11000
+	counts := pickCounts(t, NewWeighted(backends), n)
+	share := float64(counts[backends[1]]) / float64(n)
+	if expected := 0.1 / 1.1; math.Abs(share-expected) > 0.005 {
+		t.Errorf("warming backend got %.3f of the picks, expected %.3f", share, expected)
+	}
+}
+
+func TestWeightedRandomDistribution(t *testing.T) {
+	tests := []struct {
+		weights []int
+	}{
+		{weights: []int{1, 1, 1, 1}},
+		{weights: []int{1, 2, 3}},
+		{weights: []int{10, 1}},
+		{weights: []int{0, 5, 2, 9, 1}},
+		{weights: []int{100, 1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.weights), func(t *testing.T) {
+			backends := weightedBackends(t, tt.weights...)
+			total := 0
+			for _, b := range backends {
+				total += weightOf(b)
+			}
+
+			// Allow five standard deviations of the binomial distribution
+			n := 200000
+			counts := pickCounts(t, NewWeightedRandom(backends), n)
+			for i, b := range backends {
+				p := float64(weightOf(b)) / float64(total)
+				expected := p * float64(n)
+				tolerance := 5 * math.Sqrt(float64(n)*p*(1-p))
+				if math.Abs(float64(counts[b])-expected) > tolerance {
+					t.Errorf("backend %d (weight %d) got %d picks, expected %.0f", i, tt.weights[i], counts[b], expected)
+				}
+			}
+		})
+	}
+}
+
+func TestWeightedRandomHealthChanges(t *testing.T) {
+	backends := weightedBackends(t, 1, 3, 4)
+	wr := NewWeightedRandom(backends)
+
+	backends[2].SetHealth(false)
+	wr.HealthChanged(backends[2], false)
+	counts := pickCounts(t, wr, 40000)
+	if counts[backends[2]] != 0 {
+		t.Errorf("unhealthy backend got %d picks", counts[backends[2]])
+	}
+	if share := float64(counts[backends[1]]) / 40000; math.Abs(share-0.75) > 0.02 {
+		t.Errorf("backend of weight 3 got %.3f of the picks, expected 0.75", share)
+	}
+
+	// Ejected backends are drawn again
+	backends[1].Eject(time.Hour, time.Hour)
+	counts = pickCounts(t, wr, 100)
+	if counts[backends[0]] != 100 {
+		t.Errorf("only available backend got %d of 100 picks", counts[backends[0]])
+	}
+}
+
+func TestWeightedLeastConnRatio(t *testing.T) {
+	backends := weightedBackends(t, 1, 2, 5)
+	wlc := NewWeightedLeastConn(backends)
+	r := httptest.NewRequest("GET", "/", nil)
+
+	// Connections that stay open pile up in proportion to the weights
+	for i := 0; i < 80; i++ {
+		b := wlc.NextBackend(r)
+		if b == nil {
+			t.Fatalf("pick %d: no backend selected", i)
+		}
+		b.IncrementConnections()
+	}
+	for i, want := range []int{10, 20, 50} {
+		if got := backends[i].GetActiveConnections(); got != want {
+			t.Errorf("backend %d (weight %d) has %d connections, expected %d", i, backends[i].GetWeight(), got, want)
+		}
+	}
+
+	// The backend furthest below its share takes the next request
+	for i := 0; i < 6; i++ {
+		backends[1].DecrementConnections()
+	}
+	if b := wlc.NextBackend(r); b != backends[1] {
+		t.Errorf("selected %s, expected the backend with spare capacity", b.URL)
+	}
+}
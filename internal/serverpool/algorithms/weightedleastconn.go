@@ -0,0 +1,60 @@
+package algorithms
+
+import (
+	"net/http"
+
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// WeightedLeastConn implements weighted least connections: it selects the
+// backend with the fewest active connections per unit of weight, so a
+// backend with twice the weight carries twice the connections
+type WeightedLeastConn struct {
+	Base
+	members *members
+}
+
+// NewWeightedLeastConn creates a new weighted least connections algorithm
+// instance
+func NewWeightedLeastConn(backends []*backend.Backend) *WeightedLeastConn {
+	return &WeightedLeastConn{
+		members: newMembers(backends, nil),
+	}
+}
+
+// NextBackend selects the available backend with the lowest ratio of active
+// connections, counting the request being placed, to weight. Unset weights
+// count as 1, and backends in slow start have their weight scaled down.
+func (wlc *WeightedLeastConn) NextBackend(r *http.Request) *backend.Backend {
+	var selected *backend.Backend
+	minLoad := -1.0
+
+	for _, b := range wlc.members.availableBackends() {
+		if !b.IsAvailable() {
+			continue
+		}
+		weight := float64(weightOf(b)) * b.SlowStartFactor()
+		load := float64(b.GetActiveConnections()+1) / weight
+		if minLoad < 0 || load < minLoad {
+			minLoad = load
+			selected = b
+		}
+	}
+
+	return selected
+}
+
+// BackendAdded adds a backend to the candidates
+func (wlc *WeightedLeastConn) BackendAdded(b *backend.Backend) {
+	wlc.members.add(b)
+}
+
+// BackendRemoved removes a backend from the candidates
+func (wlc *WeightedLeastConn) BackendRemoved(b *backend.Backend) {
+	wlc.members.remove(b)
+}
+
+// HealthChanged takes a backend in or out of the candidates
+func (wlc *WeightedLeastConn) HealthChanged(b *backend.Backend, healthy bool) {
+	wlc.members.healthChanged()
+}
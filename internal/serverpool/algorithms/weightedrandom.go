@@ -0,0 +1,166 @@
+package algorithms
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// WeightedRandom selects a random backend with a probability proportional
+// to its weight. The available backends are kept in an alias table,
+// rebuilt when availability or membership changes, so a selection takes
+// constant time however many backends there are.
+type WeightedRandom struct {
+	Base
+	members *members
+	mutex   sync.Mutex
+	table   atomic.Pointer[aliasTable]
+}
+
+// NewWeightedRandom creates a new weighted random algorithm instance
+func NewWeightedRandom(backends []*backend.Backend) *WeightedRandom {
+	wr := &WeightedRandom{
+		members: newMembers(backends, nil),
+	}
+	wr.build()
+	return wr
+}
+
+// NextBackend selects a random backend by weight. Picks of a backend that
+// is ejected or has an open circuit are drawn again, and so are some picks
+// of a backend in slow start, in proportion to how far it has warmed up.
+func (wr *WeightedRandom) NextBackend(r *http.Request) *backend.Backend {
+	table := wr.table.Load()
+	n := len(table.backends)
+	if n == 0 {
+		return nil
+	}
+
+	var fallback *backend.Backend
+	for i := 0; i < n; i++ {
+		b := table.pick()
+		if !b.IsAvailable() {
+			continue
+		}
+		if admitWarming(b) {
+			return b
+		}
+		if fallback == nil {
+			fallback = b
+		}
+	}
+	if fallback != nil {
+		return fallback
+	}
+
+	// Most backends are unavailable: take the next available one
+	start := rand.IntN(n)
+	for i := 0; i < n; i++ {
+		if b := table.backends[(start+i)%n]; b.IsAvailable() {
+			return b
+		}
+	}
+	return nil
+}
+
+// BackendAdded adds a backend to the alias table
+func (wr *WeightedRandom) BackendAdded(b *backend.Backend) {
+	wr.members.add(b)
+	wr.build()
+}
+
+// BackendRemoved removes a backend from the alias table
+func (wr *WeightedRandom) BackendRemoved(b *backend.Backend) {
+	wr.members.remove(b)
+	wr.build()
+}
+
+// HealthChanged adds a backend to or removes it from the alias table
+func (wr *WeightedRandom) HealthChanged(b *backend.Backend, healthy bool) {
+	wr.members.healthChanged()
+	wr.build()
+}
+
+// build replaces the alias table with one for the current available members.
+// Builds are serialized and read the latest snapshot, so the last one to
+// run reflects the last change.
+func (wr *WeightedRandom) build() {
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+	wr.table.Store(newAliasTable(wr.members.availableBackends()))
+}
+
+// aliasTable implements Vose's alias method. Every backend owns a column
+// of equal probability, split between the backend itself with probability
+// prob and one alias that tops the column up.
+type aliasTable struct {
+	backends []*backend.Backend
+	prob     []float64
+	alias    []int
+}
+
+// newAliasTable builds the table for backends by their weights, treating
+// unset weights as 1
+func newAliasTable(backends []*backend.Backend) *aliasTable {
+	n := len(backends)
+	t := &aliasTable{
+		backends: backends,
+		prob:     make([]float64, n),
+		alias:    make([]int, n),
+	}
+	if n == 0 {
+		return t
+	}
+
+	total := 0
+	for _, b := range backends {
+		total += weightOf(b)
+	}
+
+	// Scale the weights so they average 1, then pair every column below 1
+	// with one above it
+	scaled := make([]float64, n)
+	var small, large []int
+	for i, b := range backends {
+		scaled[i] = float64(weightOf(b)) * float64(n) / float64(total)
+		if scaled[i] < 1 {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+
+	for len(small) > 0 && len(large) > 0 {
+		s, l := small[len(small)-1], large[len(large)-1]
+		small = small[:len(small)-1]
+
+		t.prob[s] = scaled[s]
+		t.alias[s] = l
+		scaled[l] -= 1 - scaled[s]
+		if scaled[l] < 1 {
+			large = large[:len(large)-1]
+			small = append(small, l)
+		}
+	}
+
+	// What is left is 1 up to rounding errors
+	for _, i := range large {
+		t.prob[i] = 1
+	}
+	for _, i := range small {
+		t.prob[i] = 1
+	}
+	return t
+}
+
+// pick draws a backend from a table with at least one backend
+func (t *aliasTable) pick() *backend.Backend {
+	i := rand.IntN(len(t.backends))
+	if rand.Float64() < t.prob[i] {
+		return t.backends[i]
+	}
+	return t.backends[t.alias[i]]
+}
@@ -0,0 +1,115 @@
+package serverpool
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+	"github.com/rixtrayker/go-loadbalancer/internal/serverpool/algorithms"
+)
+
+// hookLog records the lifecycle hooks every test_hooks instance receives
+var hookLog struct {
+	sync.Mutex
+	events []string
+}
+
+// hooks is an algorithm that records its lifecycle hooks
+type hooks struct {
+	backends []*backend.Backend
+}
+
+func init() {
+	algorithms.Register("test_hooks", nil, func(backends []*backend.Backend, args configs.Args) (algorithms.Algorithm, error) {
+		return &hooks{backends: backends}, nil
+	})
+}
+
+func (h *hooks) NextBackend(r *http.Request) *backend.Backend {
+	for _, b := range h.backends {
+		if b.IsAvailable() {
+			return b
+		}
+	}
+	return nil
+}
+
+func (h *hooks) record(event string, b *backend.Backend) {
+	hookLog.Lock()
+	defer hookLog.Unlock()
+	hookLog.events = append(hookLog.events, event+" "+b.URL.Host)
+}
+
+func (h *hooks) BackendAdded(b *backend.Backend)   { h.record("added", b) }
+func (h *hooks) BackendRemoved(b *backend.Backend) { h.record("removed", b) }
+func (h *hooks) HealthChanged(b *backend.Backend, healthy bool) {
+	if healthy {
+		h.record("available", b)
+	} else {
+		h.record("unavailable", b)
+	}
+}
+
+// takeHooks returns the recorded hooks and clears the log
+func takeHooks() string {
+	hookLog.Lock()
+	defer hookLog.Unlock()
+	events := strings.Join(hookLog.events, ", ")
+	hookLog.events = nil
+	return events
+}
+
+// hooksConfig returns a test_hooks pool config for the backend hosts
+func hooksConfig(hosts ...string) configs.BackendPoolConfig {
+	config := configs.BackendPoolConfig{Name: "hooks", Algorithm: "test_hooks"}
+	for _, host := range hosts {
+		config.Backends = append(config.Backends, configs.BackendConfig{URL: "http://" + host, Weight: 1})
+	}
+	return config
+}
+
+func TestAlgorithmHooks(t *testing.T) {
+	takeHooks()
+	pool, err := NewPool(hooksConfig("a:80", "b:80"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events := takeHooks(); events != "" {
+		t.Errorf("new pool fired %s", events)
+	}
+
+	// A health flip reaches the algorithm with the backend's availability
+	pool.MarkBackendStatus("http://a:80", false)
+	pool.MarkBackendStatus("http://a:80", true)
+	if events, want := takeHooks(), "unavailable a:80, available a:80"; events != want {
+		t.Errorf("health flip fired %q, want %q", events, want)
+	}
+
+	// A rebuild tells the reused instance about the changes on commit only
+	rebuilt, err := pool.Rebuild(hooksConfig("b:80", "c:80"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events := takeHooks(); events != "" {
+		t.Errorf("uncommitted rebuild fired %s", events)
+	}
+	rebuilt.Commit()
+	if events, want := takeHooks(), "removed a:80, added c:80"; events != want {
+		t.Errorf("rebuild fired %q, want %q", events, want)
+	}
+
+	// A reweighted backend is removed and added again
+	config := hooksConfig("b:80", "c:80")
+	config.Backends[0].Weight = 3
+	reweighted, err := rebuilt.Rebuild(config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reweighted.Commit()
+	if events, want := takeHooks(), "removed b:80, added b:80"; events != want {
+		t.Errorf("reweight fired %q, want %q", events, want)
+	}
+}
@@ -3,23 +3,85 @@ package serverpool
 import (
 	"errors"
 	"net/http"
+	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rixtrayker/go-loadbalancer/configs"
 	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+	"github.com/rixtrayker/go-loadbalancer/internal/monitoring"
 	"github.com/rixtrayker/go-loadbalancer/internal/serverpool/algorithms"
 )
 
-// Pool represents a group of backend servers
+// Pool represents a group of backend servers. Its backends are split into
+// priority tiers and, with zone routing, into zones within each tier, each
+// balanced by its own instance of the pool's algorithm. Sticky is nil
+// unless the pool has sticky sessions.
+//
+// Backends is never modified. Which backends are available, and how much
+// capacity that leaves every tier and zone, is kept in an immutable
+// snapshot. The backends report every change in their availability, which
+// replaces the snapshot, so selecting a backend takes no locks.
 type Pool struct {
-	Name      string
-	Backends  []*backend.Backend
-	Algorithm algorithms.Algorithm
-	mutex     sync.RWMutex
+	Name         string
+	Backends     []*backend.Backend
+	Sticky       *StickySessions
+	zone         string
+	algorithm    string
+	args         configs.Args
+	tiers        []*tier
+	factor       float64
+	minLocal     float64
+	queue        *requestQueue
+	capped       bool
+	zoneRequests map[string]prometheus.Counter
+	commit       func()
+	state        atomic.Pointer[availability]
+	mutex        sync.Mutex
 }
 
-// NewPool creates a new backend pool
-func NewPool(config configs.BackendPoolConfig) (*Pool, error) {
+// availability is a snapshot of the available backends of a pool. tiers
+// follows the order of the pool's tiers.
+type availability struct {
+	backends []*backend.Backend
+	tiers    []tierAvailability
+}
+
+// NewPool creates a new backend pool for a load balancer running in zone,
+// which may be empty
+func NewPool(config configs.BackendPoolConfig, zone string) (*Pool, error) {
+	return newPool(config, zone, nil)
+}
+
+// Rebuild creates a new pool from config that reuses the backends of p whose
+// URL is unchanged, so their health state and connection counters carry
+// over. When the algorithm and its arguments are unchanged, its instances
+// are reused too and told which backends were added and removed. p keeps
+// serving in-flight requests, but only ever to its own backends.
+//
+// The new pool must be committed before it serves requests. Until then the
+// backends and algorithm instances it shares with p are left as they are,
+// so a rebuild that is abandoned has no effect on p.
+func (p *Pool) Rebuild(config configs.BackendPoolConfig, zone string) (*Pool, error) {
+	return newPool(config, zone, p)
+}
+
+// Commit applies the settings of a rebuilt pool to the backends, algorithm
+// instances and request queue it shares with the pool it was rebuilt from.
+// Pools created by NewPool are committed already; committing twice has no
+// effect.
+func (p *Pool) Commit() {
+	if p.commit != nil {
+		p.commit()
+		p.commit = nil
+	}
+}
+
+// newPool creates a pool, taking backends and algorithm instances from
+// previous, if set, where they match
+func newPool(config configs.BackendPoolConfig, zone string, previous *Pool) (*Pool, error) {
 	if len(config.Backends) == 0 {
 		return nil, errors.New("no backends provided")
 	}
@@ -34,65 +96,358 @@ func NewPool(config configs.BackendPoolConfig) (*Pool, error) {
 		backends = append(backends, b)
 	}
 
-	// Create load balancing algorithm
-	var algorithm algorithms.Algorithm
-	switch config.Algorithm {
-	case "round_robin":
-		algorithm = algorithms.NewRoundRobin(backends)
-	case "least_conn":
-		algorithm = algorithms.NewLeastConn(backends)
-	case "weighted":
-		algorithm = algorithms.NewWeighted(backends)
-	default:
-		algorithm = algorithms.NewRoundRobin(backends)
+	var existing map[string]*backend.Backend
+	if previous != nil {
+		existing = make(map[string]*backend.Backend, len(previous.Backends))
+		for _, b := range previous.Backends {
+			existing[b.URL.String()] = b
+		}
+	}
+
+	// Swap in reused backends only once every URL parsed. Their settings
+	// only change when the pool is committed.
+	reweighted := make(map[*backend.Backend]bool)
+	var added []*backend.Backend
+	for i, b := range backends {
+		if prev, ok := existing[b.URL.String()]; ok {
+			if prev.GetWeight() != b.Weight {
+				reweighted[prev] = true
+			}
+			backends[i] = prev
+		} else if existing != nil {
+			added = append(added, b)
+		}
+	}
+
+	// An empty name selects round robin
+	algorithm := config.Algorithm
+	if algorithm == "" {
+		algorithm = "round_robin"
 	}
 
-	return &Pool{
-		Name:      config.Name,
-		Backends:  backends,
-		Algorithm: algorithm,
-	}, nil
+	// Set up a load balancing algorithm for every priority tier and zone.
+	// Reused instances are only told about changes on commit.
+	var reusable []*tier
+	if previous != nil && previous.algorithm == algorithm && reflect.DeepEqual(previous.args, config.AlgorithmArgs) {
+		reusable = previous.tiers
+	}
+	tiers, notify, err := newTiers(config, algorithm, backends, zone, reusable, reweighted)
+	if err != nil {
+		return nil, err
+	}
+
+	factor := config.OverprovisioningFactor
+	if factor == 0 {
+		factor = DefaultOverprovisioningFactor
+	}
+	minLocal := config.ZoneRouting.MinHealthyPercent
+	if minLocal == 0 {
+		minLocal = DefaultZoneMinHealthyPercent
+	}
+	capped := false
+	for _, backendConfig := range config.Backends {
+		capped = capped || backendConfig.MaxConnections > 0
+	}
+
+	sticky, err := newStickySessions(config.Name, config.StickySession, backends)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve the zone request counters up front, as they are incremented
+	// on every request
+	var zoneRequests map[string]prometheus.Counter
+	if zone != "" {
+		zoneRequests = make(map[string]prometheus.Counter)
+		for _, backendConfig := range config.Backends {
+			if _, ok := zoneRequests[backendConfig.Zone]; !ok {
+				zoneRequests[backendConfig.Zone] = monitoring.ZoneRequestCounter(config.Name, zone, backendConfig.Zone)
+			}
+		}
+	}
+
+	// Requests waiting for a backend keep their place across reloads
+	var queue *requestQueue
+	if previous != nil {
+		queue = previous.queue
+	} else {
+		queue = newRequestQueue(config.Name)
+	}
+
+	pool := &Pool{
+		Name:         config.Name,
+		Backends:     backends,
+		Sticky:       sticky,
+		zone:         zone,
+		algorithm:    algorithm,
+		args:         config.AlgorithmArgs,
+		tiers:        tiers,
+		factor:       factor,
+		minLocal:     float64(minLocal) / 100,
+		queue:        queue,
+		capped:       capped,
+		zoneRequests: zoneRequests,
+	}
+	pool.storeAvailability()
+
+	pool.commit = func() {
+		for i, b := range backends {
+			backendConfig := config.Backends[i]
+			b.SetWeight(backendConfig.Weight)
+			b.SetPriority(backendConfig.Priority, backendConfig.Backup)
+			b.SetZone(backendConfig.Zone)
+			b.ConfigureSlowStart(config.SlowStart)
+			b.SetMaxConnections(backendConfig.MaxConnections)
+
+			// Reused backends keep their circuit state unless its
+			// settings changed
+			backendURL := b.URL.String()
+			b.ConfigureCircuitBreaker(config.CircuitBreaker, func(state backend.BreakerState) {
+				monitoring.RecordCircuitBreakerState(backendURL, config.Name, int(state))
+			})
+		}
+
+		// Backends added to a running pool warm up like recovered ones
+		for _, b := range added {
+			b.StartSlowStart()
+		}
+
+		notify()
+
+		// From now on the backends report to this pool. Catch up on the
+		// changes since the snapshot was taken and on the new weights.
+		for _, b := range backends {
+			b.Watch(pool.availabilityChanged)
+		}
+		pool.update()
+
+		// New limits may let some of the waiting requests through
+		queue.configure(config.MaxPending, config.QueueTimeout)
+		queue.signal()
+	}
+
+	if previous == nil {
+		pool.Commit()
+	}
+	return pool, nil
+}
+
+// ValidateAlgorithm returns an error if name is not a registered load
+// balancing algorithm or args are not valid for it. An empty name selects
+// round robin.
+func ValidateAlgorithm(name string, args configs.Args) error {
+	if name == "" {
+		name = "round_robin"
+	}
+	return algorithms.Validate(name, args)
 }
 
+// ErrAtCapacity is returned when every backend that could take a request is
+// at its connection cap
+var ErrAtCapacity = errors.New("all backends are at their connection cap")
+
 // NextBackend selects the next backend for a request
 func (p *Pool) NextBackend(r *http.Request) (*backend.Backend, error) {
-	p.mutex.RLock()
-	defer p.mutex.RUnlock()
+	return p.NextBackendExcluding(r, nil)
+}
 
-	// Get healthy backends
-	healthyBackends := make([]*backend.Backend, 0, len(p.Backends))
-	for _, b := range p.Backends {
-		if b.IsHealthy() {
-			healthyBackends = append(healthyBackends, b)
+// NextBackendExcluding selects the next backend for a request, skipping the
+// backends in exclude. Retries use it to move on to a backend the request
+// has not been sent to yet.
+func (p *Pool) NextBackendExcluding(r *http.Request, exclude map[*backend.Backend]bool) (*backend.Backend, error) {
+	if !p.HasHealthyBackend(exclude) {
+		if len(exclude) > 0 {
+			return nil, errors.New("no untried available backends")
 		}
+		return nil, errors.New("no healthy backends available")
 	}
 
-	if len(healthyBackends) == 0 {
-		return nil, errors.New("no healthy backends available")
+	// Requests pinned to a backend stay there while it is available and
+	// below its connection cap
+	b := p.Sticky.backend(r)
+	if b != nil && (!b.IsAvailable() || exclude[b] || !acquire(b)) {
+		b = nil
 	}
 
-	// Select backend using the algorithm
-	b := p.Algorithm.NextBackend(r)
+	// Otherwise pick a tier by its healthy capacity and select a backend of
+	// it, falling back to the other tiers in order
 	if b == nil {
+		state := p.state.Load()
+		first := p.firstTier(state, exclude)
+		b = p.tiers[first].next(r, state.tiers[first], exclude, p.minLocal)
+		for i := 0; b == nil && i < len(p.tiers); i++ {
+			if i != first {
+				b = p.tiers[i].next(r, state.tiers[i], exclude, p.minLocal)
+			}
+		}
+	}
+	if b == nil {
+		if p.atCapacity(exclude) {
+			return nil, ErrAtCapacity
+		}
 		return nil, errors.New("failed to select backend")
 	}
 
-	// Update backend stats
+	// Update backend stats; the connection was counted when its slot was
+	// taken
 	b.IncrementRequests()
-	b.IncrementConnections()
+	if p.zone != "" {
+		p.recordZoneRequest(b)
+	}
 
 	return b, nil
 }
 
-// MarkBackendStatus updates the health status of a backend
+// recordZoneRequest counts a request sent to b on the counter of its zone.
+// A zone the pool was not built with, set by a newer pool, is looked up.
+func (p *Pool) recordZoneRequest(b *backend.Backend) {
+	zone := b.GetZone()
+	if counter, ok := p.zoneRequests[zone]; ok {
+		counter.Inc()
+		return
+	}
+	monitoring.RecordZoneRequest(p.Name, p.zone, zone)
+}
+
+// HasHealthyBackend reports whether the pool has an available backend, one
+// that is healthy, not ejected and with a circuit that is not open, that is
+// not in exclude
+func (p *Pool) HasHealthyBackend(exclude map[*backend.Backend]bool) bool {
+	available := p.state.Load().backends
+	if len(exclude) == 0 {
+		return len(available) > 0
+	}
+	for _, b := range available {
+		if !exclude[b] {
+			return true
+		}
+	}
+	return false
+}
+
+// atCapacity reports whether an available backend that is not in exclude
+// is at its connection cap
+func (p *Pool) atCapacity(exclude map[*backend.Backend]bool) bool {
+	for _, b := range p.state.Load().backends {
+		if !exclude[b] && !b.HasCapacity() {
+			return true
+		}
+	}
+	return false
+}
+
+// AwaitBackend selects the next backend for a request like
+// NextBackendExcluding. When every backend that could take the request is
+// at its connection cap, the request waits in the pool's queue until one
+// frees up, it times out or the request is cancelled. Requests are served
+// in order of arrival: while any request waits, new ones queue behind it.
+// Only then, or when every backend is at its cap, do requests of a pool
+// with connection caps select one at a time; otherwise they select without
+// waiting on each other.
+func (p *Pool) AwaitBackend(r *http.Request, exclude map[*backend.Backend]bool) (*backend.Backend, error) {
+	if !p.capped {
+		return p.NextBackendExcluding(r, exclude)
+	}
+	return p.queue.wait(r.Context(), func() (*backend.Backend, error) {
+		return p.NextBackendExcluding(r, exclude)
+	})
+}
+
+// Release gives back the connection slot of a backend selected by
+// NextBackend and its variants once the request is done, and lets the first
+// queued request try again
+func (p *Pool) Release(b *backend.Backend) {
+	b.DecrementConnections()
+	p.queue.signal()
+}
+
+// storeAvailability replaces the snapshot with the backends that are
+// currently available
+func (p *Pool) storeAvailability() {
+	state := &availability{
+		backends: make([]*backend.Backend, 0, len(p.Backends)),
+		tiers:    make([]tierAvailability, len(p.tiers)),
+	}
+	for _, b := range p.Backends {
+		if b.IsAvailable() {
+			state.backends = append(state.backends, b)
+		}
+	}
+	for i, t := range p.tiers {
+		state.tiers[i] = t.availability()
+	}
+	p.state.Store(state)
+}
+
+// ObserveLatency feeds the response time of a backend to algorithms that
+// take latency into account
+func (p *Pool) ObserveLatency(b *backend.Backend, latency time.Duration) {
+	for _, t := range p.tiers {
+		for _, l := range t.localities {
+			if observer, ok := l.algorithm.(algorithms.LatencyObserver); ok {
+				observer.ObserveLatency(b, latency)
+			}
+		}
+	}
+}
+
+// MarkBackendStatus updates the health status of a backend. The backend
+// reports a change in its availability to the pool that watches it, which
+// is the last pool committed with it.
 func (p *Pool) MarkBackendStatus(url string, healthy bool) {
+	for _, b := range p.Backends {
+		if b.URL.String() == url {
+			b.SetHealth(healthy)
+			return
+		}
+	}
+}
+
+// availabilityChanged updates the snapshots of the pool and its algorithms
+// when a backend became available or unavailable, and lets the queued
+// requests try again when one became available. It may be called while the
+// queue's lock is held, when selecting a backend for a queued request moves
+// a circuit to half-open, so the queue is signalled on its own goroutine.
+func (p *Pool) availabilityChanged(b *backend.Backend) {
+	if p.update() {
+		go p.queue.signal()
+	}
+}
+
+// update replaces the snapshot of the pool and tells the algorithms about
+// every backend whose availability differs from the previous snapshot. It
+// reports whether any backend became available.
+func (p *Pool) update() bool {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
+	previous := p.state.Load()
+	p.storeAvailability()
+	current := p.state.Load()
+
+	before := make(map[*backend.Backend]bool, len(previous.backends))
+	for _, b := range previous.backends {
+		before[b] = true
+	}
+	after := make(map[*backend.Backend]bool, len(current.backends))
+	for _, b := range current.backends {
+		after[b] = true
+	}
+
+	returned := false
 	for _, b := range p.Backends {
-		if b.URL.String() == url {
-			b.SetHealth(healthy)
-			break
+		available := after[b]
+		if before[b] == available {
+			continue
+		}
+		returned = returned || available
+		for _, t := range p.tiers {
+			for _, l := range t.localities {
+				if l.member[b] {
+					l.algorithm.HealthChanged(b, available)
+				}
+			}
 		}
 	}
+	return returned
 }
@@ -0,0 +1,170 @@
+package serverpool
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// newTestPool creates a pool of n backends balanced by algorithm, split
+// into two priority tiers
+func newTestPool(t testing.TB, algorithm string, n int) *Pool {
+	t.Helper()
+	config := configs.BackendPoolConfig{Name: "bench", Algorithm: algorithm}
+	for i := 0; i < n; i++ {
+		config.Backends = append(config.Backends, configs.BackendConfig{
+			URL:      fmt.Sprintf("http://10.0.0.%d:8080", i+1),
+			Weight:   1,
+			Priority: i % 2,
+		})
+	}
+	pool, err := NewPool(config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func TestPoolNextBackendDoesNotAllocate(t *testing.T) {
+	// The zoned pool spills over from its local zone, which has a backend
+	// down
+	zoned, err := NewPool(zonedConfig(), "zone-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pools := map[string]*Pool{
+		"tiered": newTestPool(t, "round_robin", 8),
+		"zoned":  zoned,
+	}
+
+	for name, pool := range pools {
+		t.Run(name, func(t *testing.T) {
+			down := pool.Backends[0]
+			pool.MarkBackendStatus(down.URL.String(), false)
+
+			r := httptest.NewRequest("GET", "/", nil)
+			allocs := testing.AllocsPerRun(1000, func() {
+				b, err := pool.NextBackend(r)
+				if err != nil || b == down {
+					t.Fatalf("selected %v: %v", b, err)
+				}
+				pool.Release(b)
+			})
+			if allocs != 0 {
+				t.Errorf("NextBackend allocates %.1f times per call", allocs)
+			}
+		})
+	}
+}
+
+func BenchmarkPoolNextBackend(b *testing.B) {
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, algorithm := range []string{"round_robin", "least_conn", "weighted"} {
+		b.Run(algorithm, func(b *testing.B) {
+			pool := newTestPool(b, algorithm, 16)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if backend, err := pool.NextBackend(r); err == nil {
+						pool.Release(backend)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestRebuildAppliesSettingsOnCommit(t *testing.T) {
+	pool := newTestPool(t, "weighted", 2)
+	b := pool.Backends[0]
+
+	config := configs.BackendPoolConfig{Name: "bench", Algorithm: "weighted"}
+	for _, existing := range pool.Backends {
+		config.Backends = append(config.Backends, configs.BackendConfig{
+			URL:            existing.URL.String(),
+			Weight:         5,
+			Priority:       1,
+			Zone:           "zone-b",
+			MaxConnections: 3,
+		})
+	}
+
+	// A rebuild that fails leaves the shared backends alone
+	invalid := config
+	invalid.StickySession = configs.StickySessionConfig{Mode: "invalid"}
+	if _, err := pool.Rebuild(invalid, ""); err == nil {
+		t.Fatal("rebuild with an invalid sticky session mode succeeded")
+	}
+
+	// So does one that is not committed yet
+	rebuilt, err := pool.Rebuild(config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.Backends[0] != b {
+		t.Fatal("rebuild did not reuse the backend")
+	}
+	if b.GetWeight() != 1 || b.GetPriority() != 0 || b.GetZone() != "" || b.GetMaxConnections() != 0 {
+		t.Fatalf("backend changed before commit: weight %d, priority %d, zone %q, max connections %d",
+			b.GetWeight(), b.GetPriority(), b.GetZone(), b.GetMaxConnections())
+	}
+
+	rebuilt.Commit()
+	if b.GetWeight() != 5 || b.GetPriority() != 1 || b.GetZone() != "zone-b" || b.GetMaxConnections() != 3 {
+		t.Errorf("backend not updated on commit: weight %d, priority %d, zone %q, max connections %d",
+			b.GetWeight(), b.GetPriority(), b.GetZone(), b.GetMaxConnections())
+	}
+}
+
+func TestPoolAvailabilityFollowsBackends(t *testing.T) {
+	tests := []struct {
+		name    string
+		takeOut func(b *backend.Backend)
+	}{
+		{name: "ejection", takeOut: func(b *backend.Backend) {
+			b.Eject(20*time.Millisecond, 20*time.Millisecond)
+		}},
+		{name: "open circuit", takeOut: func(b *backend.Backend) {
+			b.Breaker().Failure()
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := configs.BackendPoolConfig{
+				Name:           "availability",
+				Backends:       []configs.BackendConfig{{URL: "http://10.0.3.1:8080"}},
+				CircuitBreaker: configs.CircuitBreakerConfig{ConsecutiveFailures: 1, OpenDuration: 20 * time.Millisecond},
+			}
+			pool, err := NewPool(config, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := pool.Backends[0]
+
+			tt.takeOut(b)
+			if pool.HasHealthyBackend(nil) {
+				t.Fatal("backend still available")
+			}
+
+			// The backend returns by itself, without a request or a health
+			// check to notice
+			deadline := time.Now().Add(time.Second)
+			for !pool.HasHealthyBackend(nil) {
+				if time.Now().After(deadline) {
+					t.Fatal("backend did not return")
+				}
+				time.Sleep(time.Millisecond)
+			}
+			selected, err := pool.NextBackend(httptest.NewRequest("GET", "/", nil))
+			if err != nil || selected != b {
+				t.Fatalf("selected %v: %v", selected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package serverpool
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+	"github.com/rixtrayker/go-loadbalancer/internal/monitoring"
+)
+
+// DefaultQueueTimeout is how long a request waits for a backend below its
+// connection cap when queue_timeout is not set
+const DefaultQueueTimeout = time.Second
+
+// requestQueue holds the requests of a pool that wait for a backend below
+// its connection cap, first come, first served. When a connection is
+// released, backends are selected for the waiting requests in order until
+// one gets the connection. A request that cannot use it, for instance
+// because a retry already tried that backend, keeps its place and the
+// requests behind it get their turn.
+//
+// While nobody waits, requests select a backend without taking the lock.
+// Only a request that finds every backend at its cap takes it, selects again
+// and otherwise joins the end of the line, so a request that is already
+// waiting keeps its turn.
+type requestQueue struct {
+	pool    string
+	mutex   sync.Mutex
+	waiters list.List
+	waiting atomic.Int32
+	max     int
+	timeout time.Duration
+}
+
+// waiter is a request in the queue. next selects a backend for it; what it
+// returned is sent to result once the request leaves the queue.
+type waiter struct {
+	next    func() (*backend.Backend, error)
+	result  chan selection
+	element *list.Element
+}
+
+// selection is the outcome of next for a waiting request
+type selection struct {
+	backend *backend.Backend
+	err     error
+}
+
+// newRequestQueue creates the queue of a pool
+func newRequestQueue(pool string) *requestQueue {
+	return &requestQueue{pool: pool}
+}
+
+// configure sets how many requests may wait and for how long. Requests
+// already waiting keep their place when the limit is lowered.
+func (q *requestQueue) configure(max int, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultQueueTimeout
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.max = max
+	q.timeout = timeout
+}
+
+// empty reports whether no request is waiting or being admitted
+func (q *requestQueue) empty() bool {
+	return q.waiting.Load() == 0
+}
+
+// signal selects backends for the waiting requests, first in line first,
+// after a connection was released or a backend became available
+func (q *requestQueue) signal() {
+	if q.empty() {
+		return
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.serve()
+}
+
+// serve selects a backend for every waiting request in order and hands it
+// to the request, skipping the requests next cannot find one for. Once one
+// was served, the first request left without a backend ends the pass: the
+// connections that freed up are taken. The caller must hold q.mutex.
+func (q *requestQueue) serve() {
+	served := false
+	for element := q.waiters.Front(); element != nil; {
+		w := element.Value.(*waiter)
+		b, err := w.next()
+		if errors.Is(err, ErrAtCapacity) {
+			if served {
+				return
+			}
+			element = element.Next()
+			continue
+		}
+
+		element = element.Next()
+		q.remove(w)
+		w.result <- selection{backend: b, err: err}
+		served = served || err == nil
+	}
+}
+
+// remove takes w out of the queue. The caller must hold q.mutex.
+func (q *requestQueue) remove(w *waiter) {
+	q.waiters.Remove(w.element)
+	w.element = nil
+	q.waiting.Add(-1)
+	monitoring.RecordQueueDepth(q.pool, q.waiters.Len())
+}
+
+// wait selects a backend with next. When nobody is waiting and next finds
+// one, or fails for a reason other than connection caps, it returns at once.
+// Otherwise the request joins the queue until a backend is selected for it
+// or next fails for another reason. It gives up when the queue is full, the
+// queue timeout passes or ctx is done.
+func (q *requestQueue) wait(ctx context.Context, next func() (*backend.Backend, error)) (*backend.Backend, error) {
+	if q.empty() {
+		b, err := next()
+		if !errors.Is(err, ErrAtCapacity) {
+			return b, err
+		}
+	}
+
+	q.mutex.Lock()
+
+	// Select again, as a connection may have been released since. The
+	// request counts as waiting while it selects, so that a connection
+	// released meanwhile is offered to it once it has joined the queue.
+	q.waiting.Add(1)
+	if q.waiters.Len() == 0 {
+		b, err := next()
+		if !errors.Is(err, ErrAtCapacity) {
+			q.waiting.Add(-1)
+			q.mutex.Unlock()
+			return b, err
+		}
+	}
+
+	if q.waiters.Len() >= q.max {
+		max := q.max
+		q.waiting.Add(-1)
+		q.mutex.Unlock()
+		monitoring.RecordQueueRejection(q.pool, "full")
+		if max == 0 {
+			return nil, ErrAtCapacity
+		}
+		return nil, fmt.Errorf("%w: queue is full", ErrAtCapacity)
+	}
+	w := &waiter{next: next, result: make(chan selection, 1)}
+	w.element = q.waiters.PushBack(w)
+	timeout := q.timeout
+	monitoring.RecordQueueDepth(q.pool, q.waiters.Len())
+	q.mutex.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case s := <-w.result:
+		return q.served(s, start)
+
+	case <-timer.C:
+		if !q.leave(w) {
+			return q.served(<-w.result, start)
+		}
+		monitoring.RecordQueueWait(q.pool, "timeout", time.Since(start))
+		monitoring.RecordQueueRejection(q.pool, "timeout")
+		return nil, fmt.Errorf("%w: no backend freed up within %s", ErrAtCapacity, timeout)
+
+	case <-ctx.Done():
+		if !q.leave(w) {
+			return q.served(<-w.result, start)
+		}
+		monitoring.RecordQueueWait(q.pool, "canceled", time.Since(start))
+		return nil, ctx.Err()
+	}
+}
+
+// served records how long a request that left the queue with s waited and
+// returns s
+func (q *requestQueue) served(s selection, start time.Time) (*backend.Backend, error) {
+	outcome := "served"
+	if s.err != nil {
+		outcome = "failed"
+	}
+	monitoring.RecordQueueWait(q.pool, outcome, time.Since(start))
+	return s.backend, s.err
+}
+
+// leave takes a request that gives up out of the queue. It returns false
+// when a backend was selected for the request in the meantime, which the
+// request must then use or release.
+func (q *requestQueue) leave(w *waiter) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if w.element == nil {
+		return false
+	}
+	q.remove(w)
+	return true
+}
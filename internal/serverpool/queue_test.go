@@ -0,0 +1,226 @@
+package serverpool
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// newCappedPool creates a pool of n backends that take one connection each
+func newCappedPool(t *testing.T, n, maxPending int, timeout time.Duration) *Pool {
+	t.Helper()
+	config := configs.BackendPoolConfig{Name: "queue", MaxPending: maxPending, QueueTimeout: timeout}
+	for i := 0; i < n; i++ {
+		config.Backends = append(config.Backends, configs.BackendConfig{
+			URL:            fmt.Sprintf("http://10.0.2.%d:8080", i+1),
+			MaxConnections: 1,
+		})
+	}
+	pool, err := NewPool(config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+// length returns the number of requests in the queue
+func (q *requestQueue) length() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.waiters.Len()
+}
+
+// await selects a backend for a new request, failing the test if there is
+// none
+func await(t *testing.T, pool *Pool) *backend.Backend {
+	t.Helper()
+	b, err := pool.AwaitBackend(httptest.NewRequest("GET", "/", nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// queued is the outcome of a request that waited in the queue
+type queued struct {
+	id      int
+	backend *backend.Backend
+	err     error
+}
+
+// enqueue starts a request that selects a backend outside the ones in
+// exclude and waits until it is in the queue
+func enqueue(t *testing.T, pool *Pool, id int, exclude map[*backend.Backend]bool, results chan<- queued) {
+	t.Helper()
+	position := pool.queue.length() + 1
+	go func() {
+		b, err := pool.AwaitBackend(httptest.NewRequest("GET", "/", nil), exclude)
+		results <- queued{id: id, backend: b, err: err}
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for pool.queue.length() < position {
+		if time.Now().After(deadline) {
+			t.Fatalf("request %d was not queued", id)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// receive returns the next queued request that got a backend or gave up
+func receive(t *testing.T, results <-chan queued) queued {
+	t.Helper()
+	select {
+	case result := <-results:
+		return result
+	case <-time.After(time.Second):
+		t.Fatal("no queued request was served")
+		return queued{}
+	}
+}
+
+func TestQueueServesInOrder(t *testing.T) {
+	pool := newCappedPool(t, 1, 10, time.Minute)
+	b := await(t, pool)
+
+	results := make(chan queued, 4)
+	for id := 0; id < 4; id++ {
+		enqueue(t, pool, id, nil, results)
+	}
+
+	// Each released connection goes to the request that waited longest
+	for id := 0; id < 4; id++ {
+		pool.Release(b)
+		result := receive(t, results)
+		if result.err != nil {
+			t.Fatalf("request %d: %v", result.id, result.err)
+		}
+		if result.id != id {
+			t.Fatalf("request %d was served before request %d", result.id, id)
+		}
+	}
+	if depth := pool.queue.length(); depth != 0 {
+		t.Errorf("%d requests left in the queue", depth)
+	}
+}
+
+func TestQueueTimeout(t *testing.T) {
+	pool := newCappedPool(t, 1, 10, 20*time.Millisecond)
+	await(t, pool)
+
+	start := time.Now()
+	_, err := pool.AwaitBackend(httptest.NewRequest("GET", "/", nil), nil)
+	if !errors.Is(err, ErrAtCapacity) {
+		t.Fatalf("got %v, expected %v", err, ErrAtCapacity)
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("gave up after %s, before the queue timeout", waited)
+	}
+	if depth := pool.queue.length(); depth != 0 {
+		t.Errorf("%d requests left in the queue", depth)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	tests := []struct {
+		maxPending int
+	}{
+		{maxPending: 0},
+		{maxPending: 1},
+		{maxPending: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.maxPending), func(t *testing.T) {
+			pool := newCappedPool(t, 1, tt.maxPending, time.Minute)
+			b := await(t, pool)
+
+			results := make(chan queued, tt.maxPending)
+			for id := 0; id < tt.maxPending; id++ {
+				enqueue(t, pool, id, nil, results)
+			}
+
+			// Requests beyond max_pending are rejected without waiting
+			start := time.Now()
+			_, err := pool.AwaitBackend(httptest.NewRequest("GET", "/", nil), nil)
+			if !errors.Is(err, ErrAtCapacity) {
+				t.Fatalf("got %v, expected %v", err, ErrAtCapacity)
+			}
+			if waited := time.Since(start); waited > 100*time.Millisecond {
+				t.Errorf("rejected after %s", waited)
+			}
+
+			for i := 0; i < tt.maxPending; i++ {
+				pool.Release(b)
+				if result := receive(t, results); result.err != nil {
+					t.Fatalf("request %d: %v", result.id, result.err)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueRetryExclude(t *testing.T) {
+	pool := newCappedPool(t, 2, 10, time.Minute)
+	first, second := await(t, pool), await(t, pool)
+
+	// A retry that already tried the first backend waits ahead of a new
+	// request
+	results := make(chan queued, 2)
+	enqueue(t, pool, 0, map[*backend.Backend]bool{first: true}, results)
+	enqueue(t, pool, 1, nil, results)
+
+	// The retry cannot use the first backend, so the request behind it
+	// takes it
+	pool.Release(first)
+	result := receive(t, results)
+	if result.id != 1 || result.backend != first {
+		t.Fatalf("request %d got %v, expected request 1 to get the released backend", result.id, result.backend)
+	}
+
+	pool.Release(second)
+	result = receive(t, results)
+	if result.id != 0 || result.backend != second {
+		t.Fatalf("request %d got %v, expected the retry to get the other backend", result.id, result.backend)
+	}
+}
+
+func TestQueueSelectsWithoutLockWhileEmpty(t *testing.T) {
+	pool := newCappedPool(t, 2, 10, time.Minute)
+
+	// Hold the lock: selecting a free backend must not need it
+	pool.queue.mutex.Lock()
+	done := make(chan *backend.Backend)
+	go func() {
+		b, _ := pool.AwaitBackend(httptest.NewRequest("GET", "/", nil), nil)
+		done <- b
+	}()
+	select {
+	case b := <-done:
+		if b == nil {
+			t.Error("no backend selected")
+		}
+	case <-time.After(time.Second):
+		t.Error("selecting a free backend waited for the queue lock")
+	}
+	pool.queue.mutex.Unlock()
+}
+
+func TestRebuildKeepsQueue(t *testing.T) {
+	pool := newCappedPool(t, 1, 10, time.Minute)
+	config := configs.BackendPoolConfig{Name: pool.Name, MaxPending: 10}
+	config.Backends = []configs.BackendConfig{{URL: pool.Backends[0].URL.String(), MaxConnections: 1}}
+
+	rebuilt, err := pool.Rebuild(config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.queue != pool.queue {
+		t.Error("rebuilt pool has a queue of its own")
+	}
+}
@@ -0,0 +1,257 @@
+package serverpool
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// Sticky session modes
+const (
+	StickyCookie = "cookie"
+	StickyHeader = "header"
+)
+
+// Sticky session defaults, used for zero values in
+// configs.StickySessionConfig
+const (
+	DefaultStickyCookieName = "lb_session"
+	DefaultStickyHeaderName = "X-LB-Session"
+	DefaultStickyPath       = "/"
+)
+
+// sameSiteModes maps the same_site setting to the cookie attribute
+var sameSiteModes = map[string]http.SameSite{
+	"":       http.SameSiteLaxMode,
+	"lax":    http.SameSiteLaxMode,
+	"strict": http.SameSiteStrictMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+// processKey signs sticky sessions of pools without a secret
+var (
+	processKey     []byte
+	processKeyOnce sync.Once
+)
+
+// StickySessions pins clients to a backend of a pool. The backend is named
+// in a signed cookie or header of the form <id>.<expiry>.<signature>, set on
+// the first response and sent back by the client. A nil *StickySessions
+// disables sticky sessions.
+type StickySessions struct {
+	pool     string
+	mode     string
+	name     string
+	key      []byte
+	ttl      time.Duration
+	path     string
+	sameSite http.SameSite
+	secure   bool
+	ids      map[*backend.Backend]string
+	backends map[string]*backend.Backend
+}
+
+// newStickySessions creates the sticky sessions of a pool, or returns nil
+// when config disables them
+func newStickySessions(pool string, config configs.StickySessionConfig, backends []*backend.Backend) (*StickySessions, error) {
+	if config.Mode == "" {
+		return nil, nil
+	}
+
+	s := &StickySessions{
+		pool:     pool,
+		mode:     config.Mode,
+		name:     config.Name,
+		key:      []byte(config.Secret),
+		ttl:      config.TTL,
+		path:     config.Path,
+		secure:   config.Secure,
+		ids:      make(map[*backend.Backend]string, len(backends)),
+		backends: make(map[string]*backend.Backend, len(backends)),
+	}
+
+	switch config.Mode {
+	case StickyCookie:
+		if s.name == "" {
+			s.name = DefaultStickyCookieName
+		}
+	case StickyHeader:
+		if s.name == "" {
+			s.name = DefaultStickyHeaderName
+		}
+	default:
+		return nil, fmt.Errorf("unknown sticky session mode: %s", config.Mode)
+	}
+
+	sameSite, ok := sameSiteModes[strings.ToLower(config.SameSite)]
+	if !ok {
+		return nil, fmt.Errorf("unknown same_site mode: %s", config.SameSite)
+	}
+	if sameSite == http.SameSiteNoneMode && !config.Secure {
+		return nil, fmt.Errorf("same_site none requires secure cookies")
+	}
+	s.sameSite = sameSite
+
+	if config.TTL < 0 {
+		return nil, fmt.Errorf("ttl must not be negative")
+	}
+	if s.path == "" {
+		s.path = DefaultStickyPath
+	}
+	if len(s.key) == 0 {
+		s.key = randomKey()
+	}
+
+	for _, b := range backends {
+		sum := sha256.Sum256([]byte(b.URL.String()))
+		id := hex.EncodeToString(sum[:8])
+		s.ids[b] = id
+		s.backends[id] = b
+	}
+	return s, nil
+}
+
+// ValidateStickySession returns an error if config is not a valid sticky
+// session configuration
+func ValidateStickySession(config configs.StickySessionConfig) error {
+	_, err := newStickySessions("", config, nil)
+	return err
+}
+
+// randomKey returns the signing key of this process, generating it on first
+// use
+func randomKey() []byte {
+	processKeyOnce.Do(func() {
+		processKey = make([]byte, 32)
+		if _, err := rand.Read(processKey); err != nil {
+			panic(fmt.Sprintf("failed to generate sticky session key: %v", err))
+		}
+	})
+	return processKey
+}
+
+// backend returns the backend the request is pinned to, or nil when it
+// carries no valid, unexpired session
+func (s *StickySessions) backend(r *http.Request) *backend.Backend {
+	if s == nil {
+		return nil
+	}
+	id, _, ok := s.verify(s.value(r), time.Now())
+	if !ok {
+		return nil
+	}
+	return s.backends[id]
+}
+
+// Stick pins the client to b by setting the session on the response
+// header h, unless request r is already pinned to b by a session that is
+// not yet past half of its TTL. Renewing older sessions keeps active
+// clients on their backend.
+func (s *StickySessions) Stick(r *http.Request, h http.Header, b *backend.Backend) {
+	if s == nil {
+		return
+	}
+	id, ok := s.ids[b]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if current, expiry, ok := s.verify(s.value(r), now); ok && current == id && !s.renew(expiry, now) {
+		return
+	}
+
+	value := s.sign(id, now)
+	if s.mode == StickyHeader {
+		h.Set(s.name, value)
+		return
+	}
+
+	cookie := &http.Cookie{
+		Name:     s.name,
+		Value:    value,
+		Path:     s.path,
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: s.sameSite,
+	}
+	if s.ttl > 0 {
+		cookie.MaxAge = int(s.ttl / time.Second)
+		if cookie.MaxAge == 0 {
+			cookie.MaxAge = 1
+		}
+	}
+	h.Add("Set-Cookie", cookie.String())
+}
+
+// value returns the session the request carries
+func (s *StickySessions) value(r *http.Request) string {
+	if s.mode == StickyHeader {
+		return r.Header.Get(s.name)
+	}
+	if c, err := r.Cookie(s.name); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// sign returns the session value for backend id issued at now. Sessions
+// without a TTL never expire.
+func (s *StickySessions) sign(id string, now time.Time) string {
+	var expiry int64
+	if s.ttl > 0 {
+		expiry = now.Add(s.ttl).Unix()
+	}
+	payload := id + "." + strconv.FormatInt(expiry, 10)
+	return payload + "." + s.signature(payload)
+}
+
+// verify returns the backend id and expiry, in Unix seconds or 0 for none,
+// of a session value whose signature is valid and that has not expired at
+// now
+func (s *StickySessions) verify(value string, now time.Time) (string, int64, bool) {
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 {
+		return "", 0, false
+	}
+	payload, signature := value[:i], value[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(s.signature(payload))) {
+		return "", 0, false
+	}
+
+	id, expiryText, ok := strings.Cut(payload, ".")
+	if !ok {
+		return "", 0, false
+	}
+	expiry, err := strconv.ParseInt(expiryText, 10, 64)
+	if err != nil || (expiry > 0 && now.Unix() >= expiry) {
+		return "", 0, false
+	}
+	return id, expiry, true
+}
+
+// renew reports whether a session expiring at expiry is past half of its
+// TTL at now
+func (s *StickySessions) renew(expiry int64, now time.Time) bool {
+	return expiry > 0 && time.Unix(expiry, 0).Sub(now) < s.ttl/2
+}
+
+// signature signs payload for the pool, so sessions of one pool are not
+// accepted by another
+func (s *StickySessions) signature(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(s.pool))
+	mac.Write([]byte{0})
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
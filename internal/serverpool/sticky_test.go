@@ -0,0 +1,258 @@
+package serverpool
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// newTestSticky creates sticky sessions for pool over two backends
+func newTestSticky(t *testing.T, pool string, config configs.StickySessionConfig) (*StickySessions, []*backend.Backend) {
+	t.Helper()
+	backends := make([]*backend.Backend, 2)
+	for i := range backends {
+		b, err := backend.NewBackend(fmt.Sprintf("http://10.0.6.%d:8080", i+1), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backends[i] = b
+	}
+	s, err := newStickySessions(pool, config, backends)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, backends
+}
+
+// stickyRequest returns a request carrying the session set on h, if any
+func stickyRequest(s *StickySessions, h http.Header) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	if s.mode == StickyHeader {
+		r.Header.Set(s.name, h.Get(s.name))
+		return r
+	}
+	for _, c := range (&http.Response{Header: h}).Cookies() {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+func TestStickyRoundTrip(t *testing.T) {
+	for _, mode := range []string{StickyCookie, StickyHeader} {
+		t.Run(mode, func(t *testing.T) {
+			s, backends := newTestSticky(t, "app", configs.StickySessionConfig{Mode: mode, Secret: "secret"})
+
+			h := http.Header{}
+			s.Stick(httptest.NewRequest("GET", "/", nil), h, backends[1])
+			r := stickyRequest(s, h)
+			if b := s.backend(r); b != backends[1] {
+				t.Fatalf("pinned to %v, want %s", b, backends[1].URL)
+			}
+
+			// A pinned client is not sent a new session
+			again := http.Header{}
+			s.Stick(r, again, backends[1])
+			if len(again) != 0 {
+				t.Errorf("session set again: %v", again)
+			}
+
+			// A client moved to another backend is
+			s.Stick(r, again, backends[0])
+			if b := s.backend(stickyRequest(s, again)); b != backends[0] {
+				t.Errorf("pinned to %v after the move, want %s", b, backends[0].URL)
+			}
+		})
+	}
+}
+
+func TestStickyRejectsInvalidSessions(t *testing.T) {
+	s, backends := newTestSticky(t, "app", configs.StickySessionConfig{Mode: StickyHeader, Secret: "secret", TTL: time.Hour})
+	other, _ := newTestSticky(t, "api", configs.StickySessionConfig{Mode: StickyHeader, Secret: "secret", TTL: time.Hour})
+	rekeyed, _ := newTestSticky(t, "app", configs.StickySessionConfig{Mode: StickyHeader, Secret: "other", TTL: time.Hour})
+
+	now := time.Now()
+	valid := s.sign(s.ids[backends[0]], now)
+	id, expiry, signature := splitSession(t, valid)
+
+	tests := []struct {
+		name  string
+		s     *StickySessions
+		value string
+		now   time.Time
+	}{
+		{name: "empty", s: s, value: "", now: now},
+		{name: "garbage", s: s, value: "not-a-session", now: now},
+		{name: "other backend", s: s, value: s.ids[backends[1]] + "." + expiry + "." + signature, now: now},
+		{name: "later expiry", s: s, value: id + ".9999999999." + signature, now: now},
+		{name: "tampered signature", s: s, value: id + "." + expiry + "." + strings.ToUpper(signature), now: now},
+		{name: "expired", s: s, value: valid, now: now.Add(time.Hour + time.Second)},
+		{name: "other pool", s: other, value: valid, now: now},
+		{name: "other secret", s: rekeyed, value: valid, now: now},
+	}
+
+	if _, _, ok := s.verify(valid, now); !ok {
+		t.Fatal("valid session rejected")
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, ok := tt.s.verify(tt.value, tt.now); ok {
+				t.Errorf("session %q accepted", tt.value)
+			}
+		})
+	}
+}
+
+// splitSession splits a session value into its id, expiry and signature
+func splitSession(t *testing.T, value string) (string, string, string) {
+	t.Helper()
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		t.Fatalf("session %q does not have three parts", value)
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+func TestStickyRenewsOldSessions(t *testing.T) {
+	s, backends := newTestSticky(t, "app", configs.StickySessionConfig{Mode: StickyHeader, TTL: time.Hour})
+	id := s.ids[backends[0]]
+
+	tests := []struct {
+		name   string
+		issued time.Duration // ago
+		renew  bool
+	}{
+		{name: "fresh", issued: time.Minute},
+		{name: "before half of the ttl", issued: 29 * time.Minute},
+		{name: "past half of the ttl", issued: 31 * time.Minute, renew: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set(s.name, s.sign(id, time.Now().Add(-tt.issued)))
+			h := http.Header{}
+			s.Stick(r, h, backends[0])
+			if renewed := h.Get(s.name) != ""; renewed != tt.renew {
+				t.Errorf("renewed = %v, want %v", renewed, tt.renew)
+			}
+		})
+	}
+}
+
+func TestStickyCookieAttributes(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   configs.StickySessionConfig
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "defaults",
+			config:   configs.StickySessionConfig{Mode: StickyCookie},
+			contains: []string{"lb_session=", "Path=/", "HttpOnly", "SameSite=Lax"},
+			excludes: []string{"Secure", "Max-Age"},
+		},
+		{
+			name: "configured",
+			config: configs.StickySessionConfig{
+				Mode: StickyCookie, Name: "affinity", Path: "/app", TTL: 90 * time.Second,
+				SameSite: "none", Secure: true,
+			},
+			contains: []string{"affinity=", "Path=/app", "Max-Age=90", "HttpOnly", "Secure", "SameSite=None"},
+		},
+		{
+			name:     "ttl below a second",
+			config:   configs.StickySessionConfig{Mode: StickyCookie, TTL: time.Millisecond, SameSite: "strict"},
+			contains: []string{"Max-Age=1", "SameSite=Strict"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, backends := newTestSticky(t, "app", tt.config)
+			h := http.Header{}
+			s.Stick(httptest.NewRequest("GET", "/", nil), h, backends[0])
+			cookie := h.Get("Set-Cookie")
+			for _, attribute := range tt.contains {
+				if !strings.Contains(cookie, attribute) {
+					t.Errorf("cookie %q lacks %s", cookie, attribute)
+				}
+			}
+			for _, attribute := range tt.excludes {
+				if strings.Contains(cookie, attribute) {
+					t.Errorf("cookie %q has %s", cookie, attribute)
+				}
+			}
+		})
+	}
+}
+
+func TestStickyConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  configs.StickySessionConfig
+		wantErr bool
+	}{
+		{name: "disabled", config: configs.StickySessionConfig{}},
+		{name: "header", config: configs.StickySessionConfig{Mode: StickyHeader}},
+		{name: "unknown mode", config: configs.StickySessionConfig{Mode: "url"}, wantErr: true},
+		{name: "unknown same site", config: configs.StickySessionConfig{Mode: StickyCookie, SameSite: "loose"}, wantErr: true},
+		{name: "same site none without secure", config: configs.StickySessionConfig{Mode: StickyCookie, SameSite: "none"}, wantErr: true},
+		{name: "negative ttl", config: configs.StickySessionConfig{Mode: StickyCookie, TTL: -time.Second}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateStickySession(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateStickySession() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStickyFallsBackWhenUnavailable(t *testing.T) {
+	config := configs.BackendPoolConfig{
+		Name:          "sticky",
+		Algorithm:     "round_robin",
+		StickySession: configs.StickySessionConfig{Mode: StickyHeader, Secret: "secret"},
+		Backends: []configs.BackendConfig{
+			{URL: "http://10.0.7.1:8080", Weight: 1},
+			{URL: "http://10.0.7.2:8080", Weight: 1},
+		},
+	}
+	pool, err := NewPool(config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := pool.Backends[1]
+	h := http.Header{}
+	pool.Sticky.Stick(httptest.NewRequest("GET", "/", nil), h, pinned)
+	r := stickyRequest(pool.Sticky, h)
+
+	for i := 0; i < 5; i++ {
+		b, err := pool.NextBackend(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool.Release(b)
+		if b != pinned {
+			t.Fatalf("pick %d went to %s, want the pinned backend", i, b.URL)
+		}
+	}
+
+	pool.MarkBackendStatus(pinned.URL.String(), false)
+	b, err := pool.NextBackend(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Release(b)
+	if b == pinned {
+		t.Error("request sent to the unavailable pinned backend")
+	}
+}
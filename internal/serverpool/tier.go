@@ -0,0 +1,412 @@
+package serverpool
+
+import (
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+	"github.com/rixtrayker/go-loadbalancer/internal/monitoring"
+	"github.com/rixtrayker/go-loadbalancer/internal/serverpool/algorithms"
+)
+
+// DefaultOverprovisioningFactor is the overprovisioning factor used when
+// overprovisioning_factor is not set: a tier keeps all of its traffic while
+// at least 1/1.4, about 71%, of its backends are available
+const DefaultOverprovisioningFactor = 1.4
+
+// DefaultZoneMinHealthyPercent is the share of the local zone's capacity
+// that must be available to keep all traffic in the zone when
+// min_healthy_percent is not set
+const DefaultZoneMinHealthyPercent = 70
+
+// tier is a priority level of a pool: the backends with the same priority,
+// or the backups with the same priority. With zone routing the tier is split
+// into localities, one per zone; otherwise it has a single locality. The
+// spillover gauge of a split tier is resolved once, as it is set on every
+// request.
+type tier struct {
+	priority   int
+	backup     bool
+	backends   []*backend.Backend
+	localities []*locality
+	local      *locality
+	spillover  prometheus.Gauge
+}
+
+// tierAvailability is the number of available backends of a tier and the
+// capacity of each of its localities, in the order of its localities
+type tierAvailability struct {
+	backends   int
+	localities []localityAvailability
+}
+
+// localityAvailability is the total weight of the backends of a locality
+// and of the ones that are available
+type localityAvailability struct {
+	available int
+	total     int
+}
+
+// locality is the backends of a tier in one zone, balanced by their own
+// instance of the pool's algorithm. An instance reused by a rebuilt pool is
+// shared with the previous pool, so candidates it returns are checked
+// against member.
+type locality struct {
+	zone      string
+	backends  []*backend.Backend
+	member    map[*backend.Backend]bool
+	algorithm algorithms.Algorithm
+}
+
+// newTiers groups backends into tiers, preferred tiers first: by priority,
+// with the backups after every other tier. With zone routing enabled, tiers
+// that have backends in zone are split by zone.
+//
+// Every locality gets a new instance of algorithm, or takes over
+// the instance of the matching locality in reusable. Localities follow the
+// priorities and zones in config rather than the current settings of the
+// backends. The returned notify function tells reused instances which
+// backends were added and removed, and every instance which backends have
+// new weights; backends in reweighted count as both removed and added.
+func newTiers(config configs.BackendPoolConfig, algorithm string, backends []*backend.Backend, zone string, reusable []*tier, reweighted map[*backend.Backend]bool) ([]*tier, func(), error) {
+	var tiers []*tier
+	for i, b := range backends {
+		priority, backup := config.Backends[i].Priority, config.Backends[i].Backup
+
+		var t *tier
+		for _, existing := range tiers {
+			if existing.priority == priority && existing.backup == backup {
+				t = existing
+				break
+			}
+		}
+		if t == nil {
+			t = &tier{priority: priority, backup: backup}
+			tiers = append(tiers, t)
+		}
+		t.backends = append(t.backends, b)
+	}
+
+	sort.SliceStable(tiers, func(i, j int) bool {
+		if tiers[i].backup != tiers[j].backup {
+			return !tiers[i].backup
+		}
+		return tiers[i].priority < tiers[j].priority
+	})
+
+	zones := make(map[*backend.Backend]string, len(backends))
+	for i, b := range backends {
+		zones[b] = config.Backends[i].Zone
+	}
+
+	var changes []func()
+	for _, t := range tiers {
+		t.localities = []*locality{{backends: t.backends}}
+		if config.ZoneRouting.Enabled && zone != "" {
+			t.splitZones(zone, zones)
+		}
+		if t.local != nil {
+			t.spillover = monitoring.ZoneSpilloverGauge(config.Name, zone)
+		}
+		for _, l := range t.localities {
+			l.member = make(map[*backend.Backend]bool, len(l.backends))
+			for _, b := range l.backends {
+				l.member[b] = true
+			}
+
+			if prev := findLocality(reusable, t, l.zone); prev != nil {
+				l.algorithm = prev.algorithm
+				changes = append(changes, membershipChanges(prev, l, reweighted))
+				continue
+			}
+			instance, err := algorithms.New(algorithm, l.backends, config.AlgorithmArgs)
+			if err != nil {
+				return nil, nil, err
+			}
+			l.algorithm = instance
+			changes = append(changes, membershipChanges(l, l, reweighted))
+		}
+	}
+
+	notify := func() {
+		for _, change := range changes {
+			change()
+		}
+	}
+	return tiers, notify, nil
+}
+
+// findLocality returns the locality in tiers with the priority and backup
+// flag of t and the given zone, or nil
+func findLocality(tiers []*tier, t *tier, zone string) *locality {
+	for _, prev := range tiers {
+		if prev.priority != t.priority || prev.backup != t.backup {
+			continue
+		}
+		for _, l := range prev.localities {
+			if l.zone == zone {
+				return l
+			}
+		}
+	}
+	return nil
+}
+
+// membershipChanges returns a function that tells the algorithm of prev,
+// reused by next, which backends left and joined. For a new instance prev
+// is next, and only the reweighted backends are reported.
+func membershipChanges(prev, next *locality, reweighted map[*backend.Backend]bool) func() {
+	return func() {
+		for _, b := range prev.backends {
+			if !next.member[b] || reweighted[b] {
+				next.algorithm.BackendRemoved(b)
+			}
+		}
+		for _, b := range next.backends {
+			if !prev.member[b] || reweighted[b] {
+				next.algorithm.BackendAdded(b)
+			}
+		}
+	}
+}
+
+// splitZones splits the tier into one locality per zone, unless none of its
+// backends is in the local zone. zones holds the zone of every backend.
+func (t *tier) splitZones(zone string, zones map[*backend.Backend]string) {
+	var localities []*locality
+	var local *locality
+	for _, b := range t.backends {
+		var l *locality
+		for _, existing := range localities {
+			if existing.zone == zones[b] {
+				l = existing
+				break
+			}
+		}
+		if l == nil {
+			l = &locality{zone: zones[b]}
+			localities = append(localities, l)
+		}
+		l.backends = append(l.backends, b)
+		if l.zone == zone {
+			local = l
+		}
+	}
+
+	if local != nil {
+		t.localities = localities
+		t.local = local
+	}
+}
+
+// availability counts the available backends and capacity of the tier
+func (t *tier) availability() tierAvailability {
+	counts := tierAvailability{localities: make([]localityAvailability, len(t.localities))}
+	for _, b := range t.backends {
+		if b.IsAvailable() {
+			counts.backends++
+		}
+	}
+	for i, l := range t.localities {
+		counts.localities[i] = localityAvailability{
+			available: availableCapacity(l.backends, nil),
+			total:     totalCapacity(l.backends),
+		}
+	}
+	return counts
+}
+
+// next selects a backend of the tier that is not in exclude, trying the
+// locality firstLocality returns and then the others. counts is the tier's
+// availability from the pool's snapshot.
+func (t *tier) next(r *http.Request, counts tierAvailability, exclude map[*backend.Backend]bool, minLocal float64) *backend.Backend {
+	first := t.firstLocality(counts, exclude, minLocal)
+	if b := first.next(r, exclude); b != nil {
+		return b
+	}
+	for _, l := range t.localities {
+		if l == first {
+			continue
+		}
+		if b := l.next(r, exclude); b != nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// firstLocality returns the locality to try first. The local zone comes
+// first while at least minLocal of its capacity is available. Below that,
+// the first locality is picked at random in proportion to the available
+// capacity of each zone.
+func (t *tier) firstLocality(counts tierAvailability, exclude map[*backend.Backend]bool, minLocal float64) *locality {
+	if t.local == nil {
+		return t.localities[0]
+	}
+
+	var localAvailable, localTotal int
+	for i, l := range t.localities {
+		if l == t.local {
+			localAvailable = t.capacity(i, counts, exclude)
+			localTotal = counts.localities[i].total
+		}
+	}
+	spill := float64(localAvailable) < minLocal*float64(localTotal)
+	monitoring.SetZoneSpillover(t.spillover, spill)
+	if !spill {
+		return t.local
+	}
+
+	total := 0
+	for i := range t.localities {
+		total += t.capacity(i, counts, exclude)
+	}
+	if total == 0 {
+		return t.local
+	}
+
+	// Without exclude the capacities come from the snapshot. Otherwise they
+	// may change between the two passes; whatever is left of the pick goes
+	// to the local zone.
+	pick := rand.IntN(total)
+	for i, l := range t.localities {
+		capacity := t.capacity(i, counts, exclude)
+		if pick < capacity {
+			return l
+		}
+		pick -= capacity
+	}
+	return t.local
+}
+
+// capacity returns the available capacity of locality i that is not in
+// exclude, taken from counts when nothing is excluded
+func (t *tier) capacity(i int, counts tierAvailability, exclude map[*backend.Backend]bool) int {
+	if len(exclude) == 0 {
+		return counts.localities[i].available
+	}
+	return availableCapacity(t.localities[i].backends, exclude)
+}
+
+// next selects a backend of the locality that is not in exclude and takes
+// a connection slot of it. The algorithm knows nothing about exclude or
+// connection caps, so ask again while it picks excluded or full backends.
+func (l *locality) next(r *http.Request, exclude map[*backend.Backend]bool) *backend.Backend {
+	for i := 0; i < len(l.backends); i++ {
+		candidate := l.algorithm.NextBackend(r)
+		if candidate == nil {
+			break
+		}
+		if l.member[candidate] && !exclude[candidate] && acquire(candidate) {
+			return candidate
+		}
+	}
+
+	// The algorithm keeps choosing the same backends, e.g. least_conn
+	for _, candidate := range l.backends {
+		if candidate.IsAvailable() && !exclude[candidate] && acquire(candidate) {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// acquire takes a connection slot of b and, when its circuit is half open,
+// a trial slot, which another request may have taken since the algorithm
+// looked. It reports whether b can take the request.
+func acquire(b *backend.Backend) bool {
+	if !b.AcquireConnection() {
+		return false
+	}
+	if !b.Breaker().Allow() {
+		b.DecrementConnections()
+		return false
+	}
+	return true
+}
+
+// availableCapacity returns the total weight of the backends that are
+// available and not in exclude
+func availableCapacity(backends []*backend.Backend, exclude map[*backend.Backend]bool) int {
+	capacity := 0
+	for _, b := range backends {
+		if b.IsAvailable() && !exclude[b] {
+			capacity += capacityOf(b)
+		}
+	}
+	return capacity
+}
+
+// totalCapacity returns the total weight of the backends
+func totalCapacity(backends []*backend.Backend) int {
+	capacity := 0
+	for _, b := range backends {
+		capacity += capacityOf(b)
+	}
+	return capacity
+}
+
+// capacityOf returns the weight of a backend, treating unset weights as 1
+func capacityOf(b *backend.Backend) int {
+	if w := b.GetWeight(); w > 0 {
+		return w
+	}
+	return 1
+}
+
+// health returns the share of the tier's backends that are available and
+// not in exclude, scaled by the overprovisioning factor and capped at 1.
+// Without exclude the count comes from counts.
+func (t *tier) health(counts tierAvailability, exclude map[*backend.Backend]bool, factor float64) float64 {
+	available := counts.backends
+	if len(exclude) > 0 {
+		available = 0
+		for _, b := range t.backends {
+			if b.IsAvailable() && !exclude[b] {
+				available++
+			}
+		}
+	}
+	return math.Min(1, factor*float64(available)/float64(len(t.backends)))
+}
+
+// firstTier returns the index of the tier to try first. Each tier takes as
+// much of the traffic as its health allows, and what is left spills over to
+// the next tier. The first tier is picked at random by these shares; the
+// others follow by preference. state is the pool's snapshot.
+func (p *Pool) firstTier(state *availability, exclude map[*backend.Backend]bool) int {
+	if len(p.tiers) == 1 {
+		return 0
+	}
+
+	total := 0.0
+	for i, t := range p.tiers {
+		total += t.health(state.tiers[i], exclude, p.factor)
+	}
+	if total == 0 {
+		return 0
+	}
+
+	// When all tiers together are degraded, scale their health up so the
+	// shares still add up to all of the traffic
+	scale := 1.0
+	if total < 1 {
+		scale = 1 / total
+	}
+
+	pick := rand.Float64()
+	remaining := 1.0
+	for i, t := range p.tiers {
+		share := math.Min(t.health(state.tiers[i], exclude, p.factor)*scale, remaining)
+		if pick < share {
+			return i
+		}
+		pick -= share
+		remaining -= share
+	}
+	return 0
+}
@@ -0,0 +1,285 @@
+package serverpool
+
+import (
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+)
+
+// picksPerTier makes n picks from pool and counts them per backend
+// priority, with backups counted under -1
+func picksPerTier(t *testing.T, pool *Pool, n int) map[int]int {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/", nil)
+	counts := make(map[int]int)
+	for i := 0; i < n; i++ {
+		b, err := pool.NextBackend(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool.Release(b)
+		if b.IsBackup() {
+			counts[-1]++
+		} else {
+			counts[b.GetPriority()]++
+		}
+	}
+	return counts
+}
+
+// markDown marks the first n backends of pool with priority as unhealthy
+func markDown(pool *Pool, priority, n int) {
+	for _, b := range pool.Backends {
+		if n > 0 && !b.IsBackup() && b.GetPriority() == priority {
+			pool.MarkBackendStatus(b.URL.String(), false)
+			n--
+		}
+	}
+}
+
+// tieredConfig returns a pool config with four backends of priority 0,
+// four of priority 1 and two backups
+func tieredConfig() configs.BackendPoolConfig {
+	config := configs.BackendPoolConfig{Name: "tiers", Algorithm: "round_robin"}
+	for i := 0; i < 10; i++ {
+		config.Backends = append(config.Backends, configs.BackendConfig{
+			URL:      fmt.Sprintf("http://10.0.4.%d:8080", i+1),
+			Weight:   1,
+			Priority: i / 4 % 2,
+			Backup:   i >= 8,
+		})
+	}
+	return config
+}
+
+func TestTierSpillover(t *testing.T) {
+	tests := []struct {
+		name      string
+		factor    float64
+		noBackups bool
+		down      map[int]int // unhealthy backends per priority
+		want      map[int]float64
+	}{
+		{
+			name: "all healthy",
+			want: map[int]float64{0: 1},
+		},
+		{
+			name: "overprovisioning covers one of four",
+			down: map[int]int{0: 1},
+			want: map[int]float64{0: 1},
+		},
+		{
+			name: "half of the first tier",
+			down: map[int]int{0: 2},
+			want: map[int]float64{0: 0.7, 1: 0.3},
+		},
+		{
+			name:   "half of the first tier without overprovisioning",
+			factor: 1,
+			down:   map[int]int{0: 2},
+			want:   map[int]float64{0: 0.5, 1: 0.5},
+		},
+		{
+			name: "first tier down",
+			down: map[int]int{0: 4},
+			want: map[int]float64{1: 1},
+		},
+		{
+			name: "backups take what is left",
+			down: map[int]int{0: 4, 1: 3},
+			want: map[int]float64{1: 0.35, -1: 0.65},
+		},
+		{
+			name: "degraded tiers spill over to backups",
+			down: map[int]int{0: 3, 1: 3},
+			want: map[int]float64{0: 0.35, 1: 0.35, -1: 0.3},
+		},
+		{
+			name:      "degraded tiers without backups share all traffic",
+			noBackups: true,
+			down:      map[int]int{0: 3, 1: 3},
+			// Each tier is 35% healthy, scaled up to add up to everything
+			want: map[int]float64{0: 0.5, 1: 0.5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tieredConfig()
+			config.OverprovisioningFactor = tt.factor
+			if tt.noBackups {
+				config.Backends = config.Backends[:8]
+			}
+			pool, err := NewPool(config, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for priority, n := range tt.down {
+				markDown(pool, priority, n)
+			}
+
+			n := 20000
+			counts := picksPerTier(t, pool, n)
+			for priority, share := range tt.want {
+				if got := float64(counts[priority]) / float64(n); math.Abs(got-share) > 0.03 {
+					t.Errorf("tier %d got %.3f of the picks, want %.3f", priority, got, share)
+				}
+			}
+			for priority, count := range counts {
+				if _, ok := tt.want[priority]; !ok {
+					t.Errorf("tier %d got %d picks, want none", priority, count)
+				}
+			}
+		})
+	}
+}
+
+func TestTierFallsBackWhenExcluded(t *testing.T) {
+	pool, err := NewPool(tieredConfig(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A retry that already tried every backend of the first tier moves on
+	// to the next one
+	exclude := make(map[*backend.Backend]bool)
+	for _, b := range pool.Backends {
+		if !b.IsBackup() && b.GetPriority() == 0 {
+			exclude[b] = true
+		}
+	}
+	b, err := pool.NextBackendExcluding(httptest.NewRequest("GET", "/", nil), exclude)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.IsBackup() || b.GetPriority() != 1 {
+		t.Errorf("selected %s with priority %d, want priority 1", b.URL, b.GetPriority())
+	}
+}
+
+// zonedConfig returns a pool config with three backends in zone-a and three
+// in zone-b
+func zonedConfig() configs.BackendPoolConfig {
+	config := configs.BackendPoolConfig{
+		Name:        "zones",
+		Algorithm:   "round_robin",
+		ZoneRouting: configs.ZoneRoutingConfig{Enabled: true},
+	}
+	for i := 0; i < 6; i++ {
+		zone := "zone-a"
+		if i >= 3 {
+			zone = "zone-b"
+		}
+		config.Backends = append(config.Backends, configs.BackendConfig{
+			URL:    fmt.Sprintf("http://10.0.5.%d:8080", i+1),
+			Weight: 1,
+			Zone:   zone,
+		})
+	}
+	return config
+}
+
+func TestZoneSpillover(t *testing.T) {
+	tests := []struct {
+		name       string
+		zone       string
+		disabled   bool
+		minHealthy int
+		weightB    int
+		downA      int
+		want       map[string]float64
+	}{
+		{
+			name: "local zone healthy",
+			zone: "zone-a",
+			want: map[string]float64{"zone-a": 1},
+		},
+		{
+			name:  "local zone below the minimum",
+			zone:  "zone-a",
+			downA: 1,
+			// zone-a has 2 of 5 available units of capacity
+			want: map[string]float64{"zone-a": 0.4, "zone-b": 0.6},
+		},
+		{
+			name:       "local zone above a lower minimum",
+			zone:       "zone-a",
+			minHealthy: 50,
+			downA:      1,
+			want:       map[string]float64{"zone-a": 1},
+		},
+		{
+			name:    "spillover by capacity",
+			zone:    "zone-a",
+			weightB: 3,
+			downA:   2,
+			// zone-a has 1 of 10 available units of capacity
+			want: map[string]float64{"zone-a": 0.1, "zone-b": 0.9},
+		},
+		{
+			name:  "local zone down",
+			zone:  "zone-a",
+			downA: 3,
+			want:  map[string]float64{"zone-b": 1},
+		},
+		{
+			name:     "zone routing disabled",
+			zone:     "zone-a",
+			disabled: true,
+			want:     map[string]float64{"zone-a": 0.5, "zone-b": 0.5},
+		},
+		{
+			name: "no backends in the local zone",
+			zone: "zone-c",
+			want: map[string]float64{"zone-a": 0.5, "zone-b": 0.5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := zonedConfig()
+			config.ZoneRouting.Enabled = !tt.disabled
+			config.ZoneRouting.MinHealthyPercent = tt.minHealthy
+			if tt.weightB > 0 {
+				for i := 3; i < 6; i++ {
+					config.Backends[i].Weight = tt.weightB
+				}
+			}
+			pool, err := NewPool(config, tt.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.downA; i++ {
+				pool.MarkBackendStatus(pool.Backends[i].URL.String(), false)
+			}
+
+			n := 20000
+			r := httptest.NewRequest("GET", "/", nil)
+			counts := make(map[string]int)
+			for i := 0; i < n; i++ {
+				b, err := pool.NextBackend(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				pool.Release(b)
+				counts[b.GetZone()]++
+			}
+
+			for zone, share := range tt.want {
+				if got := float64(counts[zone]) / float64(n); math.Abs(got-share) > 0.03 {
+					t.Errorf("%s got %.3f of the picks, want %.3f", zone, got, share)
+				}
+			}
+			for zone, count := range counts {
+				if _, ok := tt.want[zone]; !ok {
+					t.Errorf("%s got %d picks, want none", zone, count)
+				}
+			}
+		})
+	}
+}
@@ -210,7 +210,7 @@ func TracingMiddleware(next http.Handler) http.Handler {
 
 		// Record error if status code indicates error
 		if rw.statusCode >= 400 {
-			span.SetStatus(codes.Error, fmt.Sprintf("%s: %s", rw.statusCode, http.StatusText(rw.statusCode)))
+			span.SetStatus(codes.Error, fmt.Sprintf("%d: %s", rw.statusCode, http.StatusText(rw.statusCode)))
 		} else {
 			span.SetStatus(codes.Ok, "")
 		}
@@ -0,0 +1,364 @@
+package validation
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/policy"
+	"github.com/rixtrayker/go-loadbalancer/internal/retry"
+	"github.com/rixtrayker/go-loadbalancer/internal/routing"
+	"github.com/rixtrayker/go-loadbalancer/internal/serverpool"
+)
+
+// methods are the request methods a routing rule can match
+var methods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// problems collects the problems found in a config
+type problems []*configs.FieldError
+
+func (p *problems) add(path, format string, args ...interface{}) {
+	*p = append(*p, &configs.FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate returns every problem in the configuration. On top of the
+// structural checks of configs.Check it verifies backend URLs, algorithm
+// names, health checks, match patterns and policy arguments, and reports
+// routing rules that an earlier rule shadows.
+func Validate(config *configs.Config) []*configs.FieldError {
+	p := problems(configs.Check(config))
+
+	for i, pool := range config.BackendPools {
+		path := fmt.Sprintf("backend_pools.%d", i)
+		checkPool(path, pool, &p)
+		if pool.ZoneRouting.Enabled && config.Server.Zone == "" {
+			p.add(path+".zone_routing.enabled", "zone routing requires server.zone")
+		}
+	}
+
+	for i, rule := range config.RoutingRules {
+		checkRule(fmt.Sprintf("routing_rules.%d", i), rule, &p)
+	}
+	checkShadowing(config.RoutingRules, &p)
+
+	return p
+}
+
+// checkPool checks the backends, algorithm, health check, transport,
+// circuit breaker, sticky sessions, slow start, zone routing and request
+// queue of a pool
+func checkPool(path string, pool configs.BackendPoolConfig, p *problems) {
+	if err := serverpool.ValidateAlgorithm(pool.Algorithm, pool.AlgorithmArgs); err != nil {
+		p.add(path+".algorithm", "%v", err)
+	}
+
+	for i, b := range pool.Backends {
+		backendPath := fmt.Sprintf("%s.backends.%d", path, i)
+		if b.URL != "" {
+			if err := checkBackendURL(b.URL); err != nil {
+				p.add(backendPath+".url", "invalid backend URL %q: %v", b.URL, err)
+			}
+		}
+		if b.Weight < 0 {
+			p.add(backendPath+".weight", "weight must not be negative")
+		}
+		if b.Priority < 0 {
+			p.add(backendPath+".priority", "priority must not be negative")
+		}
+		if b.MaxConnections < 0 {
+			p.add(backendPath+".max_connections", "count must not be negative")
+		}
+	}
+	if pool.OverprovisioningFactor != 0 && pool.OverprovisioningFactor < 1 {
+		p.add(path+".overprovisioning_factor", "overprovisioning factor must be at least 1")
+	}
+
+	hc := pool.HealthCheck
+	if hc.Interval < 0 {
+		p.add(path+".health_check.interval", "interval must not be negative")
+	}
+	if hc.Timeout < 0 {
+		p.add(path+".health_check.timeout", "timeout must not be negative")
+	}
+	if hc.Interval > 0 && hc.Timeout > hc.Interval {
+		p.add(path+".health_check.timeout", "timeout %s is longer than the interval %s", hc.Timeout, hc.Interval)
+	}
+	if hc.Method != "" && !methods[hc.Method] {
+		p.add(path+".health_check.method", "unknown HTTP method: %s", hc.Method)
+	}
+	if hc.HealthyThreshold < 0 {
+		p.add(path+".health_check.healthy_threshold", "threshold must not be negative")
+	}
+	if hc.UnhealthyThreshold < 0 {
+		p.add(path+".health_check.unhealthy_threshold", "threshold must not be negative")
+	}
+
+	checkOutlierDetection(path+".health_check.outlier_detection", hc.OutlierDetection, p)
+	checkTransport(path+".transport", pool.Transport, p)
+	checkCircuitBreaker(path+".circuit_breaker", pool.CircuitBreaker, p)
+
+	if err := serverpool.ValidateStickySession(pool.StickySession); err != nil {
+		p.add(path+".sticky_session", "%v", err)
+	}
+
+	if pool.SlowStart.Window < 0 {
+		p.add(path+".slow_start.window", "duration must not be negative")
+	}
+	if pool.SlowStart.MinWeightPercent < 0 || pool.SlowStart.MinWeightPercent > 100 {
+		p.add(path+".slow_start.min_weight_percent", "percentage must be between 0 and 100")
+	}
+	if pool.ZoneRouting.MinHealthyPercent < 0 || pool.ZoneRouting.MinHealthyPercent > 100 {
+		p.add(path+".zone_routing.min_healthy_percent", "percentage must be between 0 and 100")
+	}
+	if pool.MaxPending < 0 {
+		p.add(path+".max_pending", "count must not be negative")
+	}
+	if pool.QueueTimeout < 0 {
+		p.add(path+".queue_timeout", "duration must not be negative")
+	}
+}
+
+// checkOutlierDetection checks the triggers and ejection limits of passive
+// health checking
+func checkOutlierDetection(path string, od configs.OutlierDetectionConfig, p *problems) {
+	if od.Consecutive5xx < 0 {
+		p.add(path+".consecutive_5xx", "count must not be negative")
+	}
+	if od.ConsecutiveGatewayErrors < 0 {
+		p.add(path+".consecutive_gateway_errors", "count must not be negative")
+	}
+	if od.LatencyFactor < 0 || (od.LatencyFactor > 0 && od.LatencyFactor <= 1) {
+		p.add(path+".latency_factor", "latency factor must be greater than 1")
+	}
+	if od.LatencyMinRequests < 0 {
+		p.add(path+".latency_min_requests", "count must not be negative")
+	}
+	if od.Interval < 0 {
+		p.add(path+".interval", "duration must not be negative")
+	}
+	if od.BaseEjectionTime < 0 {
+		p.add(path+".base_ejection_time", "duration must not be negative")
+	}
+	if od.MaxEjectionTime < 0 {
+		p.add(path+".max_ejection_time", "duration must not be negative")
+	}
+	if od.MaxEjectionPercent < 0 || od.MaxEjectionPercent > 100 {
+		p.add(path+".max_ejection_percent", "percentage must be between 0 and 100")
+	}
+}
+
+// checkCircuitBreaker checks the triggers and timings of a pool's circuit
+// breaker
+func checkCircuitBreaker(path string, cb configs.CircuitBreakerConfig, p *problems) {
+	if cb.ConsecutiveFailures < 0 {
+		p.add(path+".consecutive_failures", "count must not be negative")
+	}
+	if cb.ErrorRate < 0 || cb.ErrorRate > 1 {
+		p.add(path+".error_rate", "error rate must be between 0 and 1")
+	}
+	if cb.Window < 0 {
+		p.add(path+".window", "duration must not be negative")
+	}
+	if cb.MinRequests < 0 {
+		p.add(path+".min_requests", "count must not be negative")
+	}
+	if cb.OpenDuration < 0 {
+		p.add(path+".open_duration", "duration must not be negative")
+	}
+	if cb.HalfOpenRequests < 0 {
+		p.add(path+".half_open_requests", "count must not be negative")
+	}
+}
+
+// checkTransport checks the connection limits and timeouts of a pool
+func checkTransport(path string, t configs.TransportConfig, p *problems) {
+	if t.MaxIdleConns < 0 {
+		p.add(path+".max_idle_conns", "limit must not be negative")
+	}
+	if t.MaxConns < 0 {
+		p.add(path+".max_conns", "limit must not be negative")
+	}
+
+	// Listed in order so problems are reported in a stable order
+	timeouts := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"idle_conn_timeout", t.IdleConnTimeout},
+		{"dial_timeout", t.DialTimeout},
+		{"tls_handshake_timeout", t.TLSHandshakeTimeout},
+		{"response_header_timeout", t.ResponseHeaderTimeout},
+		{"keep_alive", t.KeepAlive},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value < 0 {
+			p.add(path+"."+timeout.name, "duration must not be negative")
+		}
+	}
+}
+
+// checkBackendURL checks that a backend URL is an absolute http(s) URL
+func checkBackendURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("host is required")
+	}
+	return nil
+}
+
+// checkRule checks the match criteria, policies and retry policy of a
+// routing rule
+func checkRule(path string, rule configs.RoutingRuleConfig, p *problems) {
+	if rule.Match.Method != "" && !methods[rule.Match.Method] {
+		p.add(path+".match.method", "unknown HTTP method: %s", rule.Match.Method)
+	}
+
+	if _, err := routing.NewPathMatcher(rule.Match); err != nil {
+		p.add(path+".match", "%v", err)
+	}
+
+	for name, pattern := range rule.Match.Headers {
+		if _, err := regexp.Compile(pattern); err != nil {
+			p.add(path+".match.headers."+name, "invalid header pattern: %v", err)
+		}
+	}
+
+	for i, policyConfig := range rule.Policies {
+		if err := policy.Validate(policyConfig); err != nil {
+			p.add(fmt.Sprintf("%s.policies.%d", path, i), "%v", err)
+		}
+	}
+
+	if _, err := retry.New(rule.Retry); err != nil {
+		p.add(path+".retry", "%v", err)
+	}
+}
+
+// checkShadowing reports rules that can never match because a rule
+// evaluated before them matches every request they would
+func checkShadowing(rules []configs.RoutingRuleConfig, p *problems) {
+	// Evaluation order, as in routing.NewRouter
+	order := make([]int, len(rules))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return rules[order[i]].Priority > rules[order[j]].Priority
+	})
+
+	for j, later := range order {
+		for _, earlier := range order[:j] {
+			if covers(rules[earlier].Match, rules[later].Match) {
+				p.add(fmt.Sprintf("routing_rules.%d", later), "rule is shadowed by %s and never matches", ruleName(rules, earlier))
+				break
+			}
+		}
+	}
+}
+
+// ruleName identifies a rule in messages
+func ruleName(rules []configs.RoutingRuleConfig, i int) string {
+	if rules[i].Name != "" {
+		return fmt.Sprintf("routing_rules.%d (%s)", i, rules[i].Name)
+	}
+	return fmt.Sprintf("routing_rules.%d", i)
+}
+
+// covers reports whether every request matched by b is also matched by a.
+// It errs on the side of false when it cannot tell, e.g. for regexes.
+func covers(a, b configs.MatchConfig) bool {
+	if !globCovers(strings.ToLower(a.Host), strings.ToLower(b.Host)) || !pathCovers(a, b) {
+		return false
+	}
+	if a.Method != "" && a.Method != b.Method {
+		return false
+	}
+
+	for name, pattern := range a.Headers {
+		if headerPattern(b.Headers, name) != pattern {
+			return false
+		}
+	}
+	return true
+}
+
+// pathCovers reports whether the path criteria of a match every path the
+// criteria of b do
+func pathCovers(a, b configs.MatchConfig) bool {
+	switch {
+	case a.Path == "" && a.PathPrefix == "" && a.PathRegex == "", a.Path == "*":
+		return true
+	case a.Path == "/*":
+		// Request paths always start with a slash
+		return b.Path != "" || b.PathPrefix != "" || b.PathRegex != ""
+	case a.PathRegex != "":
+		return a.PathRegex == b.PathRegex
+	case b.PathRegex != "" || (b.Path == "" && b.PathPrefix == ""):
+		return false
+	}
+
+	if a.PathPrefix != "" {
+		if b.PathPrefix != "" {
+			return routing.MatchPrefix(a.PathPrefix, b.PathPrefix)
+		}
+		// Every path b matches starts with the text before its first *
+		literal, _, wildcard := strings.Cut(b.Path, "*")
+		if !wildcard {
+			return routing.MatchPrefix(a.PathPrefix, literal)
+		}
+		return strings.HasPrefix(literal, a.PathPrefix) &&
+			(strings.HasSuffix(a.PathPrefix, "/") || (len(literal) > len(a.PathPrefix) && literal[len(a.PathPrefix)] == '/'))
+	}
+
+	if b.PathPrefix != "" {
+		// b matches the prefix itself and everything below it
+		below := strings.TrimSuffix(b.PathPrefix, "/") + "/*"
+		return globCovers(a.Path, b.PathPrefix) && globCovers(a.Path, below)
+	}
+	return globCovers(a.Path, b.Path)
+}
+
+// globCovers reports whether the wildcard pattern a matches everything the
+// wildcard pattern b does. An empty pattern matches everything. Each * in b
+// must fall within a * of a, so matching b literally against a is enough.
+func globCovers(a, b string) bool {
+	if a == "" {
+		return true
+	}
+	if b == "" {
+		return false
+	}
+	pattern := strings.ReplaceAll(regexp.QuoteMeta(a), `\*`, ".*")
+	return regexp.MustCompile("^" + pattern + "$").MatchString(b)
+}
+
+// headerPattern returns the pattern for a header, ignoring case in the name
+func headerPattern(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,358 @@
+package validation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+)
+
+// validConfig returns a config without problems
+func validConfig() *configs.Config {
+	config := configs.DefaultConfig()
+	config.BackendPools = []configs.BackendPoolConfig{{
+		Name:      "web",
+		Algorithm: "round_robin",
+		Backends:  []configs.BackendConfig{{URL: "http://10.0.0.1:8080", Weight: 1}},
+	}}
+	config.RoutingRules = []configs.RoutingRuleConfig{{TargetPool: "web"}}
+	return config
+}
+
+// paths returns the config paths of problems
+func paths(problems []*configs.FieldError) []string {
+	var paths []string
+	for _, problem := range problems {
+		paths = append(paths, problem.Path)
+	}
+	return paths
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(config *configs.Config)
+		want   string // path of the only problem, "" for none
+	}{
+		{
+			name:   "valid",
+			change: func(config *configs.Config) {},
+		},
+		{
+			name:   "backend URL scheme",
+			change: func(config *configs.Config) { config.BackendPools[0].Backends[0].URL = "ftp://10.0.0.1" },
+			want:   "backend_pools.0.backends.0.url",
+		},
+		{
+			name:   "backend URL without host",
+			change: func(config *configs.Config) { config.BackendPools[0].Backends[0].URL = "http://" },
+			want:   "backend_pools.0.backends.0.url",
+		},
+		{
+			name:   "unknown algorithm",
+			change: func(config *configs.Config) { config.BackendPools[0].Algorithm = "fastest" },
+			want:   "backend_pools.0.algorithm",
+		},
+		{
+			name: "unknown algorithm argument",
+			change: func(config *configs.Config) {
+				config.BackendPools[0].AlgorithmArgs = configs.Args{"replicas": 10}
+			},
+			want: "backend_pools.0.algorithm",
+		},
+		{
+			name:   "health check method",
+			change: func(config *configs.Config) { config.BackendPools[0].HealthCheck.Method = "FETCH" },
+			want:   "backend_pools.0.health_check.method",
+		},
+		{
+			name: "health check timeout longer than interval",
+			change: func(config *configs.Config) {
+				config.BackendPools[0].HealthCheck.Interval = time.Second
+				config.BackendPools[0].HealthCheck.Timeout = 2 * time.Second
+			},
+			want: "backend_pools.0.health_check.timeout",
+		},
+		{
+			name: "outlier latency factor",
+			change: func(config *configs.Config) {
+				config.BackendPools[0].HealthCheck.OutlierDetection.LatencyFactor = 1
+			},
+			want: "backend_pools.0.health_check.outlier_detection.latency_factor",
+		},
+		{
+			name: "outlier ejection percentage",
+			change: func(config *configs.Config) {
+				config.BackendPools[0].HealthCheck.OutlierDetection.MaxEjectionPercent = 150
+			},
+			want: "backend_pools.0.health_check.outlier_detection.max_ejection_percent",
+		},
+		{
+			name:   "circuit breaker error rate",
+			change: func(config *configs.Config) { config.BackendPools[0].CircuitBreaker.ErrorRate = 2 },
+			want:   "backend_pools.0.circuit_breaker.error_rate",
+		},
+		{
+			name:   "negative transport timeout",
+			change: func(config *configs.Config) { config.BackendPools[0].Transport.DialTimeout = -time.Second },
+			want:   "backend_pools.0.transport.dial_timeout",
+		},
+		{
+			name:   "zone routing without a zone",
+			change: func(config *configs.Config) { config.BackendPools[0].ZoneRouting.Enabled = true },
+			want:   "backend_pools.0.zone_routing.enabled",
+		},
+		{
+			name:   "rule method",
+			change: func(config *configs.Config) { config.RoutingRules[0].Match.Method = "FETCH" },
+			want:   "routing_rules.0.match.method",
+		},
+		{
+			name:   "path regex",
+			change: func(config *configs.Config) { config.RoutingRules[0].Match.PathRegex = "/api/(v1" },
+			want:   "routing_rules.0.match",
+		},
+		{
+			name: "path and prefix",
+			change: func(config *configs.Config) {
+				config.RoutingRules[0].Match.Path = "/api"
+				config.RoutingRules[0].Match.PathPrefix = "/api"
+			},
+			want: "routing_rules.0.match",
+		},
+		{
+			name: "header regex",
+			change: func(config *configs.Config) {
+				config.RoutingRules[0].Match.Headers = map[string]string{"X-Env": "[prod"}
+			},
+			want: "routing_rules.0.match.headers.X-Env",
+		},
+		{
+			name: "unknown policy",
+			change: func(config *configs.Config) {
+				config.RoutingRules[0].Policies = []configs.PolicyConfig{{Name: "waf"}}
+			},
+			want: "routing_rules.0.policies.0",
+		},
+		{
+			name: "policy arguments",
+			change: func(config *configs.Config) {
+				config.RoutingRules[0].Policies = []configs.PolicyConfig{{Name: "rate_limit", Args: configs.Args{"rate": "often"}}}
+			},
+			want: "routing_rules.0.policies.0",
+		},
+		{
+			name:   "retry attempts",
+			change: func(config *configs.Config) { config.RoutingRules[0].Retry.MaxAttempts = -1 },
+			want:   "routing_rules.0.retry",
+		},
+		{
+			name:   "retry condition",
+			change: func(config *configs.Config) { config.RoutingRules[0].Retry.RetryOn = []string{"sometimes"} },
+			want:   "routing_rules.0.retry",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig()
+			tt.change(config)
+
+			got := strings.Join(paths(Validate(config)), " ")
+			if got != tt.want {
+				t.Errorf("problems at %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	config := validConfig()
+	config.BackendPools[0].Backends[0].URL = "ftp://10.0.0.1"
+	config.BackendPools[0].Algorithm = "fastest"
+	config.RoutingRules[0].Match.Method = "FETCH"
+	// Structural problems of configs.Check come first
+	config.RoutingRules = append(config.RoutingRules, configs.RoutingRuleConfig{TargetPool: "api"})
+
+	want := []string{
+		"routing_rules.1.target_pool",
+		"backend_pools.0.algorithm",
+		"backend_pools.0.backends.0.url",
+		"routing_rules.0.match.method",
+	}
+	if got := paths(Validate(config)); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("problems at %v, want %v", got, want)
+	}
+}
+
+const invalidConfig = `
+backend_pools:
+  - name: web
+    algorithm: fastest
+    backends:
+      - url: http://10.0.0.1:8080
+      - url: ftp://10.0.0.2
+routing_rules:
+  - target_pool: web
+    match:
+      method: FETCH
+`
+
+func TestValidateLocatesProblems(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(invalidConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loader := configs.NewLoader([]string{path}, nil)
+	config, err := loader.Merge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"backend_pools.0.algorithm":      path + ":4",
+		"backend_pools.0.backends.1.url": path + ":7",
+		"routing_rules.0.match.method":   path + ":11",
+	}
+	problems := Validate(config)
+	if len(problems) != len(want) {
+		t.Fatalf("problems %v, want %d", problems, len(want))
+	}
+	for _, problem := range problems {
+		if location := loader.Locate(problem.Path); location != want[problem.Path] {
+			t.Errorf("%s located at %q, want %q", problem.Path, location, want[problem.Path])
+		}
+	}
+}
+
+func TestCheckShadowing(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []configs.RoutingRuleConfig
+		want  []string // messages of the shadowed rules
+	}{
+		{
+			name:  "catch-all first",
+			rules: []configs.RoutingRuleConfig{{}, {Match: configs.MatchConfig{PathPrefix: "/api"}}},
+			want:  []string{"routing_rules.1: rule is shadowed by routing_rules.0 and never matches"},
+		},
+		{
+			name: "catch-all last",
+			rules: []configs.RoutingRuleConfig{
+				{Match: configs.MatchConfig{PathPrefix: "/api"}},
+				{},
+			},
+		},
+		{
+			name: "shorter prefix",
+			rules: []configs.RoutingRuleConfig{
+				{Name: "api", Match: configs.MatchConfig{PathPrefix: "/api"}},
+				{Match: configs.MatchConfig{PathPrefix: "/api/v1"}},
+			},
+			want: []string{"routing_rules.1: rule is shadowed by routing_rules.0 (api) and never matches"},
+		},
+		{
+			name: "prefix within a path segment",
+			rules: []configs.RoutingRuleConfig{
+				{Match: configs.MatchConfig{PathPrefix: "/api"}},
+				{Match: configs.MatchConfig{PathPrefix: "/apiv2"}},
+			},
+		},
+		{
+			name: "prefix covers a glob below it",
+			rules: []configs.RoutingRuleConfig{
+				{Match: configs.MatchConfig{PathPrefix: "/static"}},
+				{Match: configs.MatchConfig{Path: "/static/*.css"}},
+			},
+			want: []string{"routing_rules.1: rule is shadowed by routing_rules.0 and never matches"},
+		},
+		{
+			name: "glob covers a narrower glob and exact path",
+			rules: []configs.RoutingRuleConfig{
+				{Match: configs.MatchConfig{Path: "/static/*"}},
+				{Match: configs.MatchConfig{Path: "/static/css/*"}},
+				{Match: configs.MatchConfig{Path: "/static/app.js"}},
+			},
+			want: []string{
+				"routing_rules.1: rule is shadowed by routing_rules.0 and never matches",
+				"routing_rules.2: rule is shadowed by routing_rules.0 and never matches",
+			},
+		},
+		{
+			name: "glob misses the prefix itself",
+			rules: []configs.RoutingRuleConfig{
+				{Match: configs.MatchConfig{Path: "/static/*"}},
+				{Match: configs.MatchConfig{PathPrefix: "/static"}},
+			},
+		},
+		{
+			name: "glob covers a prefix below it",
+			rules: []configs.RoutingRuleConfig{
+				{Match: configs.MatchConfig{Path: "/static/*"}},
+				{Match: configs.MatchConfig{PathPrefix: "/static/css"}},
+			},
+			want: []string{"routing_rules.1: rule is shadowed by routing_rules.0 and never matches"},
+		},
+		{
+			name: "same regex",
+			rules: []configs.RoutingRuleConfig{
+				{Match: configs.MatchConfig{PathRegex: "/users/[0-9]+"}},
+				{Match: configs.MatchConfig{PathRegex: "/users/[0-9]+"}},
+			},
+			want: []string{"routing_rules.1: rule is shadowed by routing_rules.0 and never matches"},
+		},
+		{
+			name: "regexes are not compared",
+			rules: []configs.RoutingRuleConfig{
+				{Match: configs.MatchConfig{PathRegex: "/users/.*"}},
+				{Match: configs.MatchConfig{PathRegex: "/users/[0-9]+"}},
+				{Match: configs.MatchConfig{Path: "/users/1"}},
+			},
+		},
+		{
+			name: "priority reorders rules",
+			rules: []configs.RoutingRuleConfig{
+				{Match: configs.MatchConfig{PathPrefix: "/api/v1"}},
+				{Match: configs.MatchConfig{PathPrefix: "/api"}, Priority: 10},
+			},
+			want: []string{"routing_rules.0: rule is shadowed by routing_rules.1 and never matches"},
+		},
+		{
+			name: "method and host",
+			rules: []configs.RoutingRuleConfig{
+				{Match: configs.MatchConfig{Host: "*.example.com", PathPrefix: "/api"}},
+				{Match: configs.MatchConfig{Host: "API.example.com", PathPrefix: "/api", Method: "POST"}},
+				{Match: configs.MatchConfig{Method: "GET", PathPrefix: "/"}},
+				{Match: configs.MatchConfig{Host: "example.org", PathPrefix: "/"}},
+			},
+			want: []string{"routing_rules.1: rule is shadowed by routing_rules.0 and never matches"},
+		},
+		{
+			name: "headers",
+			rules: []configs.RoutingRuleConfig{
+				{Match: configs.MatchConfig{Headers: map[string]string{"X-Canary": "true"}}},
+				{Match: configs.MatchConfig{PathPrefix: "/"}},
+				{Match: configs.MatchConfig{Headers: map[string]string{"x-canary": "true", "X-Env": "prod"}}},
+			},
+			want: []string{"routing_rules.2: rule is shadowed by routing_rules.0 and never matches"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p problems
+			checkShadowing(tt.rules, &p)
+
+			var got []string
+			for _, problem := range p {
+				got = append(got, problem.Error())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("problems %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
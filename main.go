@@ -2,23 +2,84 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
 
+	"github.com/rixtrayker/go-loadbalancer/configs"
 	"github.com/rixtrayker/go-loadbalancer/internal/app"
 	"github.com/rixtrayker/go-loadbalancer/internal/logging"
+	"github.com/rixtrayker/go-loadbalancer/internal/validation"
 )
 
+// defaultConfigPath is read when no -config flag is given and the file exists
+const defaultConfigPath = "configs/config.yml"
+
+// stringList is a flag that can be repeated
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// configFlags registers the flags that select configuration sources and
+// returns a function that builds the loader once the flags are parsed
+func configFlags(fs *flag.FlagSet) func() *configs.Loader {
+	var configPaths, overrides stringList
+	fs.Var(&configPaths, "config", "Path to a YAML or JSON configuration file; repeat to layer files (default "+defaultConfigPath+")")
+	fs.Var(&overrides, "set", "Override a configuration value as key=value, e.g. backend_pools.0.algorithm=least_conn; may be repeated")
+	address := fs.String("address", "", "Override server address")
+	logLevel := fs.String("log-level", "", "Set logging level")
+
+	return func() *configs.Loader {
+		if len(configPaths) == 0 {
+			if _, err := os.Stat(defaultConfigPath); err == nil {
+				configPaths = append(configPaths, defaultConfigPath)
+			}
+		}
+		if *address != "" {
+			overrides = append(overrides, "server.address="+*address)
+		}
+		if *logLevel != "" {
+			overrides = append(overrides, "monitoring.logging.level="+*logLevel)
+		}
+		return configs.NewLoader(configPaths, overrides)
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(validate(os.Args[2:]))
+	}
+
 	// Parse command line flags
-	configPath := flag.String("config", "configs/config.yml", "Path to configuration file")
+	newLoader := configFlags(flag.CommandLine)
+	printConfig := flag.Bool("print-config", false, "Print the effective configuration with the source of each value and exit")
 	flag.Parse()
+	loader := newLoader()
+
+	if *printConfig {
+		if _, err := loader.Load(); err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+		for _, origin := range loader.Origins() {
+			fmt.Printf("%s = %s (%s)\n", origin.Path, origin.Value, origin.Source)
+		}
+		return
+	}
 
 	// Initialize logger
 	logger := logging.NewLogger()
 	logger.Info("Starting Go Load Balancer")
 
 	// Create and run application
-	application, err := app.New(*configPath)
+	application, err := app.New(loader)
 	if err != nil {
 		log.Fatalf("Failed to initialize application: %v", err)
 	}
@@ -27,3 +88,39 @@ func main() {
 		log.Fatalf("Application error: %v", err)
 	}
 }
+
+// validate implements the validate subcommand. It reports every problem in
+// the configuration with the file and line it comes from and returns a
+// non-zero exit code if there are any.
+func validate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s validate [flags]\n\nChecks the configuration and reports every problem found.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	newLoader := configFlags(fs)
+	fs.Parse(args)
+	loader := newLoader()
+
+	config, err := loader.Merge()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	problems := append(loader.Unknown(), validation.Validate(config)...)
+	for _, problem := range problems {
+		if location := loader.Locate(problem.Path); location != "" {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", location, problem)
+		} else {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "%d problem(s) found\n", len(problems))
+		return 1
+	}
+
+	fmt.Println("Configuration is valid")
+	return 0
+}
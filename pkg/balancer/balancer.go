@@ -0,0 +1,86 @@
+// Package balancer is the API for programs that embed the load balancer.
+// It lets them register their own load balancing algorithms and policies,
+// which backend pools and routing rules then select by name like the
+// built-in ones, and run the load balancer.
+package balancer
+
+import (
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/app"
+	"github.com/rixtrayker/go-loadbalancer/internal/backend"
+	"github.com/rixtrayker/go-loadbalancer/internal/policy"
+	"github.com/rixtrayker/go-loadbalancer/internal/serverpool/algorithms"
+)
+
+type (
+	// Algorithm selects a backend for every request and is told when
+	// backends join or leave the pool and when their health changes
+	Algorithm = algorithms.Algorithm
+	// Base implements the lifecycle hooks of Algorithm as no-ops
+	Base = algorithms.Base
+	// LatencyObserver is implemented by algorithms that want the response
+	// time of every proxied request
+	LatencyObserver = algorithms.LatencyObserver
+	// Factory creates an algorithm for the backends of a pool from the
+	// pool's algorithm_args
+	Factory = algorithms.Factory
+	// Schema declares the arguments an algorithm accepts
+	Schema = algorithms.Schema
+	// Param declares one argument of an algorithm
+	Param = algorithms.Param
+	// Backend is a backend server of a pool
+	Backend = backend.Backend
+
+	// Policy is a step in the policy chain of a routing rule, with hooks
+	// for the request, the backend response and errors
+	Policy = policy.Policy
+	// PolicyBase implements every phase of Policy as a no-op
+	PolicyBase = policy.Base
+	// PolicyFactory creates a policy from the args of a routing rule's
+	// policy entry
+	PolicyFactory = policy.Factory
+)
+
+// Argument types of a Param
+const (
+	TypeString   = algorithms.TypeString
+	TypeInt      = algorithms.TypeInt
+	TypeFloat    = algorithms.TypeFloat
+	TypeBool     = algorithms.TypeBool
+	TypeDuration = algorithms.TypeDuration
+)
+
+// RegisterAlgorithm makes an algorithm available under name. Register
+// algorithms before the configuration is loaded, e.g. from an init
+// function. It panics if the name is empty or already taken, or the schema
+// is invalid.
+func RegisterAlgorithm(name string, schema Schema, factory Factory) {
+	algorithms.Register(name, schema, factory)
+}
+
+// Algorithms returns the names of all registered algorithms in sorted order
+func Algorithms() []string {
+	return algorithms.Names()
+}
+
+// RegisterPolicy makes a policy available under name. Register policies
+// before the configuration is loaded, e.g. from an init function. It panics
+// if the name is empty or already taken, or the factory is nil.
+func RegisterPolicy(name string, factory PolicyFactory) {
+	policy.Register(name, factory)
+}
+
+// Policies returns the names of all registered policies in sorted order
+func Policies() []string {
+	return policy.Names()
+}
+
+// Run loads the configuration from loader and runs the load balancer until
+// it receives SIGINT or SIGTERM
+func Run(loader *configs.Loader) error {
+	application, err := app.New(loader)
+	if err != nil {
+		return err
+	}
+	return application.Run()
+}
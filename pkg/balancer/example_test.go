@@ -0,0 +1,64 @@
+package balancer_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/rixtrayker/go-loadbalancer/configs"
+	"github.com/rixtrayker/go-loadbalancer/internal/serverpool"
+	"github.com/rixtrayker/go-loadbalancer/pkg/balancer"
+)
+
+// firstAvailable sends every request to the first available backend,
+// falling back in the order the backends are configured
+type firstAvailable struct {
+	balancer.Base
+	backends []*balancer.Backend
+}
+
+func (f *firstAvailable) NextBackend(r *http.Request) *balancer.Backend {
+	for _, b := range f.backends {
+		if b.IsAvailable() {
+			return b
+		}
+	}
+	return nil
+}
+
+func ExampleRegisterAlgorithm() {
+	balancer.RegisterAlgorithm("first_available", balancer.Schema{
+		{Name: "note", Type: balancer.TypeString, Description: "Free-form note"},
+	}, func(backends []*balancer.Backend, args configs.Args) (balancer.Algorithm, error) {
+		return &firstAvailable{backends: backends}, nil
+	})
+
+	// Pools select the algorithm by name
+	pool, err := serverpool.NewPool(configs.BackendPoolConfig{
+		Name:          "primary",
+		Algorithm:     "first_available",
+		AlgorithmArgs: configs.Args{"note": "failover"},
+		Backends: []configs.BackendConfig{
+			{URL: "http://primary:8080"},
+			{URL: "http://standby:8080"},
+		},
+	}, "")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	b, _ := pool.NextBackend(r)
+	fmt.Println(b.URL)
+	pool.Release(b)
+
+	pool.MarkBackendStatus("http://primary:8080", false)
+	b, _ = pool.NextBackend(r)
+	fmt.Println(b.URL)
+	pool.Release(b)
+
+	// Output:
+	// http://primary:8080
+	// http://standby:8080
+}